@@ -0,0 +1,218 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// requireAdmin protects admin API routes with the ADMIN_TOKEN bearer token.
+// If no token is configured the admin API is disabled entirely.
+func requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := os.Getenv("ADMIN_TOKEN")
+		if token == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			log.Printf("Unauthorized admin request from IP: %s", r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// writeJSON writes v as a JSON response with the given status
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeLeadError maps lead store errors to admin API responses
+func writeLeadError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errLeadNotFound) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return
+	}
+	log.Printf("Admin lead request failed: %v", err)
+	writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+}
+
+// handleAdminListLeads lists stored leads, optionally filtered by ?status=
+// and ?priority=, or with ?bounced=true only those whose email
+// hard-bounced. Leads are sorted by priority, then newest first, unless
+// ?sort=newest.
+func handleAdminListLeads(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	status, priority, bounced := q.Get("status"), q.Get("priority"), q.Get("bounced") == "true"
+	list := leads.List(func(l *Lead) bool {
+		return (status == "" || l.Status == status) && (priority == "" || l.Priority == priority) &&
+			(!bounced || l.HardBouncedAt != nil)
+	})
+	if list == nil {
+		list = []*Lead{}
+	}
+	if q.Get("sort") != "newest" {
+		// List is already newest first; a stable sort keeps that within a tier
+		sort.SliceStable(list, func(i, j int) bool {
+			return priorityRank[list[i].Priority] > priorityRank[list[j].Priority]
+		})
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// handleAdminGetLead returns a single lead
+func handleAdminGetLead(w http.ResponseWriter, r *http.Request) {
+	lead, err := leads.Get(r.PathValue("id"))
+	if err != nil {
+		writeLeadError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, lead)
+}
+
+// errLeadNotQuarantined is returned when releasing a lead that isn't held
+var errLeadNotQuarantined = errors.New("lead is not quarantined")
+
+// handleAdminReleaseLead accepts a quarantined lead and sends the emails
+// that were held back when it was submitted. The status flips first, so
+// of two concurrent releases only one sends them.
+func handleAdminReleaseLead(w http.ResponseWriter, r *http.Request) {
+	lead, err := leads.Update(r.PathValue("id"), func(l *Lead) error {
+		if l.Status != LeadQuarantined {
+			return errLeadNotQuarantined
+		}
+		l.Status = LeadNew
+		return nil
+	})
+	if errors.Is(err, errLeadNotQuarantined) {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		writeLeadError(w, err)
+		return
+	}
+
+	postmarkToken := os.Getenv("POSTMARK_TOKEN")
+	postmarkTo := os.Getenv("POSTMARK_TO")
+	postmarkFrom := os.Getenv("POSTMARK_FROM")
+	thankYouID, err := deliverLead(lead.ContactForm(), lead.ID, postmarkToken, postmarkTo, postmarkFrom, NotifyOptions{Priority: lead.Priority})
+	if err != nil {
+		// Put it back in quarantine so the release can be retried
+		if _, rerr := leads.Update(lead.ID, func(l *Lead) error {
+			l.Status = LeadQuarantined
+			return nil
+		}); rerr != nil {
+			log.Printf("Failed to requarantine lead %s: %v", lead.ID, rerr)
+		}
+		writeLeadError(w, err)
+		return
+	}
+
+	lead, err = leads.Update(lead.ID, func(l *Lead) error {
+		l.trackEmail(EmailThankYou, translate(l.Locale, "thankyou.subject"), thankYouID)
+		return nil
+	})
+	if err != nil {
+		writeLeadError(w, err)
+		return
+	}
+	leadAccepted(lead)
+	log.Printf("Released quarantined lead %s", lead.ID)
+	writeJSON(w, http.StatusOK, lead)
+}
+
+// handleAdminRejectLead marks a lead as spam
+func handleAdminRejectLead(w http.ResponseWriter, r *http.Request) {
+	lead, err := leads.Update(r.PathValue("id"), func(l *Lead) error {
+		l.Status = LeadSpam
+		return nil
+	})
+	if err != nil {
+		writeLeadError(w, err)
+		return
+	}
+	scheduler.StopNurture(lead.ID, "lead marked as spam")
+	log.Printf("Marked lead %s as spam", lead.ID)
+	writeJSON(w, http.StatusOK, lead)
+}
+
+// handleAdminSetLeadStatus moves an accepted lead through the pipeline
+// (new, contacted, won, lost). Leaving "new" ends its follow-up sequence.
+func handleAdminSetLeadStatus(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid body"})
+		return
+	}
+	if !slices.Contains(leadPipelineStatuses, body.Status) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "status must be one of " + strings.Join(leadPipelineStatuses, ", ")})
+		return
+	}
+	lead, err := leads.Update(r.PathValue("id"), func(l *Lead) error {
+		if !slices.Contains(leadPipelineStatuses, l.Status) {
+			return errLeadNotAccepted
+		}
+		l.Status = body.Status
+		return nil
+	})
+	if errors.Is(err, errLeadNotAccepted) {
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		writeLeadError(w, err)
+		return
+	}
+	if lead.Status != LeadNew {
+		scheduler.StopNurture(lead.ID, "lead status is "+lead.Status)
+	}
+	log.Printf("Lead %s is now %s", lead.ID, lead.Status)
+	writeJSON(w, http.StatusOK, lead)
+}
+
+// errLeadNotAccepted is returned when a pipeline change targets a
+// quarantined or spam lead
+var errLeadNotAccepted = errors.New("lead is quarantined or spam")
+
+// handleAdminUnsubscribeLead records that the prospect asked for no more
+// follow-ups, cancels the pending ones and suppresses follow-up mail to
+// their address
+func handleAdminUnsubscribeLead(w http.ResponseWriter, r *http.Request) {
+	lead, err := leads.Update(r.PathValue("id"), func(l *Lead) error {
+		if l.UnsubscribedAt == nil {
+			now := time.Now().UTC()
+			l.UnsubscribedAt = &now
+		}
+		return nil
+	})
+	if err != nil {
+		writeLeadError(w, err)
+		return
+	}
+	scheduler.StopNurture(lead.ID, "lead unsubscribed")
+	if lead.Email != "" {
+		if _, err := suppressions.Add(lead.Email, SuppressUnsubscribed, "admin", ""); err != nil {
+			log.Printf("Failed to suppress %s: %v", lead.Email, err)
+		}
+	}
+	log.Printf("Unsubscribed lead %s from follow-ups", lead.ID)
+	writeJSON(w, http.StatusOK, lead)
+}
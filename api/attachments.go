@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Attachment limits, overridable via environment
+const (
+	defaultMaxAttachments      = 3
+	defaultMaxAttachmentBytes  = 10 << 20 // per file
+	defaultInlineAttachmentMax = 8 << 20  // total forwarded through Postmark
+	defaultAttachmentLinkDays  = 30
+)
+
+// attachmentTypes maps allowed extensions to the content types we accept
+// after sniffing the file's leading bytes. The declared Content-Type from
+// the browser is ignored since it's client-controlled.
+var attachmentTypes = map[string]struct {
+	ContentType string
+	Sniffed     []string
+}{
+	".pdf":  {"application/pdf", []string{"application/pdf"}},
+	".csv":  {"text/csv", []string{"text/plain; charset=utf-8", "text/csv"}},
+	".xlsx": {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", []string{"application/zip"}},
+	".qbo":  {"application/vnd.intu.qbo", []string{"text/plain; charset=utf-8", "text/xml; charset=utf-8"}},
+}
+
+// Attachment errors, mapped to response codes by the contact handler
+var (
+	errTooManyAttachments  = errors.New("too many attachments")
+	errAttachmentTooLarge  = errors.New("attachment too large")
+	errAttachmentForbidden = errors.New("attachment type not allowed")
+)
+
+// Attachment is a file uploaded with a contact submission and stored on disk
+type Attachment struct {
+	ID          string    `json:"id"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// attachmentDir returns the directory attachments are stored under
+func attachmentDir() string {
+	if dir := os.Getenv("ATTACHMENT_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join(dataDir(), "attachments")
+}
+
+// maxAttachments returns the maximum number of files per submission
+func maxAttachments() int {
+	return envInt("ATTACHMENT_MAX_COUNT", defaultMaxAttachments)
+}
+
+// maxAttachmentBytes returns the maximum size of a single file
+func maxAttachmentBytes() int64 {
+	return int64(envInt("ATTACHMENT_MAX_BYTES", defaultMaxAttachmentBytes))
+}
+
+// inlineAttachmentMax returns the total size above which attachments are
+// linked through the admin API instead of attached to the notification
+func inlineAttachmentMax() int64 {
+	return int64(envInt("ATTACHMENT_INLINE_MAX_BYTES", defaultInlineAttachmentMax))
+}
+
+// attachmentLinkTTL returns how long the download links in notifications work
+func attachmentLinkTTL() time.Duration {
+	return time.Duration(envInt("ATTACHMENT_LINK_DAYS", defaultAttachmentLinkDays)) * 24 * time.Hour
+}
+
+// checkAttachments enforces the count, size and type limits on uploaded files
+// before anything is written to disk
+func checkAttachments(files []*multipart.FileHeader) error {
+	if len(files) > maxAttachments() {
+		return errTooManyAttachments
+	}
+	for _, fh := range files {
+		if fh.Size > maxAttachmentBytes() {
+			return fmt.Errorf("%w: %s", errAttachmentTooLarge, fh.Filename)
+		}
+		if _, err := sniffAttachment(fh); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sniffAttachment checks the extension against the allowlist and verifies
+// the file content matches it, returning the canonical content type
+func sniffAttachment(fh *multipart.FileHeader) (string, error) {
+	ext := strings.ToLower(filepath.Ext(fh.Filename))
+	allowed, ok := attachmentTypes[ext]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", errAttachmentForbidden, fh.Filename)
+	}
+
+	f, err := fh.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	sniffed := http.DetectContentType(head[:n])
+	for _, ct := range allowed.Sniffed {
+		if sniffed == ct {
+			return allowed.ContentType, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s (detected %s)", errAttachmentForbidden, fh.Filename, sniffed)
+}
+
+// storeAttachments writes the uploaded files to the attachment directory.
+// Each file is stored under a random ID with a JSON sidecar holding its
+// metadata, so the original filename never touches the filesystem. If any
+// file fails, the ones already written are removed again.
+func storeAttachments(files []*multipart.FileHeader) (stored []Attachment, err error) {
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	dir := attachmentDir()
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create attachment directory: %w", err)
+	}
+
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, att := range stored {
+			if err := deleteAttachment(att.ID); err != nil {
+				log.Printf("Failed to remove attachment %s: %v", att.ID, err)
+			}
+		}
+		stored = nil
+	}()
+	for _, fh := range files {
+		contentType, err := sniffAttachment(fh)
+		if err != nil {
+			return stored, err
+		}
+
+		att := Attachment{
+			ID:          newID(),
+			Filename:    filepath.Base(fh.Filename),
+			ContentType: contentType,
+			Size:        fh.Size,
+			CreatedAt:   time.Now().UTC(),
+		}
+		// Added first so a partly written file is cleaned up too
+		stored = append(stored, att)
+		if err := writeAttachment(dir, att, fh); err != nil {
+			return stored, err
+		}
+	}
+	return stored, nil
+}
+
+// attachmentMeta is an attachment's sidecar: its metadata and, when the
+// file is encrypted, the envelope holding its data key. The filename is
+// encrypted with the same key.
+type attachmentMeta struct {
+	Attachment
+	Envelope *Envelope `json:"envelope,omitempty"`
+}
+
+func writeAttachment(dir string, att Attachment, fh *multipart.FileHeader) error {
+	src, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	data, err := io.ReadAll(io.LimitReader(src, maxAttachmentBytes()+1))
+	if err != nil {
+		return fmt.Errorf("failed to read attachment: %w", err)
+	}
+
+	meta := attachmentMeta{Attachment: att}
+	if keyring != nil {
+		c, env, err := keyring.Seal(att.ID)
+		if err != nil {
+			return err
+		}
+		data, meta.Envelope = c.EncryptBytes(data), env
+		c.Encrypt(&meta.Filename)
+	}
+
+	dst, err := os.OpenFile(filepath.Join(dir, att.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create attachment: %w", err)
+	}
+	if _, err := dst.Write(data); err != nil {
+		dst.Close()
+		return fmt.Errorf("failed to write attachment: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return saveJSON(filepath.Join(dir, att.ID+".json"), meta)
+}
+
+// loadAttachmentMeta reads a stored attachment's sidecar as stored, with
+// the filename still encrypted
+func loadAttachmentMeta(id string) (attachmentMeta, error) {
+	var meta attachmentMeta
+	if !isAttachmentID(id) {
+		return meta, os.ErrNotExist
+	}
+	data, err := os.ReadFile(filepath.Join(attachmentDir(), id+".json"))
+	if err != nil {
+		return meta, err
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return meta, err
+	}
+	return meta, nil
+}
+
+// readAttachment returns the metadata and decrypted contents of a stored
+// attachment
+func readAttachment(id string) (Attachment, []byte, error) {
+	meta, err := loadAttachmentMeta(id)
+	if err != nil {
+		return meta.Attachment, nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(attachmentDir(), id))
+	if err != nil {
+		return meta.Attachment, nil, err
+	}
+	if meta.Envelope == nil {
+		return meta.Attachment, data, nil
+	}
+	c, err := keyring.Open(meta.Envelope, id)
+	if err != nil {
+		return meta.Attachment, nil, err
+	}
+	if err := c.Decrypt(&meta.Filename); err != nil {
+		return meta.Attachment, nil, err
+	}
+	data, err = c.DecryptBytes(data)
+	return meta.Attachment, data, err
+}
+
+// resealAttachment brings a stored attachment under the current key:
+// encrypted files get their data key rewrapped, plaintext ones are
+// encrypted. It reports whether anything was rewritten.
+func resealAttachment(id string) (bool, error) {
+	meta, err := loadAttachmentMeta(id)
+	if err != nil {
+		return false, err
+	}
+	dir := attachmentDir()
+	filenameSealed := meta.Filename == "" || strings.HasPrefix(meta.Filename, encryptedPrefix)
+	switch {
+	case meta.Envelope != nil && meta.Envelope.KeyVersion == keyring.Current() && filenameSealed:
+		return false, nil
+	case meta.Envelope != nil:
+		if meta.Envelope, err = keyring.Rewrap(meta.Envelope, id); err != nil {
+			return false, err
+		}
+		if !filenameSealed {
+			// Sidecars written before filenames were encrypted
+			c, err := keyring.Open(meta.Envelope, id)
+			if err != nil {
+				return false, err
+			}
+			c.Encrypt(&meta.Filename)
+		}
+	default:
+		data, err := os.ReadFile(filepath.Join(dir, id))
+		if err != nil {
+			return false, err
+		}
+		c, env, err := keyring.Seal(id)
+		if err != nil {
+			return false, err
+		}
+		if err := writeFileAtomic(filepath.Join(dir, id), c.EncryptBytes(data)); err != nil {
+			return false, err
+		}
+		c.Encrypt(&meta.Filename)
+		meta.Envelope = env
+	}
+	return true, saveJSON(filepath.Join(dir, id+".json"), meta)
+}
+
+// deleteAttachment removes a stored attachment and its metadata. One
+// already gone is not an error.
+func deleteAttachment(id string) error {
+	if !isAttachmentID(id) {
+		return os.ErrNotExist
+	}
+	dir := attachmentDir()
+	for _, name := range []string{id, id + ".json"} {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// postmarkAttachments reads stored attachments and encodes them for the
+// Postmark API. It returns nil if their total size exceeds the inline limit,
+// in which case the notification links to them instead.
+func postmarkAttachments(atts []Attachment) ([]PostmarkAttachment, error) {
+	var total int64
+	for _, att := range atts {
+		total += att.Size
+	}
+	if total > inlineAttachmentMax() {
+		return nil, nil
+	}
+
+	var out []PostmarkAttachment
+	for _, att := range atts {
+		_, data, err := readAttachment(att.ID)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, PostmarkAttachment{
+			Name:        att.Filename,
+			Content:     base64.StdEncoding.EncodeToString(data),
+			ContentType: att.ContentType,
+		})
+	}
+	return out, nil
+}
+
+// attachmentURL returns the download link for a stored attachment, signed
+// so it works from the notification email without the admin token
+func attachmentURL(id string, now time.Time) string {
+	token := bookingSigner.AttachmentToken(id, now.Add(attachmentLinkTTL()))
+	return publicBaseURL() + "/api/admin/attachments/" + id + "?token=" + url.QueryEscape(token)
+}
+
+// isAttachmentID guards against path traversal through the ID parameter
+func isAttachmentID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+// requireAdminOrAttachmentLink lets a request with a valid signed link from
+// a notification through to the download, and anything else to the admin
+// token check
+func requireAdminOrAttachmentLink(next http.HandlerFunc) http.HandlerFunc {
+	admin := requireAdmin(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			admin(w, r)
+			return
+		}
+		switch err := bookingSigner.VerifyAttachment(r.PathValue("id"), token, time.Now()); {
+		case errors.Is(err, errBookingLinkExpired):
+			http.Error(w, "This download link has expired", http.StatusGone)
+			return
+		case err != nil:
+			log.Printf("Invalid attachment link for %s from IP %s", r.PathValue("id"), clientIP(r))
+			http.Error(w, "Invalid download link", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Cache-Control", "private, no-store")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		next(w, r)
+	}
+}
+
+// handleAdminAttachment serves a stored attachment for download
+func handleAdminAttachment(w http.ResponseWriter, r *http.Request) {
+	att, data, err := readAttachment(r.PathValue("id"))
+	if errors.Is(err, os.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to read attachment %s: %v", r.PathValue("id"), err)
+		http.Error(w, "failed to read attachment", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", att.ContentType)
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": att.Filename})
+	if disposition == "" {
+		disposition = "attachment"
+	}
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, "", att.CreatedAt, bytes.NewReader(data))
+}
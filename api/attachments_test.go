@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// uploadedFiles returns the file headers a multipart upload of the given
+// name → content pairs parses into
+func uploadedFiles(t *testing.T, files ...[2]string) []*multipart.FileHeader {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, f := range files {
+		part, _ := mw.CreateFormFile("attachments", f[0])
+		part.Write([]byte(f[1]))
+	}
+	mw.Close()
+	form, err := multipart.NewReader(&body, mw.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { form.RemoveAll() })
+	return form.File["attachments"]
+}
+
+func TestStoreAttachmentsRemovesFilesOnError(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("ATTACHMENT_DIR", dir)
+
+	files := uploadedFiles(t,
+		[2]string{"statement.pdf", "%PDF-1.7 statement"},
+		[2]string{"setup.exe", "MZ\x90\x00"},
+	)
+	stored, err := storeAttachments(files)
+	if err == nil {
+		t.Fatalf("stored %+v", stored)
+	}
+	if stored != nil {
+		t.Errorf("returned %+v alongside the error", stored)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("left %d files behind", len(entries))
+	}
+}
+
+func TestAttachmentDownload(t *testing.T) {
+	t.Setenv("ATTACHMENT_DIR", t.TempDir())
+	t.Setenv("ADMIN_TOKEN", "admin-secret")
+	bookingSigner = &BookingLinkSigner{secret: []byte("test")}
+
+	stored, err := storeAttachments(uploadedFiles(t, [2]string{`Ana "GG" año 2025.pdf`, "%PDF-1.7 statement"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := stored[0].ID
+	now := time.Now()
+	link, err := url.Parse(attachmentURL(id, now))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := link.Query().Get("token")
+
+	tests := []struct {
+		name       string
+		id         string
+		token      string
+		bearer     string
+		wantStatus int
+	}{
+		{"signed link", id, signed, "", http.StatusOK},
+		{"admin token", id, "", "admin-secret", http.StatusOK},
+		{"no credentials", id, "", "", http.StatusUnauthorized},
+		{"expired link", id, bookingSigner.AttachmentToken(id, now.Add(-time.Minute)), "", http.StatusGone},
+		{"link for another attachment", strings.Repeat("0", 32), signed, "", http.StatusForbidden},
+		{"forged link", id, strings.Split(signed, ".")[0] + ".00", "", http.StatusForbidden},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/admin/attachments/{id}", requireAdminOrAttachmentLink(handleAdminAttachment))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/admin/attachments/"+tt.id+"?token="+url.QueryEscape(tt.token), nil)
+			if tt.bearer != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if w.Code != http.StatusOK {
+				return
+			}
+			if w.Body.String() != "%PDF-1.7 statement" {
+				t.Errorf("body = %q", w.Body)
+			}
+			_, params, err := mime.ParseMediaType(w.Header().Get("Content-Disposition"))
+			if err != nil || params["filename"] != `Ana "GG" año 2025.pdf` {
+				t.Errorf("Content-Disposition = %q (%v)", w.Header().Get("Content-Disposition"), err)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Audited actions
+const (
+	AuditPrivacyRequest = "privacy.request"
+	AuditPrivacyExport  = "privacy.export"
+	AuditPrivacyErase   = "privacy.erase"
+)
+
+// Audit actors
+const (
+	ActorAdmin   = "admin"
+	ActorSubject = "subject" // the person the data is about, via an emailed link
+)
+
+// defaultAuditListLimit caps the admin audit listing
+const defaultAuditListLimit = 100
+
+// AuditEntry is one line of the audit log. The subject is a hash of the
+// email address, so the log itself doesn't undo an erasure but can still
+// show what was done for an address someone asks about.
+type AuditEntry struct {
+	At      time.Time         `json:"at"`
+	Action  string            `json:"action"`
+	Actor   string            `json:"actor"`
+	IP      string            `json:"ip,omitempty"`
+	Subject string            `json:"subject"`
+	Detail  map[string]string `json:"detail,omitempty"`
+}
+
+// AuditLog is an append-only JSON Lines file of privacy actions
+type AuditLog struct {
+	mu   sync.Mutex
+	path string
+}
+
+// audit is the process-wide audit log, opened in main
+var audit *AuditLog
+
+// openAuditLog returns the log in dir, creating dir if needed
+func openAuditLog(dir string) (*AuditLog, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &AuditLog{path: filepath.Join(dir, "audit.log")}, nil
+}
+
+// auditSubject hashes an email address for the audit log
+func auditSubject(email string) string {
+	sum := sha256.Sum256([]byte(normalizeEmail(email)))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Record appends an entry, syncing it to disk before returning
+func (a *AuditLog) Record(action, actor, ip, email string, detail map[string]string) error {
+	line, err := json.Marshal(AuditEntry{
+		At:      time.Now().UTC(),
+		Action:  action,
+		Actor:   actor,
+		IP:      ip,
+		Subject: auditSubject(email),
+		Detail:  detail,
+	})
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	f, err := os.OpenFile(a.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// List returns up to limit entries matching the email (if set) and action
+// (if set), newest first
+func (a *AuditLog) List(email, action string, limit int) ([]AuditEntry, error) {
+	subject := ""
+	if email != "" {
+		subject = auditSubject(email)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	f, err := os.Open(a.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []AuditEntry{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var matched []AuditEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		var e AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		if (subject == "" || e.Subject == subject) && (action == "" || e.Action == action) {
+			matched = append(matched, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	out := make([]AuditEntry, 0, min(len(matched), limit))
+	for i := len(matched) - 1; i >= 0 && len(out) < limit; i-- {
+		out = append(out, matched[i])
+	}
+	return out, nil
+}
+
+// handleAdminListAudit lists audit entries, newest first, filtered by
+// ?email= and ?action= and capped by ?limit=
+func handleAdminListAudit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := defaultAuditListLimit
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "limit must be a positive number"})
+			return
+		}
+		limit = n
+	}
+	entries, err := audit.List(q.Get("email"), q.Get("action"), limit)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
@@ -0,0 +1,751 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Booking statuses
+const (
+	BookingConfirmed = "confirmed"
+	BookingCancelled = "cancelled"
+)
+
+// Booking errors
+var (
+	errBookingNotFound = errors.New("booking not found")
+	errSlotTaken       = errors.New("slot already booked")
+	errSlotUnavailable = errors.New("slot not available")
+	errBookingInactive = errors.New("booking already cancelled")
+)
+
+// Default number of days GET /api/booking/slots covers
+const defaultSlotDays = 14
+
+// BookingConfig is Cade's discovery-call availability. Times are wall-clock
+// times in Timezone.
+type BookingConfig struct {
+	Timezone    string `json:"timezone"`
+	SlotMinutes int    `json:"slotMinutes"`
+	// Weekly maps a lowercase weekday to its open windows, e.g.
+	// "monday": ["09:00-12:00", "13:00-17:00"]. An empty list closes the day.
+	Weekly map[string][]string `json:"weekly"`
+	// Blackouts are closed dates ("2026-12-24") or inclusive ranges
+	// ("2026-12-24/2026-12-31")
+	Blackouts      []string `json:"blackouts"`
+	MinNoticeHours int      `json:"minNoticeHours"`
+	HorizonDays    int      `json:"horizonDays"`
+
+	loc       *time.Location
+	windows   map[time.Weekday][][2]int // minutes after midnight
+	blackouts [][2]string               // inclusive YYYY-MM-DD ranges
+}
+
+// defaultBookingConfig is weekday business hours with a lunch break
+func defaultBookingConfig() *BookingConfig {
+	hours := []string{"09:00-12:00", "13:00-17:00"}
+	return &BookingConfig{
+		Timezone:    "America/Los_Angeles",
+		SlotMinutes: 30,
+		Weekly: map[string][]string{
+			"monday":    hours,
+			"tuesday":   hours,
+			"wednesday": hours,
+			"thursday":  hours,
+			"friday":    hours,
+		},
+		MinNoticeHours: 24,
+		HorizonDays:    30,
+	}
+}
+
+// bookingConfig is the process-wide availability, loaded in main
+var bookingConfig *BookingConfig
+
+// loadBookingConfig reads BOOKING_CONFIG_FILE (JSON in the BookingConfig
+// shape) if set. Settings and weekdays missing from the file keep their
+// defaults.
+func loadBookingConfig() (*BookingConfig, error) {
+	c := defaultBookingConfig()
+	if path := os.Getenv("BOOKING_CONFIG_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, c); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	}
+	if err := c.compile(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// compile validates the config and parses its windows and blackouts
+func (c *BookingConfig) compile() error {
+	var err error
+	if c.loc, err = time.LoadLocation(c.Timezone); err != nil {
+		return fmt.Errorf("booking timezone: %w", err)
+	}
+	if c.SlotMinutes < 5 {
+		return fmt.Errorf("booking slotMinutes must be at least 5, got %d", c.SlotMinutes)
+	}
+
+	days := map[string]time.Weekday{}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		days[strings.ToLower(d.String())] = d
+	}
+	c.windows = make(map[time.Weekday][][2]int)
+	for name, windows := range c.Weekly {
+		day, ok := days[strings.ToLower(name)]
+		if !ok {
+			return fmt.Errorf("booking weekly: unknown day %q", name)
+		}
+		for _, w := range windows {
+			from, to, ok := strings.Cut(w, "-")
+			start, err1 := parseClock(from)
+			end, err2 := parseClock(to)
+			if !ok || err1 != nil || err2 != nil || end <= start {
+				return fmt.Errorf("booking weekly %s: invalid window %q", name, w)
+			}
+			c.windows[day] = append(c.windows[day], [2]int{start, end})
+		}
+	}
+
+	c.blackouts = nil
+	for _, b := range c.Blackouts {
+		from, to, ok := strings.Cut(b, "/")
+		if !ok {
+			to = from
+		}
+		_, err1 := time.Parse(time.DateOnly, from)
+		_, err2 := time.Parse(time.DateOnly, to)
+		if err1 != nil || err2 != nil || to < from {
+			return fmt.Errorf("booking blackouts: invalid date %q", b)
+		}
+		c.blackouts = append(c.blackouts, [2]string{from, to})
+	}
+	return nil
+}
+
+// parseClock parses "HH:MM" into minutes after midnight
+func parseClock(s string) (int, error) {
+	h, m, ok := strings.Cut(strings.TrimSpace(s), ":")
+	hours, err1 := strconv.Atoi(h)
+	minutes, err2 := strconv.Atoi(m)
+	if !ok || err1 != nil || err2 != nil || hours < 0 || hours > 24 || minutes < 0 || minutes > 59 || hours*60+minutes > 24*60 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return hours*60 + minutes, nil
+}
+
+// SlotLength is the duration of one discovery call
+func (c *BookingConfig) SlotLength() time.Duration {
+	return time.Duration(c.SlotMinutes) * time.Minute
+}
+
+// blackedOut reports whether the day (midnight in c.loc) is closed
+func (c *BookingConfig) blackedOut(day time.Time) bool {
+	date := day.Format(time.DateOnly)
+	for _, b := range c.blackouts {
+		if date >= b[0] && date <= b[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// Slots returns the start of every slot in [from, to) that the weekly
+// availability allows, respecting blackouts, minimum notice and the booking
+// horizon. It ignores existing bookings.
+func (c *BookingConfig) Slots(from, to, now time.Time) []time.Time {
+	earliest := now.Add(time.Duration(c.MinNoticeHours) * time.Hour)
+	if c.HorizonDays > 0 {
+		if latest := now.AddDate(0, 0, c.HorizonDays); to.After(latest) {
+			to = latest
+		}
+	}
+
+	var out []time.Time
+	d := from.In(c.loc)
+	for day := time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, c.loc); day.Before(to); day = day.AddDate(0, 0, 1) {
+		if c.blackedOut(day) {
+			continue
+		}
+		for _, w := range c.windows[day.Weekday()] {
+			for m := w[0]; m+c.SlotMinutes <= w[1]; m += c.SlotMinutes {
+				start := time.Date(day.Year(), day.Month(), day.Day(), m/60, m%60, 0, 0, c.loc)
+				if start.Before(earliest) || start.Before(from) || !start.Before(to) {
+					continue
+				}
+				out = append(out, start)
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Before(out[j]) })
+	return out
+}
+
+// IsSlot reports whether start is a bookable slot boundary at now
+func (c *BookingConfig) IsSlot(start, now time.Time) bool {
+	for _, s := range c.Slots(start, start.Add(time.Minute), now) {
+		if s.Equal(start) {
+			return true
+		}
+	}
+	return false
+}
+
+// Booking is a reserved discovery call
+type Booking struct {
+	ID          string    `json:"id"`
+	LeadID      string    `json:"leadId,omitempty"`
+	Status      string    `json:"status"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	FirstName   string    `json:"firstName"`
+	LastName    string    `json:"lastName,omitempty"`
+	Email       string    `json:"email"`
+	PhoneNumber string    `json:"phoneNumber,omitempty"`
+	Timezone    string    `json:"timezone"` // the visitor's, for their emails
+	Locale      string    `json:"locale"`
+	Sequence    int       `json:"sequence"`             // iCalendar SEQUENCE, bumped on each change
+	EmailIndex  string    `json:"emailIndex,omitempty"` // blind index, see Lead
+	Envelope    *Envelope `json:"envelope,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// visitorLocation returns the booking's timezone, falling back to UTC
+func (b *Booking) visitorLocation() *time.Location {
+	if loc, err := time.LoadLocation(b.Timezone); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// BookingStore keeps bookings in memory and persists them to a JSON file.
+// Reservations are checked and claimed under one lock, so concurrent
+// requests can't double-book a slot.
+type BookingStore struct {
+	mu       sync.RWMutex
+	path     string
+	config   *BookingConfig
+	bookings map[string]*Booking
+}
+
+// bookings is the process-wide booking store, opened in main
+var bookings *BookingStore
+
+// openBookingStore loads the booking store from dir, creating it if needed
+func openBookingStore(dir string, config *BookingConfig) (*BookingStore, error) {
+	s := &BookingStore{
+		path:     filepath.Join(dir, "bookings.json"),
+		config:   config,
+		bookings: make(map[string]*Booking),
+	}
+	var list []*Booking
+	if err := loadJSON(s.path, &list); err != nil {
+		return nil, err
+	}
+	for _, b := range list {
+		if err := openBooking(b); err != nil {
+			return nil, err
+		}
+		s.bookings[b.ID] = b
+	}
+	return s, nil
+}
+
+// Reserve claims b's slot and stores it. It fails with errSlotUnavailable if
+// the availability doesn't offer the slot, or errSlotTaken if a confirmed
+// booking overlaps it.
+func (s *BookingStore) Reserve(b *Booking, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.config.IsSlot(b.Start, now) {
+		return errSlotUnavailable
+	}
+	if s.overlapsLocked(b.Start, b.End, "") {
+		return errSlotTaken
+	}
+	s.bookings[b.ID] = b
+	if err := s.save(); err != nil {
+		delete(s.bookings, b.ID)
+		return err
+	}
+	return nil
+}
+
+// Cancel marks a confirmed booking cancelled, releasing its slot
+func (s *BookingStore) Cancel(id string) (*Booking, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.updateLocked(id, func(b *Booking) error {
+		b.Status = BookingCancelled
+		return nil
+	})
+}
+
+// Reschedule moves a confirmed booking to start. The new slot is claimed and
+// the old one released in the same step, so neither can be lost to a
+// concurrent booking.
+func (s *BookingStore) Reschedule(id string, start, now time.Time) (*Booking, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.updateLocked(id, func(b *Booking) error {
+		end := start.Add(s.config.SlotLength())
+		if !s.config.IsSlot(start, now) {
+			return errSlotUnavailable
+		}
+		if s.overlapsLocked(start, end, b.ID) {
+			return errSlotTaken
+		}
+		b.Start, b.End = start.UTC(), end.UTC()
+		return nil
+	})
+}
+
+// updateLocked applies fn to a confirmed booking, bumps its sequence and
+// persists the store. Callers must hold the write lock.
+func (s *BookingStore) updateLocked(id string, fn func(*Booking) error) (*Booking, error) {
+	b, ok := s.bookings[id]
+	if !ok {
+		return nil, errBookingNotFound
+	}
+	if b.Status != BookingConfirmed {
+		return nil, errBookingInactive
+	}
+	cp := *b
+	if err := fn(&cp); err != nil {
+		return nil, err
+	}
+	cp.Sequence++
+	cp.UpdatedAt = time.Now().UTC()
+	s.bookings[id] = &cp
+	if err := s.save(); err != nil {
+		s.bookings[id] = b
+		return nil, err
+	}
+	out := cp
+	return &out, nil
+}
+
+// Anonymize strips the visitor's details from a booking, cancelling it if
+// it's still upcoming
+func (s *BookingStore) Anonymize(id string, now time.Time) (*Booking, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, ok := s.bookings[id]
+	if !ok {
+		return nil, errBookingNotFound
+	}
+	cp := *b
+	cp.FirstName, cp.LastName, cp.Email, cp.PhoneNumber = "", "", "", ""
+	if cp.Status == BookingConfirmed && cp.Start.After(now) {
+		cp.Status = BookingCancelled
+		cp.Sequence++
+	}
+	cp.UpdatedAt = now.UTC()
+	s.bookings[id] = &cp
+	if err := s.save(); err != nil {
+		s.bookings[id] = b
+		return nil, err
+	}
+	out := cp
+	return &out, nil
+}
+
+// Delete removes a booking, releasing its slot
+func (s *BookingStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.bookings[id]; !ok {
+		return errBookingNotFound
+	}
+	delete(s.bookings, id)
+	return s.save()
+}
+
+// overlapsLocked reports whether a confirmed booking other than skipID
+// overlaps [start, end). Callers must hold the lock.
+func (s *BookingStore) overlapsLocked(start, end time.Time, skipID string) bool {
+	for _, b := range s.bookings {
+		if b.ID != skipID && b.Status == BookingConfirmed && b.Start.Before(end) && start.Before(b.End) {
+			return true
+		}
+	}
+	return false
+}
+
+// Available returns the open slots in [from, to)
+func (s *BookingStore) Available(from, to, now time.Time) []time.Time {
+	slots := s.config.Slots(from, to, now)
+	length := s.config.SlotLength()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := slots[:0]
+	for _, start := range slots {
+		if !s.overlapsLocked(start, start.Add(length), "") {
+			out = append(out, start)
+		}
+	}
+	return out
+}
+
+// Get returns a copy of the booking with the given ID
+func (s *BookingStore) Get(id string) (*Booking, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.bookings[id]
+	if !ok {
+		return nil, errBookingNotFound
+	}
+	cp := *b
+	return &cp, nil
+}
+
+// List returns the bookings matching filter, soonest first. A nil filter
+// matches every booking.
+func (s *BookingStore) List(filter func(*Booking) bool) []*Booking {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []*Booking
+	for _, b := range s.bookings {
+		if filter == nil || filter(b) {
+			cp := *b
+			out = append(out, &cp)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Start.Before(out[j].Start)
+	})
+	return out
+}
+
+// Reseal rewrites the store, encrypting every booking under the current
+// key, and returns how many were written
+func (s *BookingStore) Reseal() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.bookings), s.save()
+}
+
+// save writes the store to disk, with each booking's PII encrypted when
+// keys are configured. Callers must hold the write lock.
+func (s *BookingStore) save() error {
+	list := make([]*Booking, 0, len(s.bookings))
+	for _, b := range s.bookings {
+		b.EmailIndex = blindIndex(IndexEmail, b.Email, normalizeEmail)
+		sealed, err := sealBooking(b)
+		if err != nil {
+			return err
+		}
+		list = append(list, sealed)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return saveJSON(s.path, list)
+}
+
+// BookingSlot is an open slot in the visitor's timezone
+type BookingSlot struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// BookingResponse is the response from the public booking endpoints
+type BookingResponse struct {
+	Success     bool          `json:"success"`
+	Message     string        `json:"message,omitempty"`
+	Error       string        `json:"error,omitempty"`
+	Code        string        `json:"code,omitempty"`
+	Timezone    string        `json:"timezone,omitempty"`
+	SlotMinutes int           `json:"slotMinutes,omitempty"`
+	Slots       []BookingSlot `json:"slots,omitempty"`
+	Booking     *BookingView  `json:"booking,omitempty"`
+}
+
+// BookingView is the part of a booking shown to the visitor
+type BookingView struct {
+	ID       string `json:"id"`
+	Status   string `json:"status"`
+	Start    string `json:"start"`
+	End      string `json:"end"`
+	Timezone string `json:"timezone"`
+}
+
+// view returns the booking as shown to the visitor, in their timezone
+func (b *Booking) view() *BookingView {
+	loc := b.visitorLocation()
+	return &BookingView{
+		ID:       b.ID,
+		Status:   b.Status,
+		Start:    b.Start.In(loc).Format(time.RFC3339),
+		End:      b.End.In(loc).Format(time.RFC3339),
+		Timezone: loc.String(),
+	}
+}
+
+// writeBookingError writes a localized booking API error
+func writeBookingError(w http.ResponseWriter, locale string, status int, code string) {
+	writeJSON(w, status, BookingResponse{Code: code, Error: translate(locale, code)})
+}
+
+// handleBookingSlots lists open discovery-call slots. ?tz= is the visitor's
+// IANA timezone (default the business's), ?from= a YYYY-MM-DD date in that
+// timezone (default today) and ?days= how many days to cover.
+func handleBookingSlots(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	locale := negotiateLocale(q.Get("locale"), r.Header.Get("Accept-Language"))
+
+	loc := bookingConfig.loc
+	if tz := q.Get("tz"); tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			writeBookingError(w, locale, http.StatusBadRequest, "booking_invalid_timezone")
+			return
+		}
+	}
+
+	now := time.Now()
+	y, m, d := now.In(loc).Date()
+	from := time.Date(y, m, d, 0, 0, 0, 0, loc)
+	if v := q.Get("from"); v != "" {
+		t, err := time.ParseInLocation(time.DateOnly, v, loc)
+		if err != nil {
+			writeBookingError(w, locale, http.StatusBadRequest, "booking_invalid_time")
+			return
+		}
+		from = t
+	}
+	days := defaultSlotDays
+	if v := q.Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 90 {
+			writeBookingError(w, locale, http.StatusBadRequest, "booking_invalid_time")
+			return
+		}
+		days = n
+	}
+
+	slots := []BookingSlot{}
+	length := bookingConfig.SlotLength()
+	for _, start := range bookings.Available(from, from.AddDate(0, 0, days), now) {
+		slots = append(slots, BookingSlot{
+			Start: start.In(loc).Format(time.RFC3339),
+			End:   start.Add(length).In(loc).Format(time.RFC3339),
+		})
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, BookingResponse{
+		Success:     true,
+		Timezone:    loc.String(),
+		SlotMinutes: bookingConfig.SlotMinutes,
+		Slots:       slots,
+	})
+}
+
+// BookingRequest is the body of POST /api/booking. A booking is only
+// attached to an existing lead through LeadID and the signed LeadToken from
+// a follow-up email link, or the booking cookie set after the contact form;
+// without one the contact fields are required and the booking stands alone.
+type BookingRequest struct {
+	LeadID      string `json:"leadId"`
+	LeadToken   string `json:"leadToken"`
+	FirstName   string `json:"firstName"`
+	LastName    string `json:"lastName"`
+	Email       string `json:"email"`
+	PhoneNumber string `json:"phoneNumber"`
+	Start       string `json:"start"` // RFC 3339
+	Timezone    string `json:"timezone"`
+	Locale      string `json:"locale"`
+	FormGuard
+}
+
+func (req *BookingRequest) readValues(values url.Values) {
+	req.LeadID = values.Get("leadId")
+	req.LeadToken = values.Get("leadToken")
+	req.FirstName = values.Get("firstName")
+	req.LastName = values.Get("lastName")
+	req.Email = values.Get("email")
+	req.PhoneNumber = values.Get("phoneNumber")
+	req.Start = values.Get("start")
+	req.Timezone = values.Get("timezone")
+	req.Locale = values.Get("locale")
+	req.FormGuard.readValues(values)
+}
+
+// handleCreateBooking reserves a discovery-call slot and emails the invite
+// to the visitor and the business. Bookings go through the contact form's
+// spam pipeline minus the CAPTCHA, which the slot picker doesn't show; a
+// valid lead link also stands in for the form token.
+func handleCreateBooking(w http.ResponseWriter, r *http.Request) {
+	locale := negotiateLocale("", r.Header.Get("Accept-Language"))
+	var req BookingRequest
+	if err := decodeForm(w, r, &req, true); err != nil {
+		status, code, _ := decodeErrorCode(err)
+		writeBookingError(w, locale, status, code)
+		return
+	}
+	locale = negotiateLocale(req.Locale, r.Header.Get("Accept-Language"))
+
+	if req.LeadID == "" {
+		req.LeadID, req.LeadToken = leadBookingFromCookie(r)
+	}
+	var lead *Lead
+	pipeline := spamPipeline.Without("captcha")
+	if req.LeadID != "" {
+		if bookingSigner.VerifyLead(req.LeadID, req.LeadToken, time.Now()) != nil {
+			writeBookingError(w, locale, http.StatusForbidden, "booking_lead_not_found")
+			return
+		}
+		l, err := leads.Get(req.LeadID)
+		if err != nil {
+			writeBookingError(w, locale, http.StatusBadRequest, "booking_lead_not_found")
+			return
+		}
+		lead = l
+		pipeline = pipeline.Without("form-token")
+	}
+
+	remoteIP := clientIP(r)
+	verdict, err := pipeline.Evaluate(r.Context(), &Submission{
+		Form: &ContactForm{
+			FirstName: req.FirstName,
+			LastName:  req.LastName,
+			Email:     req.Email,
+			Locale:    locale,
+			FormGuard: req.FormGuard,
+		},
+		Request:  r,
+		RemoteIP: remoteIP,
+		Now:      time.Now(),
+	})
+	if err != nil {
+		log.Printf("Spam check error: %v", err)
+		writeBookingError(w, locale, http.StatusInternalServerError, "send_failed")
+		return
+	}
+	if verdict.Decision != SpamAccept {
+		log.Printf("Rejected booking from IP %s (%s): %v", remoteIP, verdict.Decision, verdict.Reasons())
+		writeBookingError(w, locale, http.StatusBadRequest, cmp.Or(verdict.RejectCode(), "booking_rejected"))
+		return
+	}
+
+	b, status, code := newBooking(&req, lead, locale)
+	if code != "" {
+		writeBookingError(w, locale, status, code)
+		return
+	}
+
+	if err := bookings.Reserve(b, time.Now()); err != nil {
+		switch {
+		case errors.Is(err, errSlotTaken):
+			writeBookingError(w, locale, http.StatusConflict, "booking_slot_taken")
+		case errors.Is(err, errSlotUnavailable):
+			writeBookingError(w, locale, http.StatusBadRequest, "booking_slot_unavailable")
+		default:
+			log.Printf("Failed to store booking: %v", err)
+			writeBookingError(w, locale, http.StatusInternalServerError, "send_failed")
+		}
+		return
+	}
+	log.Printf("Booked discovery call %s at %s for %s <%s> (lead %s)",
+		b.ID, b.Start.Format(time.RFC3339), b.FirstName, b.Email, orDash(b.LeadID))
+
+	scheduler.ScheduleBooking(b)
+
+	// The slot is held either way; a failed email only needs a manual follow-up
+	if err := sendBookingEmails(b, bookingNoticeBooked); err != nil {
+		log.Printf("Failed to send booking emails for %s: %v", b.ID, err)
+	}
+
+	writeJSON(w, http.StatusCreated, BookingResponse{
+		Success: true,
+		Message: translate(locale, "booking_confirmed"),
+		Booking: b.view(),
+	})
+}
+
+// newBooking validates a booking request and builds the booking, filling
+// missing contact details from the verified lead, if any. On failure it
+// returns the response status and error code.
+func newBooking(req *BookingRequest, lead *Lead, locale string) (*Booking, int, string) {
+	start, err := time.Parse(time.RFC3339, strings.TrimSpace(req.Start))
+	if err != nil {
+		return nil, http.StatusBadRequest, "booking_invalid_time"
+	}
+	tz := req.Timezone
+	if tz == "" {
+		tz = bookingConfig.Timezone
+	}
+	if _, err := time.LoadLocation(tz); err != nil {
+		return nil, http.StatusBadRequest, "booking_invalid_timezone"
+	}
+
+	now := time.Now().UTC()
+	b := &Booking{
+		ID:          newID(),
+		Status:      BookingConfirmed,
+		Start:       start.UTC(),
+		End:         start.UTC().Add(bookingConfig.SlotLength()),
+		FirstName:   strings.TrimSpace(req.FirstName),
+		LastName:    strings.TrimSpace(req.LastName),
+		Email:       strings.TrimSpace(req.Email),
+		PhoneNumber: strings.TrimSpace(req.PhoneNumber),
+		Timezone:    tz,
+		Locale:      locale,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	if lead != nil {
+		b.LeadID = lead.ID
+		if b.FirstName == "" {
+			b.FirstName, b.LastName = lead.FirstName, lead.LastName
+		}
+		if b.Email == "" {
+			b.Email = lead.Email
+		}
+		if b.PhoneNumber == "" {
+			b.PhoneNumber = lead.PhoneNumber
+		}
+	}
+
+	switch {
+	case b.FirstName == "":
+		return nil, http.StatusBadRequest, "first_name_required"
+	case !namePattern.MatchString(b.FirstName) || len(b.FirstName) > 50:
+		return nil, http.StatusBadRequest, "first_name_invalid"
+	case b.Email == "":
+		return nil, http.StatusBadRequest, "email_required"
+	case len(b.Email) > 254 || !emailPattern.MatchString(b.Email):
+		return nil, http.StatusBadRequest, "email_invalid"
+	}
+	return b, 0, ""
+}
+
+// handleAdminListBookings lists bookings soonest first, optionally filtered
+// by ?status=
+func handleAdminListBookings(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	list := bookings.List(func(b *Booking) bool {
+		return status == "" || b.Status == status
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"bookings": list})
+}
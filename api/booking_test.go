@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testBookingStore returns an empty store offering 30-minute slots from
+// 09:00 to 17:00 UTC every day, bookable right up to their start
+func testBookingStore(t *testing.T) *BookingStore {
+	t.Helper()
+	config := &BookingConfig{Timezone: "UTC", SlotMinutes: 30, Weekly: map[string][]string{}}
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		config.Weekly[strings.ToLower(d.String())] = []string{"09:00-17:00"}
+	}
+	if err := config.compile(); err != nil {
+		t.Fatal(err)
+	}
+	store, err := openBookingStore(t.TempDir(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// testBooking returns a confirmed booking for the slot at start
+func testBooking(start time.Time) *Booking {
+	return &Booking{
+		ID:        newID(),
+		Status:    BookingConfirmed,
+		Start:     start,
+		End:       start.Add(30 * time.Minute),
+		FirstName: "Ana",
+		Email:     "ana@example.com",
+	}
+}
+
+func TestBookingReservations(t *testing.T) {
+	now := time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)
+	ten, tenThirty := now.Add(2*time.Hour), now.Add(150*time.Minute)
+
+	tests := []struct {
+		name string
+		// run makes the bookings leading up to the step under test and
+		// returns its error
+		run     func(s *BookingStore) error
+		wantErr error
+	}{
+		{"free slot", func(s *BookingStore) error {
+			return s.Reserve(testBooking(ten), now)
+		}, nil},
+		{"same slot twice", func(s *BookingStore) error {
+			s.Reserve(testBooking(ten), now)
+			return s.Reserve(testBooking(ten), now)
+		}, errSlotTaken},
+		{"next slot", func(s *BookingStore) error {
+			s.Reserve(testBooking(ten), now)
+			return s.Reserve(testBooking(tenThirty), now)
+		}, nil},
+		{"off the slot grid", func(s *BookingStore) error {
+			return s.Reserve(testBooking(ten.Add(10*time.Minute)), now)
+		}, errSlotUnavailable},
+		{"outside opening hours", func(s *BookingStore) error {
+			return s.Reserve(testBooking(now.Add(12*time.Hour)), now)
+		}, errSlotUnavailable},
+		{"already started", func(s *BookingStore) error {
+			return s.Reserve(testBooking(ten), ten.Add(time.Minute))
+		}, errSlotUnavailable},
+		{"slot of a cancelled booking", func(s *BookingStore) error {
+			b := testBooking(ten)
+			s.Reserve(b, now)
+			s.Cancel(b.ID)
+			return s.Reserve(testBooking(ten), now)
+		}, nil},
+		{"reschedule into a taken slot", func(s *BookingStore) error {
+			b := testBooking(ten)
+			s.Reserve(b, now)
+			s.Reserve(testBooking(tenThirty), now)
+			_, err := s.Reschedule(b.ID, tenThirty, now)
+			return err
+		}, errSlotTaken},
+		{"slot freed by a reschedule", func(s *BookingStore) error {
+			b := testBooking(ten)
+			s.Reserve(b, now)
+			s.Reschedule(b.ID, tenThirty, now)
+			return s.Reserve(testBooking(ten), now)
+		}, nil},
+		{"reschedule a cancelled booking", func(s *BookingStore) error {
+			b := testBooking(ten)
+			s.Reserve(b, now)
+			s.Cancel(b.ID)
+			_, err := s.Reschedule(b.ID, tenThirty, now)
+			return err
+		}, errBookingInactive},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.run(testBookingStore(t)); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBookingConcurrentReservations(t *testing.T) {
+	store := testBookingStore(t)
+	now := time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)
+	start := now.Add(2 * time.Hour)
+
+	const attempts = 20
+	errs := make(chan error, attempts)
+	var wg sync.WaitGroup
+	for range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- store.Reserve(testBooking(start), now)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	reserved := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			reserved++
+		case !errors.Is(err, errSlotTaken):
+			t.Errorf("unexpected error %v", err)
+		}
+	}
+	if reserved != 1 {
+		t.Fatalf("%d reservations succeeded for one slot", reserved)
+	}
+	if open := store.Available(start, start.Add(time.Hour), now); len(open) != 1 || !open[0].Equal(start.Add(30*time.Minute)) {
+		t.Errorf("available = %v, want only the next slot", open)
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/mail"
+	"os"
+	"strings"
+	"time"
+)
+
+// businessEmail is the address visitors write to, as shown in every email
+const businessEmail = "cade@momentumbusiness.org"
+
+// icsTime formats a time as an iCalendar UTC DATE-TIME
+func icsTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// bookingICS returns the iCalendar (RFC 5545) object for a booking. method
+// is the iTIP method, e.g. REQUEST for a new or changed invite. The UID is
+// stable and SEQUENCE increases with each change, so calendar clients update
+// the one event.
+func bookingICS(b *Booking, method, organizer string) []byte {
+	var ics strings.Builder
+	line := func(s string) {
+		ics.WriteString(foldLine(s))
+	}
+	tr := func(key string, args ...any) string {
+		return translate(b.Locale, key, args...)
+	}
+
+	status := "CONFIRMED"
+	if b.Status == BookingCancelled {
+		status = "CANCELLED"
+	}
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//Momentum Business Solutions//Discovery Calls//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:" + method)
+	line("BEGIN:VEVENT")
+	line("UID:" + b.ID + "@momentumbusiness.org")
+	line("DTSTAMP:" + icsTime(b.UpdatedAt))
+	line("DTSTART:" + icsTime(b.Start))
+	line("DTEND:" + icsTime(b.End))
+	line(fmt.Sprintf("SEQUENCE:%d", b.Sequence))
+	line("STATUS:" + status)
+	line("SUMMARY:" + vcardEscape(tr("booking.summary")))
+	line("DESCRIPTION:" + vcardEscape(tr("booking.description")))
+	line("ORGANIZER;CN=Momentum Business Solutions:mailto:" + organizer)
+	line(fmt.Sprintf("ATTENDEE;CN=%q;ROLE=REQ-PARTICIPANT;PARTSTAT=ACCEPTED;RSVP=FALSE:mailto:%s",
+		strings.TrimSpace(b.FirstName+" "+b.LastName), b.Email))
+	line("END:VEVENT")
+	line("END:VCALENDAR")
+	return []byte(ics.String())
+}
+
+// Booking notices, each with its own subject and wording
+const (
+	bookingNoticeBooked      = "booked"
+	bookingNoticeRescheduled = "rescheduled"
+	bookingNoticeCancelled   = "cancelled"
+)
+
+// bookingNoticeSuffix selects the i18n key variant for a notice
+var bookingNoticeSuffix = map[string]string{
+	bookingNoticeBooked:      "",
+	bookingNoticeRescheduled: "_rescheduled",
+	bookingNoticeCancelled:   "_cancelled",
+}
+
+// sendBookingEmails sends the invite, update or cancellation to the visitor
+// in their language and timezone, and a copy to the business. Only the
+// visitor's email is required to succeed.
+func sendBookingEmails(b *Booking, notice string) error {
+	token := os.Getenv("POSTMARK_TOKEN")
+	to := os.Getenv("POSTMARK_TO")
+	from := os.Getenv("POSTMARK_FROM")
+	if token == "" || from == "" {
+		return fmt.Errorf("missing email configuration")
+	}
+	organizer := from
+	if addr, err := mail.ParseAddress(from); err == nil {
+		organizer = addr.Address
+	}
+	method := "REQUEST"
+	if notice == bookingNoticeCancelled {
+		method = "CANCEL"
+	}
+	attachment := PostmarkAttachment{
+		Name:        "discovery-call.ics",
+		Content:     base64.StdEncoding.EncodeToString(bookingICS(b, method, organizer)),
+		ContentType: "text/calendar; method=" + method + "; charset=UTF-8",
+	}
+
+	visitor := bookingEmail(b, notice, b.Locale, b.visitorLocation(), from, b.Email, attachment, false)
+	id, err := sendEmail(token, visitor)
+	if err != nil {
+		return err
+	}
+	recordLeadEmail(b.LeadID, EmailBooking, visitor.Subject, id)
+	if to != "" {
+		if _, err := sendEmail(token, bookingEmail(b, notice, businessLocale(), bookingConfig.loc, from, to, attachment, true)); err != nil {
+			return fmt.Errorf("business copy: %w", err)
+		}
+	}
+	return nil
+}
+
+// bookingEmail builds the notice for the visitor, or with business set,
+// the copy for the business
+func bookingEmail(b *Booking, notice, locale string, loc *time.Location, from, to string, ics PostmarkAttachment, business bool) PostmarkEmail {
+	tr := func(key string, args ...any) string {
+		return translate(locale, key, args...)
+	}
+	suffix := bookingNoticeSuffix[notice]
+	when := b.Start.In(loc).Format(tr("booking.time"))
+
+	subject := tr("booking.subject"+suffix, when)
+	greeting := tr("booking.greeting", b.FirstName)
+	intro := tr("booking.intro" + suffix)
+	var details []string
+	if business {
+		subject = tr("booking.notify_subject"+suffix, b.FirstName, b.LastName, when)
+		greeting = tr("booking.notify_heading" + suffix)
+		intro = tr("booking.notify_intro"+suffix, strings.TrimSpace(b.FirstName+" "+b.LastName))
+		details = append(details,
+			tr("notify.email")+": "+b.Email,
+			tr("notify.phone")+": "+orDash(b.PhoneNumber))
+		if b.LeadID != "" {
+			details = append(details, tr("notify.view_lead")+": "+adminLeadURL(b.LeadID))
+		}
+	}
+
+	var detailsHTML strings.Builder
+	for _, d := range details {
+		detailsHTML.WriteString("<p>" + d + "</p>")
+	}
+	detailsText := ""
+	if len(details) > 0 {
+		detailsText = strings.Join(details, "\n") + "\n\n"
+	}
+	changeHTML, changeText, replyTo := "", "", ""
+	if !business {
+		replyTo = leadReplyAddress(b.LeadID)
+	}
+	if !business && notice != bookingNoticeCancelled {
+		cancelURL, rescheduleURL := bookingSigner.URL(b, bookingActionCancel), bookingSigner.URL(b, bookingActionReschedule)
+		changeHTML = fmt.Sprintf(`<p>%s <a href="%s">%s</a> | <a href="%s">%s</a></p>`,
+			tr("booking.change"), rescheduleURL, tr("booking.reschedule"), cancelURL, tr("booking.cancel"))
+		changeText = fmt.Sprintf("%s\n%s: %s\n%s: %s\n\n",
+			tr("booking.change"), tr("booking.reschedule"), rescheduleURL, tr("booking.cancel"), cancelURL)
+	}
+
+	htmlBody := fmt.Sprintf(`<!DOCTYPE html>
+<html lang="%s">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>%s</title>
+    <style>
+        body {
+            font-family: 'Manrope', -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, Oxygen, Ubuntu, Cantarell, sans-serif;
+            line-height: 1.6;
+            color: #374151;
+            max-width: 600px;
+            margin: 0 auto;
+            padding: 20px;
+            background-color: #f8fafc;
+        }
+        .email-container {
+            background: white;
+            border-radius: 12px;
+            padding: 32px;
+            border: 1px solid #e2e8f0;
+        }
+        .company-name {
+            color: #53945c;
+            font-size: 28px;
+            font-weight: 700;
+            margin: 0 0 24px 0;
+            font-family: 'Outfit', sans-serif;
+        }
+        .when {
+            background: #dfe9fa;
+            border-left: 4px solid #4f7ee2;
+            padding: 20px;
+            border-radius: 8px;
+            margin: 24px 0;
+            font-weight: 600;
+            color: #1e3a8a;
+        }
+        .footer {
+            margin-top: 32px;
+            padding-top: 24px;
+            border-top: 2px solid #e5e7eb;
+            text-align: center;
+            color: #64748b;
+            font-size: 13px;
+        }
+    </style>
+</head>
+<body>
+    <div class="email-container">
+        <h1 class="company-name">Momentum Business Solutions</h1>
+        <p><strong>%s</strong></p>
+        <p>%s</p>
+        <div class="when">%s: %s (%s)</div>
+        %s
+        %s
+        <div class="footer">
+            <p><strong>Momentum Business Solutions</strong></p>
+            <p>%s: %s | %s: (509) 554-8022</p>
+        </div>
+    </div>
+</body>
+</html>`,
+		locale,
+		subject,
+		greeting,
+		intro,
+		tr("booking.when"), when, tr("booking.duration", bookingConfig.SlotMinutes),
+		detailsHTML.String(),
+		changeHTML,
+		tr("email.email"), businessEmail, tr("email.phone"),
+	)
+
+	textBody := fmt.Sprintf(`%s
+
+%s
+
+%s: %s (%s)
+
+%s%s---
+Momentum Business Solutions
+%s: %s | %s: (509) 554-8022
+`,
+		greeting,
+		intro,
+		tr("booking.when"), when, tr("booking.duration", bookingConfig.SlotMinutes),
+		detailsText,
+		changeText,
+		tr("email.email"), businessEmail, tr("email.phone"),
+	)
+
+	return PostmarkEmail{
+		From:          from,
+		To:            to,
+		Subject:       subject,
+		TextBody:      textBody,
+		HtmlBody:      htmlBody,
+		MessageStream: "outbound",
+		ReplyTo:       replyTo,
+		Attachments:   []PostmarkAttachment{ics},
+	}
+}
@@ -0,0 +1,465 @@
+package main
+
+import (
+	"cmp"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Self-service booking actions
+const (
+	bookingActionCancel     = "cancel"
+	bookingActionReschedule = "reschedule"
+)
+
+// Lead booking tokens: emailed links last a while, the cookie set after
+// the contact form only for the visit
+const (
+	leadBookingLinkTTL   = 30 * 24 * time.Hour
+	leadBookingCookieTTL = 24 * time.Hour
+	leadBookingCookie    = "booking_lead"
+)
+
+// Booking link errors
+var (
+	errBookingLinkInvalid = errors.New("invalid booking link")
+	errBookingLinkExpired = errors.New("booking link expired")
+)
+
+// BookingLinkSigner signs the cancel and reschedule links in booking emails.
+// A link is bound to the booking, the action and the booking's sequence, so
+// links from an email superseded by a reschedule stop working, and it
+// expires when the call starts. It also signs the lead booking tokens and
+// the attachment download links in notifications.
+type BookingLinkSigner struct {
+	secret []byte
+}
+
+// bookingSigner is the process-wide link signer, built in main
+var bookingSigner *BookingLinkSigner
+
+// newBookingLinkSigner builds the signer from BOOKING_LINK_SECRET. Without
+// it a random key is used, so emailed links stop working on restart.
+func newBookingLinkSigner() *BookingLinkSigner {
+	secret := []byte(os.Getenv("BOOKING_LINK_SECRET"))
+	if len(secret) == 0 {
+		log.Println("BOOKING_LINK_SECRET not set, using a random key (emailed booking links break on restart)")
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	}
+	return &BookingLinkSigner{secret: secret}
+}
+
+// Token returns the signed token for an action on the booking
+func (s *BookingLinkSigner) Token(b *Booking, action string) string {
+	exp := b.Start.Unix()
+	return strconv.FormatInt(exp, 10) + "." + hex.EncodeToString(s.sign(b, action, exp))
+}
+
+// URL returns the absolute link for an action on the booking
+func (s *BookingLinkSigner) URL(b *Booking, action string) string {
+	return publicBaseURL() + "/api/booking/" + b.ID + "/" + action + "?token=" + url.QueryEscape(s.Token(b, action))
+}
+
+// Verify checks a token for an action on the booking at now
+func (s *BookingLinkSigner) Verify(b *Booking, action, token string, now time.Time) error {
+	return verifySignedToken(token, now, func(exp int64) []byte { return s.sign(b, action, exp) })
+}
+
+func (s *BookingLinkSigner) sign(b *Booking, action string, exp int64) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%s|%s|%d|%d", b.ID, action, b.Sequence, exp)
+	return mac.Sum(nil)
+}
+
+// LeadToken returns a token that lets the lead book a call under their
+// inquiry until expires. It's handed out after the contact form and in
+// follow-up emails, so knowing a prospect's email address isn't enough to
+// book in their name.
+func (s *BookingLinkSigner) LeadToken(leadID string, expires time.Time) string {
+	exp := expires.Unix()
+	return strconv.FormatInt(exp, 10) + "." + hex.EncodeToString(s.signLead(leadID, exp))
+}
+
+// VerifyLead checks a lead booking token at now
+func (s *BookingLinkSigner) VerifyLead(leadID, token string, now time.Time) error {
+	return verifySignedToken(token, now, func(exp int64) []byte { return s.signLead(leadID, exp) })
+}
+
+func (s *BookingLinkSigner) signLead(leadID string, exp int64) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "lead|%s|%d", leadID, exp)
+	return mac.Sum(nil)
+}
+
+// AttachmentToken returns a token that lets whoever holds the business's
+// notification email download the attachment until expires, without the
+// admin token
+func (s *BookingLinkSigner) AttachmentToken(id string, expires time.Time) string {
+	exp := expires.Unix()
+	return strconv.FormatInt(exp, 10) + "." + hex.EncodeToString(s.signAttachment(id, exp))
+}
+
+// VerifyAttachment checks an attachment download token at now
+func (s *BookingLinkSigner) VerifyAttachment(id, token string, now time.Time) error {
+	return verifySignedToken(token, now, func(exp int64) []byte { return s.signAttachment(id, exp) })
+}
+
+func (s *BookingLinkSigner) signAttachment(id string, exp int64) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "attachment|%s|%d", id, exp)
+	return mac.Sum(nil)
+}
+
+// verifySignedToken checks an "<expiry>.<hex signature>" token against the
+// signature sign computes for its expiry
+func verifySignedToken(token string, now time.Time, sign func(exp int64) []byte) error {
+	encExp, encSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return errBookingLinkInvalid
+	}
+	exp, err1 := strconv.ParseInt(encExp, 10, 64)
+	sig, err2 := hex.DecodeString(encSig)
+	if err1 != nil || err2 != nil || !hmac.Equal(sig, sign(exp)) {
+		return errBookingLinkInvalid
+	}
+	if !now.Before(time.Unix(exp, 0)) {
+		return errBookingLinkExpired
+	}
+	return nil
+}
+
+// setLeadBookingCookie hands a new lead's booking token to the browser that
+// submitted the contact form. It's HttpOnly and scoped to the booking API,
+// so it never shows up in URLs, history or Referer headers.
+func setLeadBookingCookie(w http.ResponseWriter, leadID string, now time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     leadBookingCookie,
+		Value:    leadID + "." + bookingSigner.LeadToken(leadID, now.Add(leadBookingCookieTTL)),
+		Path:     "/api/booking",
+		MaxAge:   int(leadBookingCookieTTL / time.Second),
+		Secure:   strings.HasPrefix(publicBaseURL(), "https://"),
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// leadBookingFromCookie returns the lead ID and token from the booking
+// cookie, or empty strings
+func leadBookingFromCookie(r *http.Request) (string, string) {
+	c, err := r.Cookie(leadBookingCookie)
+	if err != nil {
+		return "", ""
+	}
+	leadID, token, _ := strings.Cut(c.Value, ".")
+	return leadID, token
+}
+
+// linkPage is the small HTML page emailed booking and unsubscribe links
+// open. GET only shows it, so link scanners that follow URLs can't change
+// anything; the change happens when the visitor submits the form.
+var linkPage = template.Must(template.New("link").Parse(`<!DOCTYPE html>
+<html lang="{{.Locale}}">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <meta name="robots" content="noindex">
+    <title>{{.Title}} - Momentum Business Solutions</title>
+    <style>
+        body { font-family: 'Manrope', -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; line-height: 1.6; color: #374151; max-width: 600px; margin: 0 auto; padding: 40px 20px; background: #f8fafc; }
+        .card { background: white; border-radius: 12px; padding: 32px; border: 1px solid #e2e8f0; }
+        h1 { color: #53945c; font-size: 24px; margin: 0 0 16px 0; }
+        .error { color: #b91c1c; font-weight: 600; }
+        .slots { display: flex; flex-wrap: wrap; gap: 8px; }
+        button { font: inherit; padding: 8px 14px; border-radius: 8px; border: 1px solid #d1d5db; background: white; cursor: pointer; }
+        button.primary { background: #53945c; border-color: #53945c; color: white; font-weight: 600; }
+        h2 { font-size: 16px; margin: 20px 0 8px 0; }
+    </style>
+</head>
+<body>
+    <div class="card">
+        <h1>{{.Title}}</h1>
+        {{with .Error}}<p class="error">{{.}}</p>{{end}}
+        {{with .Message}}<p>{{.}}</p>{{end}}
+        {{if .Confirm}}
+        <form method="post">
+            <input type="hidden" name="token" value="{{.Token}}">
+            <button class="primary" type="submit">{{.Confirm}}</button>
+        </form>
+        {{end}}
+        {{if .Days}}
+        <form method="post">
+            <input type="hidden" name="token" value="{{.Token}}">
+            {{range .Days}}
+            <h2>{{.Label}}</h2>
+            <div class="slots">
+                {{range .Slots}}<button type="submit" name="start" value="{{.Value}}">{{.Label}}</button>{{end}}
+            </div>
+            {{end}}
+        </form>
+        {{end}}
+    </div>
+</body>
+</html>`))
+
+// linkPageData fills linkPage
+type linkPageData struct {
+	Locale  string
+	Title   string
+	Message string
+	Error   string
+	Token   string
+	Confirm string // label of the confirm button, if any
+	Days    []linkPageDay
+}
+
+type linkPageDay struct {
+	Label string
+	Slots []linkPageSlot
+}
+
+type linkPageSlot struct {
+	Value string // RFC 3339 start
+	Label string
+}
+
+// bookingManageRequest is the optional JSON body of a cancel or reschedule POST
+type bookingManageRequest struct {
+	Token string `json:"token"`
+	Start string `json:"start"`
+}
+
+// bookingManager handles one self-service action. Browsers get HTML pages;
+// clients sending Accept: application/json get BookingResponse JSON.
+type bookingManager struct {
+	w       http.ResponseWriter
+	json    bool
+	booking *Booking
+	locale  string
+	token   string
+	start   string
+}
+
+// openBookingManager loads the booking and checks the link's token. It
+// writes the error response itself and returns nil if the link is unusable.
+func openBookingManager(w http.ResponseWriter, r *http.Request, action string) *bookingManager {
+	m := &bookingManager{
+		w:      w,
+		json:   strings.Contains(r.Header.Get("Accept"), "application/json"),
+		locale: negotiateLocale("", r.Header.Get("Accept-Language")),
+		token:  r.URL.Query().Get("token"),
+	}
+	if r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes())
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+			var req bookingManageRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				m.fail(http.StatusBadRequest, "invalid_body")
+				return nil
+			}
+			m.token, m.start = cmp.Or(req.Token, m.token), req.Start
+		} else {
+			m.token, m.start = cmp.Or(r.PostFormValue("token"), m.token), r.PostFormValue("start")
+		}
+	}
+
+	b, err := bookings.Get(r.PathValue("id"))
+	if err != nil {
+		m.fail(http.StatusNotFound, "booking_link_invalid")
+		return nil
+	}
+	m.booking, m.locale = b, b.Locale
+	if b.Status != BookingConfirmed {
+		m.fail(http.StatusGone, "booking_inactive")
+		return nil
+	}
+	switch err := bookingSigner.Verify(b, action, m.token, time.Now()); {
+	case errors.Is(err, errBookingLinkExpired):
+		m.fail(http.StatusGone, "booking_link_expired")
+		return nil
+	case err != nil:
+		log.Printf("Invalid %s link for booking %s from IP %s", action, b.ID, clientIP(r))
+		m.fail(http.StatusForbidden, "booking_link_invalid")
+		return nil
+	}
+	return m
+}
+
+// when formats the booking's start for the visitor
+func (m *bookingManager) when() string {
+	return m.booking.Start.In(m.booking.visitorLocation()).Format(translate(m.locale, "booking.time"))
+}
+
+// fail writes an error page or JSON error
+func (m *bookingManager) fail(status int, code string) {
+	if m.json {
+		writeBookingError(m.w, m.locale, status, code)
+		return
+	}
+	m.page(status, linkPageData{Title: translate(m.locale, "booking.page_title"), Error: translate(m.locale, code)})
+}
+
+// page renders linkPage
+func (m *bookingManager) page(status int, data linkPageData) {
+	data.Locale, data.Token = m.locale, m.token
+	m.w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	m.w.Header().Set("Cache-Control", "no-store")
+	m.w.Header().Set("Referrer-Policy", "no-referrer")
+	m.w.WriteHeader(status)
+	if err := linkPage.Execute(m.w, data); err != nil {
+		log.Printf("Failed to render booking page: %v", err)
+	}
+}
+
+// done reports a completed change
+func (m *bookingManager) done(b *Booking, code string) {
+	m.booking = b
+	message := translate(m.locale, code, m.when())
+	if m.json {
+		writeJSON(m.w, http.StatusOK, BookingResponse{Success: true, Message: message, Booking: b.view()})
+		return
+	}
+	m.page(http.StatusOK, linkPageData{Title: translate(m.locale, "booking.page_title"), Message: message})
+}
+
+// handleBookingCancel shows the cancel confirmation (GET) or cancels the
+// booking (POST), releasing its slot and sending METHOD:CANCEL invites
+func handleBookingCancel(w http.ResponseWriter, r *http.Request) {
+	m := openBookingManager(w, r, bookingActionCancel)
+	if m == nil {
+		return
+	}
+	tr := func(key string, args ...any) string {
+		return translate(m.locale, key, args...)
+	}
+
+	if r.Method == http.MethodGet {
+		if m.json {
+			writeJSON(w, http.StatusOK, BookingResponse{Success: true, Booking: m.booking.view()})
+			return
+		}
+		m.page(http.StatusOK, linkPageData{
+			Title:   tr("booking.page_title"),
+			Message: tr("booking.cancel_prompt", m.when()),
+			Confirm: tr("booking.cancel_confirm"),
+		})
+		return
+	}
+
+	b, err := bookings.Cancel(m.booking.ID)
+	if err != nil {
+		m.storeFailed(err)
+		return
+	}
+	log.Printf("Cancelled discovery call %s for %s <%s>", b.ID, b.FirstName, b.Email)
+	scheduler.CancelBooking(b.ID, "booking cancelled")
+	if err := sendBookingEmails(b, bookingNoticeCancelled); err != nil {
+		log.Printf("Failed to send booking cancellation for %s: %v", b.ID, err)
+	}
+	m.done(b, "booking_cancelled")
+}
+
+// handleBookingReschedule lists open slots (GET) or moves the booking to the
+// chosen one (POST), sending the updated invite
+func handleBookingReschedule(w http.ResponseWriter, r *http.Request) {
+	m := openBookingManager(w, r, bookingActionReschedule)
+	if m == nil {
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		m.slots(http.StatusOK, "")
+		return
+	}
+
+	start, err := time.Parse(time.RFC3339, m.start)
+	if err != nil {
+		m.fail(http.StatusBadRequest, "booking_invalid_time")
+		return
+	}
+	previous := m.when()
+	b, err := bookings.Reschedule(m.booking.ID, start, time.Now())
+	if err != nil {
+		m.storeFailed(err)
+		return
+	}
+	log.Printf("Rescheduled discovery call %s from %s to %s", b.ID, previous, b.Start.Format(time.RFC3339))
+	scheduler.ScheduleBooking(b)
+	if err := sendBookingEmails(b, bookingNoticeRescheduled); err != nil {
+		log.Printf("Failed to send booking update for %s: %v", b.ID, err)
+	}
+	m.done(b, "booking_rescheduled")
+}
+
+// slots renders the open slots to reschedule into, with an optional error
+func (m *bookingManager) slots(status int, code string) {
+	loc := m.booking.visitorLocation()
+	now := time.Now()
+	available := bookings.Available(now, now.AddDate(0, 0, defaultSlotDays), now)
+	if m.json {
+		resp := BookingResponse{Success: code == "", Timezone: loc.String(), SlotMinutes: bookingConfig.SlotMinutes, Booking: m.booking.view()}
+		if code != "" {
+			resp.Code, resp.Error = code, translate(m.locale, code)
+		}
+		for _, start := range available {
+			resp.Slots = append(resp.Slots, BookingSlot{
+				Start: start.In(loc).Format(time.RFC3339),
+				End:   start.Add(bookingConfig.SlotLength()).In(loc).Format(time.RFC3339),
+			})
+		}
+		writeJSON(m.w, status, resp)
+		return
+	}
+
+	data := linkPageData{
+		Title:   translate(m.locale, "booking.page_title"),
+		Message: translate(m.locale, "booking.reschedule_prompt", m.when()),
+	}
+	if code != "" {
+		data.Error = translate(m.locale, code)
+	}
+	dayFormat, timeFormat := translate(m.locale, "booking.day"), translate(m.locale, "booking.clock")
+	for _, start := range available {
+		local := start.In(loc)
+		label := local.Format(dayFormat)
+		if n := len(data.Days); n == 0 || data.Days[n-1].Label != label {
+			data.Days = append(data.Days, linkPageDay{Label: label})
+		}
+		day := &data.Days[len(data.Days)-1]
+		day.Slots = append(day.Slots, linkPageSlot{Value: local.Format(time.RFC3339), Label: local.Format(timeFormat)})
+	}
+	if len(data.Days) == 0 {
+		data.Error = translate(m.locale, "booking_no_slots")
+	}
+	m.page(status, data)
+}
+
+// storeFailed maps a failed cancel or reschedule to a response. A slot
+// taken in the meantime re-offers the remaining slots.
+func (m *bookingManager) storeFailed(err error) {
+	switch {
+	case errors.Is(err, errSlotTaken):
+		m.slots(http.StatusConflict, "booking_slot_taken")
+	case errors.Is(err, errSlotUnavailable):
+		m.slots(http.StatusBadRequest, "booking_slot_unavailable")
+	case errors.Is(err, errBookingInactive):
+		m.fail(http.StatusGone, "booking_inactive")
+	default:
+		log.Printf("Failed to update booking %s: %v", m.booking.ID, err)
+		m.fail(http.StatusInternalServerError, "send_failed")
+	}
+}
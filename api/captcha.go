@@ -0,0 +1,436 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/bits"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Siteverify endpoints for the hosted providers
+const (
+	turnstileVerifyURL = "https://challenges.cloudflare.com/turnstile/v0/siteverify"
+	hcaptchaVerifyURL  = "https://api.hcaptcha.com/siteverify"
+	recaptchaVerifyURL = "https://www.google.com/recaptcha/api/siteverify"
+)
+
+// CaptchaRequest is a token to verify along with request context
+type CaptchaRequest struct {
+	Token    string
+	RemoteIP string
+
+	// IdempotencyKey lets providers that support it (Turnstile) return the
+	// original result when a client retries with an already-redeemed token
+	IdempotencyKey string
+}
+
+// CaptchaResult is the provider-neutral outcome of a CAPTCHA verification.
+// Fields a provider doesn't report are left empty.
+type CaptchaResult struct {
+	Success     bool
+	Score       float64 // reCAPTCHA v3 only; 1.0 is very likely human
+	Action      string
+	CData       string // Turnstile only; customer data set on the widget
+	Hostname    string
+	ChallengeTS time.Time
+	ErrorCodes  []string
+}
+
+// CaptchaVerifier verifies a CAPTCHA response token with its provider
+type CaptchaVerifier interface {
+	// Name identifies the provider in logs and spam signals
+	Name() string
+	// FormField is the form field the provider's widget submits its token in
+	FormField() string
+	Verify(ctx context.Context, req CaptchaRequest) (CaptchaResult, error)
+}
+
+// captchaVerifier is the process-wide verifier, built in main. It is nil
+// when CAPTCHA verification is disabled.
+var captchaVerifier CaptchaVerifier
+
+// newCaptchaVerifier builds the verifier selected by CAPTCHA_PROVIDER
+// (turnstile, hcaptcha, recaptcha, pow or none). Hosted providers are
+// disabled if their secret key isn't set.
+func newCaptchaVerifier() CaptchaVerifier {
+	provider := strings.ToLower(os.Getenv("CAPTCHA_PROVIDER"))
+	if provider == "" {
+		provider = "turnstile"
+	}
+
+	switch provider {
+	case "turnstile":
+		if secret := os.Getenv("TURNSTILE_SECRET_KEY"); secret != "" {
+			return &turnstileVerifier{secret: secret}
+		}
+		warnCaptchaDisabled("TURNSTILE_SECRET_KEY not set")
+	case "hcaptcha":
+		if secret := os.Getenv("HCAPTCHA_SECRET_KEY"); secret != "" {
+			return &hcaptchaVerifier{secret: secret, siteKey: os.Getenv("HCAPTCHA_SITE_KEY")}
+		}
+		warnCaptchaDisabled("HCAPTCHA_SECRET_KEY not set")
+	case "recaptcha":
+		if secret := os.Getenv("RECAPTCHA_SECRET_KEY"); secret != "" {
+			minScore := 0.5
+			if v, err := strconv.ParseFloat(os.Getenv("RECAPTCHA_MIN_SCORE"), 64); err == nil {
+				minScore = v
+			}
+			return &recaptchaVerifier{secret: secret, minScore: minScore}
+		}
+		warnCaptchaDisabled("RECAPTCHA_SECRET_KEY not set")
+	case "pow":
+		return newPowVerifier()
+	case "none":
+		warnCaptchaDisabled("CAPTCHA_PROVIDER=none")
+	default:
+		warnCaptchaDisabled(fmt.Sprintf("unknown CAPTCHA_PROVIDER %q", provider))
+	}
+	return nil
+}
+
+// warnCaptchaDisabled logs prominently that submissions won't be verified,
+// so a missing secret in production doesn't go unnoticed
+func warnCaptchaDisabled(reason string) {
+	log.Println("****************************************************************")
+	log.Printf("WARNING: CAPTCHA verification is DISABLED (%s)", reason)
+	log.Println("WARNING: contact submissions will not be checked for bots")
+	log.Println("****************************************************************")
+}
+
+// siteverifyResponse covers the fields shared by the hosted providers'
+// siteverify responses
+type siteverifyResponse struct {
+	Success     bool     `json:"success"`
+	ErrorCodes  []string `json:"error-codes,omitempty"`
+	ChallengeTS string   `json:"challenge_ts,omitempty"`
+	Hostname    string   `json:"hostname,omitempty"`
+	Action      string   `json:"action,omitempty"`
+	CData       string   `json:"cdata,omitempty"`
+	Score       float64  `json:"score,omitempty"`
+}
+
+// postSiteverify posts a form-encoded siteverify request and decodes the result
+func postSiteverify(ctx context.Context, endpoint string, form url.Values) (CaptchaResult, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return CaptchaResult{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return CaptchaResult{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return CaptchaResult{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return CaptchaResult{}, fmt.Errorf("siteverify returned %d", resp.StatusCode)
+	}
+
+	var raw siteverifyResponse
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return CaptchaResult{}, err
+	}
+
+	result := CaptchaResult{
+		Success:    raw.Success,
+		Score:      raw.Score,
+		Action:     raw.Action,
+		CData:      raw.CData,
+		Hostname:   raw.Hostname,
+		ErrorCodes: raw.ErrorCodes,
+	}
+	if raw.ChallengeTS != "" {
+		result.ChallengeTS, _ = time.Parse(time.RFC3339, raw.ChallengeTS)
+	}
+	return result, nil
+}
+
+// turnstileVerifier verifies Cloudflare Turnstile tokens
+type turnstileVerifier struct {
+	secret string
+}
+
+func (*turnstileVerifier) Name() string      { return "turnstile" }
+func (*turnstileVerifier) FormField() string { return "cf-turnstile-response" }
+
+func (v *turnstileVerifier) Verify(ctx context.Context, req CaptchaRequest) (CaptchaResult, error) {
+	form := url.Values{"secret": {v.secret}, "response": {req.Token}}
+	if req.RemoteIP != "" {
+		form.Set("remoteip", req.RemoteIP)
+	}
+	// Cloudflare only accepts UUIDs here
+	if isUUID(req.IdempotencyKey) {
+		form.Set("idempotency_key", req.IdempotencyKey)
+	}
+	return postSiteverify(ctx, turnstileVerifyURL, form)
+}
+
+// hcaptchaVerifier verifies hCaptcha tokens
+type hcaptchaVerifier struct {
+	secret  string
+	siteKey string
+}
+
+func (*hcaptchaVerifier) Name() string      { return "hcaptcha" }
+func (*hcaptchaVerifier) FormField() string { return "h-captcha-response" }
+
+func (v *hcaptchaVerifier) Verify(ctx context.Context, req CaptchaRequest) (CaptchaResult, error) {
+	form := url.Values{"secret": {v.secret}, "response": {req.Token}}
+	if req.RemoteIP != "" {
+		form.Set("remoteip", req.RemoteIP)
+	}
+	if v.siteKey != "" {
+		form.Set("sitekey", v.siteKey)
+	}
+	return postSiteverify(ctx, hcaptchaVerifyURL, form)
+}
+
+// recaptchaVerifier verifies reCAPTCHA v3 tokens, failing any whose score is
+// below the configured threshold
+type recaptchaVerifier struct {
+	secret   string
+	minScore float64
+}
+
+func (*recaptchaVerifier) Name() string      { return "recaptcha" }
+func (*recaptchaVerifier) FormField() string { return "g-recaptcha-response" }
+
+func (v *recaptchaVerifier) Verify(ctx context.Context, req CaptchaRequest) (CaptchaResult, error) {
+	form := url.Values{"secret": {v.secret}, "response": {req.Token}}
+	if req.RemoteIP != "" {
+		form.Set("remoteip", req.RemoteIP)
+	}
+	result, err := postSiteverify(ctx, recaptchaVerifyURL, form)
+	if err != nil {
+		return result, err
+	}
+	if result.Success && result.Score < v.minScore {
+		result.Success = false
+		result.ErrorCodes = append(result.ErrorCodes, fmt.Sprintf("score %.1f below %.1f", result.Score, v.minScore))
+	}
+	return result, nil
+}
+
+// Proof-of-work defaults
+const (
+	defaultPowDifficulty = 18 // leading zero bits; ~250k hashes on average
+	defaultPowTTL        = 10 * time.Minute
+)
+
+// powVerifier is a self-hosted proof-of-work challenge that needs no outside
+// service. The server issues a signed challenge; the browser must find a
+// nonce such that SHA-256(challenge + nonce) starts with difficulty zero
+// bits, and submits "challenge:nonce" as its token.
+type powVerifier struct {
+	secret     []byte
+	difficulty int
+	ttl        time.Duration
+	redeemed   *nonceStore
+}
+
+func newPowVerifier() *powVerifier {
+	secret := []byte(os.Getenv("POW_SECRET"))
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	}
+	return &powVerifier{
+		secret:     secret,
+		difficulty: envInt("POW_DIFFICULTY", defaultPowDifficulty),
+		ttl:        defaultPowTTL,
+		redeemed:   newNonceStore(defaultMaxNonces),
+	}
+}
+
+func (*powVerifier) Name() string      { return "pow" }
+func (*powVerifier) FormField() string { return "captcha-response" }
+
+// Challenge issues a new signed challenge at the configured difficulty
+func (v *powVerifier) Challenge(now time.Time) string {
+	payload := make([]byte, 8+1+16)
+	binary.BigEndian.PutUint64(payload, uint64(now.UnixMilli()))
+	payload[8] = byte(v.difficulty)
+	rand.Read(payload[9:])
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(v.sign(payload))
+}
+
+func (v *powVerifier) Verify(ctx context.Context, req CaptchaRequest) (CaptchaResult, error) {
+	fail := func(code string) (CaptchaResult, error) {
+		return CaptchaResult{ErrorCodes: []string{code}}, nil
+	}
+
+	challenge, nonce, ok := strings.Cut(req.Token, ":")
+	if !ok || nonce == "" || len(nonce) > 32 {
+		return fail("malformed-token")
+	}
+	encPayload, encSig, ok := strings.Cut(challenge, ".")
+	if !ok {
+		return fail("malformed-token")
+	}
+	enc := base64.RawURLEncoding
+	payload, err := enc.DecodeString(encPayload)
+	if err != nil || len(payload) != 25 {
+		return fail("malformed-token")
+	}
+	sig, err := enc.DecodeString(encSig)
+	if err != nil || !hmac.Equal(sig, v.sign(payload)) {
+		return fail("invalid-signature")
+	}
+
+	now := time.Now()
+	issued := time.UnixMilli(int64(binary.BigEndian.Uint64(payload)))
+	if now.Sub(issued) > v.ttl {
+		return fail("timeout-or-duplicate")
+	}
+
+	sum := sha256.Sum256([]byte(challenge + nonce))
+	if leadingZeroBits(sum[:]) < int(payload[8]) {
+		return fail("insufficient-work")
+	}
+
+	if v.redeemed.Redeem(hex.EncodeToString(payload[9:]), issued.Add(v.ttl), now) != nil {
+		return fail("timeout-or-duplicate")
+	}
+	// The challenge's own TTL bounds its age, so report it as solved now
+	// rather than let CAPTCHA_MAX_AGE cut the TTL short
+	return CaptchaResult{Success: true, ChallengeTS: now}, nil
+}
+
+func (v *powVerifier) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, v.secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// leadingZeroBits counts the zero bits at the start of b
+func leadingZeroBits(b []byte) int {
+	n := 0
+	for _, c := range b {
+		if c != 0 {
+			return n + bits.LeadingZeros8(c)
+		}
+		n += 8
+	}
+	return n
+}
+
+// CaptchaPolicy holds the checks applied to every successful verification.
+// Each check only applies if the provider reported the field it inspects,
+// except CData, which requires the provider's cdata to match whenever set.
+type CaptchaPolicy struct {
+	AllowedHostnames map[string]bool
+	MaxAge           time.Duration
+	Action           string
+	CData            bool // Turnstile only; cdata must be the form token's
+}
+
+// Default maximum age of a solved challenge
+const defaultCaptchaMaxAge = 5 * time.Minute
+
+// newCaptchaPolicy builds the policy from environment config. The hostname
+// allowlist defaults to the hosts in ALLOWED_ORIGINS.
+func newCaptchaPolicy() CaptchaPolicy {
+	hosts := os.Getenv("CAPTCHA_ALLOWED_HOSTNAMES")
+	fromOrigins := hosts == ""
+	if fromOrigins {
+		hosts = os.Getenv("ALLOWED_ORIGINS")
+	}
+
+	policy := CaptchaPolicy{
+		AllowedHostnames: make(map[string]bool),
+		MaxAge:           time.Duration(envInt("CAPTCHA_MAX_AGE_SECONDS", int(defaultCaptchaMaxAge/time.Second))) * time.Second,
+		Action:           os.Getenv("CAPTCHA_ACTION"),
+		CData:            envBool("CAPTCHA_BIND_CDATA", true),
+	}
+	if policy.Action == "" {
+		policy.Action = "contact"
+	}
+	for _, host := range strings.Split(hosts, ",") {
+		host = strings.TrimSpace(host)
+		if fromOrigins {
+			if u, err := url.Parse(host); err == nil {
+				host = u.Hostname()
+			}
+		}
+		if host != "" {
+			policy.AllowedHostnames[strings.ToLower(host)] = true
+		}
+	}
+	return policy
+}
+
+// Check returns the reasons a successful result violates the policy. cdata
+// is the value the server derived from the submission's form token (see
+// FormTokenIssuer.CData); with CData set the result must carry it, so a
+// challenge solved for another form or with no form token fails.
+func (p CaptchaPolicy) Check(result CaptchaResult, cdata string, now time.Time) []string {
+	var problems []string
+	if result.Hostname != "" && len(p.AllowedHostnames) > 0 && !p.AllowedHostnames[strings.ToLower(result.Hostname)] {
+		problems = append(problems, "hostname "+result.Hostname+" not allowed")
+	}
+	if !result.ChallengeTS.IsZero() && p.MaxAge > 0 && now.Sub(result.ChallengeTS) > p.MaxAge {
+		problems = append(problems, fmt.Sprintf("challenge is %s old", now.Sub(result.ChallengeTS).Round(time.Second)))
+	}
+	if result.Action != "" && p.Action != "" && result.Action != p.Action {
+		problems = append(problems, "action "+result.Action+" does not match")
+	}
+	if p.CData && (cdata == "" || result.CData != cdata) {
+		problems = append(problems, "cdata does not match the form token")
+	}
+	return problems
+}
+
+// isUUID reports whether s looks like a canonical UUID
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, c := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// handleCaptchaChallenge issues a proof-of-work challenge
+func handleCaptchaChallenge(w http.ResponseWriter, r *http.Request) {
+	pow, ok := captchaVerifier.(*powVerifier)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]any{
+		"challenge":  pow.Challenge(time.Now()),
+		"difficulty": pow.difficulty,
+	})
+}
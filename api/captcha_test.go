@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// stubVerifier answers every verification with the same result
+type stubVerifier struct{ result CaptchaResult }
+
+func (stubVerifier) Name() string      { return "stub" }
+func (stubVerifier) FormField() string { return "cf-turnstile-response" }
+func (v stubVerifier) Verify(context.Context, CaptchaRequest) (CaptchaResult, error) {
+	return v.result, nil
+}
+
+func TestCaptchaCDataBinding(t *testing.T) {
+	now := time.Now()
+	issuer := testFormTokenIssuer(100)
+	token := issuer.Issue(now.Add(-time.Minute))
+	otherToken := issuer.Issue(now.Add(-time.Minute))
+	if issuer.CData(token) == "" || issuer.CData(token) == issuer.CData(otherToken) {
+		t.Fatalf("cdata %q, other token's %q", issuer.CData(token), issuer.CData(otherToken))
+	}
+
+	tests := []struct {
+		name       string
+		bind       bool
+		formToken  string
+		cdata      string // reported by the provider
+		wantReject bool
+	}{
+		{"cdata of the submitted token", true, token, issuer.CData(token), false},
+		{"cdata of another token", true, token, issuer.CData(otherToken), true},
+		{"client-chosen cdata", true, token, "0123456789abcdef0123456789abcdef", true},
+		{"no cdata on the widget", true, token, "", true},
+		{"no form token", true, "", "", true},
+		{"forged form token", true, "AAAA.AAAA", "", true},
+		{"binding off", false, "", "anything", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := &captchaCheck{
+				verifier: stubVerifier{CaptchaResult{Success: true, CData: tt.cdata}},
+				tokens:   issuer,
+				policy:   CaptchaPolicy{CData: tt.bind},
+			}
+			signal, err := check.Check(context.Background(), &Submission{
+				Form:    &ContactForm{FormGuard: FormGuard{TurnstileResponse: "solved", FormToken: tt.formToken}},
+				Request: httptest.NewRequest("POST", "/api/contact", nil),
+				Now:     now,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if signal.Reject != tt.wantReject {
+				t.Errorf("reject = %v, want %v (%s)", signal.Reject, tt.wantReject, signal.Reason)
+			}
+		})
+	}
+}
+
+func TestCaptchaPolicyCheck(t *testing.T) {
+	now := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	policy := CaptchaPolicy{
+		AllowedHostnames: map[string]bool{"www.momentumbusiness.org": true},
+		MaxAge:           5 * time.Minute,
+		Action:           "contact",
+	}
+	tests := []struct {
+		name         string
+		result       CaptchaResult
+		wantProblems int
+	}{
+		{"all fields match", CaptchaResult{Hostname: "WWW.momentumbusiness.org", Action: "contact", ChallengeTS: now.Add(-time.Minute)}, 0},
+		{"fields not reported", CaptchaResult{}, 0},
+		{"other hostname", CaptchaResult{Hostname: "evil.example"}, 1},
+		{"stale challenge", CaptchaResult{ChallengeTS: now.Add(-time.Hour)}, 1},
+		{"other action", CaptchaResult{Action: "login"}, 1},
+		{"everything wrong", CaptchaResult{Hostname: "evil.example", Action: "login", ChallengeTS: now.Add(-time.Hour)}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if problems := policy.Check(tt.result, "", now); len(problems) != tt.wantProblems {
+				t.Errorf("problems = %q, want %d", problems, tt.wantProblems)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// defaultPublicBaseURL is the site's canonical origin, used in links we email
+const defaultPublicBaseURL = "https://www.momentumbusiness.org"
+
+// envInt reads an integer environment variable, falling back to def if it
+// is unset or invalid
+func envInt(name string, def int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("Invalid %s=%q, using default %d", name, v, def)
+		return def
+	}
+	return n
+}
+
+// envBool reads a boolean environment variable ("true", "1", ...), falling
+// back to def if it is unset or invalid
+func envBool(name string, def bool) bool {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Printf("Invalid %s=%q, using default %v", name, v, def)
+		return def
+	}
+	return b
+}
+
+// publicBaseURL returns the origin used to build absolute links in emails
+func publicBaseURL() string {
+	if v := os.Getenv("PUBLIC_BASE_URL"); v != "" {
+		return strings.TrimRight(v, "/")
+	}
+	return defaultPublicBaseURL
+}
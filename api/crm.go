@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CRM endpoint kinds
+const (
+	KindHubSpot   = "hubspot"
+	KindPipedrive = "pipedrive"
+)
+
+// CRMRef links a lead to its records in a CRM
+type CRMRef struct {
+	ContactID string    `json:"contactId"`
+	DealID    string    `json:"dealId,omitempty"`
+	SyncedAt  time.Time `json:"syncedAt"`
+}
+
+// CRMAdapter creates or updates a contact and deal for a lead. ref holds
+// the IDs from a previous sync, if any, so repeat syncs update rather than
+// duplicate. The returned status is the HTTP status of the failing call.
+type CRMAdapter interface {
+	Sync(ctx context.Context, lead *Lead, ref CRMRef) (CRMRef, int, error)
+}
+
+// crmAdapters holds the configured adapters by endpoint name, built in main
+var crmAdapters = map[string]CRMAdapter{}
+
+// loadCRMEndpoints builds the adapters whose API tokens are set and returns
+// a dispatcher endpoint for each, so syncs share the webhook retry queue
+func loadCRMEndpoints() []*WebhookEndpoint {
+	var endpoints []*WebhookEndpoint
+	if hs := newHubSpotAdapter(); hs != nil {
+		crmAdapters[KindHubSpot] = hs
+		endpoints = append(endpoints, &WebhookEndpoint{Name: KindHubSpot, Kind: KindHubSpot, URL: hs.baseURL, Events: []string{EventLeadCreated, EventLeadUpdated}})
+	}
+	if pd := newPipedriveAdapter(); pd != nil {
+		crmAdapters[KindPipedrive] = pd
+		endpoints = append(endpoints, &WebhookEndpoint{Name: KindPipedrive, Kind: KindPipedrive, URL: pd.baseURL, Events: []string{EventLeadCreated, EventLeadUpdated}})
+	}
+	return endpoints
+}
+
+// syncCRM runs a queued CRM delivery and writes the CRM IDs back to the lead
+func syncCRM(ctx context.Context, name string, adapter CRMAdapter, payload []byte) (int, error) {
+	var p WebhookPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return 0, err
+	}
+	if p.Lead == nil {
+		return 0, fmt.Errorf("%s is not a lead event", p.Event)
+	}
+	// Prefer the stored lead, which has any IDs from an earlier sync
+	lead, err := leads.Get(p.Lead.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	ref, status, err := adapter.Sync(ctx, lead, lead.CRM[name])
+	if err != nil {
+		return status, err
+	}
+	ref.SyncedAt = time.Now().UTC()
+	_, err = leads.Update(lead.ID, func(l *Lead) error {
+		if l.CRM == nil {
+			l.CRM = make(map[string]CRMRef)
+		}
+		l.CRM[name] = ref
+		return nil
+	})
+	return status, err
+}
+
+// crmError is a non-2xx CRM API response
+type crmError struct {
+	Status int
+	Body   string
+}
+
+func (e *crmError) Error() string {
+	return fmt.Sprintf("CRM API returned %d: %s", e.Status, e.Body)
+}
+
+// crmRequest sends a JSON request and decodes a JSON response into out
+func crmRequest(ctx context.Context, client *http.Client, method, url string, header http.Header, in, out any) (int, error) {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return 0, err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return 0, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, &crmError{Status: resp.StatusCode, Body: strings.TrimSpace(string(data))}
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			return resp.StatusCode, fmt.Errorf("failed to decode CRM response: %w", err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// isCRMNotFound reports whether err is a 404 from the CRM, e.g. a record
+// deleted there since our last sync
+func isCRMNotFound(err error) bool {
+	var ce *crmError
+	return errors.As(err, &ce) && ce.Status == http.StatusNotFound
+}
+
+// dealTitle names the deal created for a lead
+func dealTitle(lead *Lead) string {
+	return strings.TrimSpace(lead.FirstName+" "+lead.LastName) + " - Website Lead"
+}
+
+// serviceLabels returns the readable names of the lead's services
+func serviceLabels(lead *Lead) []string {
+	out := make([]string, len(lead.Services))
+	for i, s := range lead.Services {
+		out[i] = formatService(s)
+	}
+	return out
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+// useTestLeadStore swaps in an empty lead store for the test
+func useTestLeadStore(t *testing.T) {
+	t.Helper()
+	store, err := openLeadStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("openLeadStore: %v", err)
+	}
+	prev := leads
+	leads = store
+	t.Cleanup(func() { leads = prev })
+}
+
+// crmResponse is a canned CRM API reply; a zero status means 200
+type crmResponse struct {
+	status int
+	body   string
+}
+
+// crmCall is a request received by a fakeCRM
+type crmCall struct {
+	route  string // "METHOD /path"
+	query  url.Values
+	header http.Header
+	body   []byte
+}
+
+// decode unmarshals the call's JSON body into out
+func (c crmCall) decode(t *testing.T, out any) {
+	t.Helper()
+	if err := json.Unmarshal(c.body, out); err != nil {
+		t.Fatalf("%s body: %v", c.route, err)
+	}
+}
+
+// fakeCRM answers each "METHOD /path" in its route table with the canned
+// response and anything else with a 404, so an unexpected call fails the
+// sync. The calls it received are kept in order.
+type fakeCRM struct {
+	*httptest.Server
+	mu    sync.Mutex
+	calls []crmCall
+}
+
+func newFakeCRM(t *testing.T, routes map[string]crmResponse) *fakeCRM {
+	t.Helper()
+	f := &fakeCRM{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		call := crmCall{r.Method + " " + r.URL.Path, r.URL.Query(), r.Header.Clone(), body}
+		f.mu.Lock()
+		f.calls = append(f.calls, call)
+		f.mu.Unlock()
+
+		resp, ok := routes[call.route]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if resp.status != 0 {
+			w.WriteHeader(resp.status)
+		}
+		io.WriteString(w, resp.body)
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// Calls returns the calls received so far
+func (f *fakeCRM) Calls() []crmCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]crmCall(nil), f.calls...)
+}
+
+// Routes returns the route of each call received so far
+func (f *fakeCRM) Routes() []string {
+	var routes []string
+	for _, c := range f.Calls() {
+		routes = append(routes, c.route)
+	}
+	return routes
+}
+
+// stubCRM returns ref from every sync and records the refs it was given
+type stubCRM struct {
+	ref   CRMRef
+	given []CRMRef
+}
+
+func (s *stubCRM) Sync(_ context.Context, _ *Lead, ref CRMRef) (CRMRef, int, error) {
+	s.given = append(s.given, ref)
+	return s.ref, http.StatusOK, nil
+}
+
+func TestCRMDeliveryStoresIDsOnLead(t *testing.T) {
+	useTestLeadStore(t)
+	adapter := &stubCRM{ref: CRMRef{ContactID: "101", DealID: "202"}}
+	prev := crmAdapters
+	crmAdapters = map[string]CRMAdapter{KindHubSpot: adapter}
+	t.Cleanup(func() { crmAdapters = prev })
+
+	lead := testLead()
+	if err := leads.Create(lead); err != nil {
+		t.Fatal(err)
+	}
+	endpoint := &WebhookEndpoint{Name: KindHubSpot, Kind: KindHubSpot, URL: "https://api.hubapi.com", Events: []string{EventLeadCreated, EventLeadUpdated}}
+	d := newTestDispatcher(t, t.TempDir(), endpoint)
+	d.Enqueue(EventLeadCreated, lead)
+	d.attempt(endpoint, onlyDelivery(t, d, KindHubSpot).ID)
+
+	if got := onlyDelivery(t, d, KindHubSpot); got.Status != DeliveryDelivered {
+		t.Fatalf("status = %q, attempts %+v", got.Status, got.Attempts)
+	}
+	stored, err := leads.Get(lead.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := stored.CRM[KindHubSpot]
+	if ref.ContactID != "101" || ref.DealID != "202" || ref.SyncedAt.IsZero() {
+		t.Errorf("stored ref = %+v", ref)
+	}
+
+	// A later sync is handed the stored IDs, even though the queued payload
+	// predates them
+	d.Enqueue(EventLeadUpdated, lead)
+	d.attempt(endpoint, d.Deliveries(KindHubSpot)[0].ID)
+	if len(adapter.given) != 2 || adapter.given[0].ContactID != "" || adapter.given[1].ContactID != "101" || adapter.given[1].DealID != "202" {
+		t.Errorf("adapter was given %+v", adapter.given)
+	}
+}
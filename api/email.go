@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"html"
 	"io"
 	"net/http"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 // PostmarkEmail represents an email to send via Postmark
@@ -18,6 +20,26 @@ type PostmarkEmail struct {
 	TextBody      string `json:"TextBody"`
 	HtmlBody      string `json:"HtmlBody"`
 	MessageStream string `json:"MessageStream"`
+	ReplyTo       string `json:"ReplyTo,omitempty"`
+
+	Attachments []PostmarkAttachment `json:"Attachments,omitempty"`
+	Headers     []PostmarkHeader     `json:"Headers,omitempty"`
+
+	// bulk marks follow-up mail, which unsubscribed addresses don't get
+	bulk bool
+}
+
+// PostmarkHeader is an extra header on a Postmark email
+type PostmarkHeader struct {
+	Name  string `json:"Name"`
+	Value string `json:"Value"`
+}
+
+// PostmarkAttachment represents a file attached to a Postmark email
+type PostmarkAttachment struct {
+	Name        string `json:"Name"`
+	Content     string `json:"Content"` // base64 encoded
+	ContentType string `json:"ContentType"`
 }
 
 // PostmarkResponse represents the response from Postmark API
@@ -29,16 +51,23 @@ type PostmarkResponse struct {
 	Message     string `json:"Message"`
 }
 
-// sendEmail sends an email via Postmark
-func sendEmail(token string, email PostmarkEmail) error {
+// sendEmail sends an email via Postmark and returns its MessageID.
+// Suppressed recipients are dropped first; if none are left it returns
+// errSuppressed without sending.
+func sendEmail(token string, email PostmarkEmail) (string, error) {
+	email.To = suppressions.filterRecipients(email.To, email.bulk)
+	if email.To == "" {
+		return "", errSuppressed
+	}
+
 	body, err := json.Marshal(email)
 	if err != nil {
-		return fmt.Errorf("failed to marshal email: %w", err)
+		return "", fmt.Errorf("failed to marshal email: %w", err)
 	}
 
 	req, err := http.NewRequest("POST", "https://api.postmarkapp.com/email", bytes.NewBuffer(body))
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return "", fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Accept", "application/json")
@@ -48,22 +77,22 @@ func sendEmail(token string, email PostmarkEmail) error {
 	client := &http.Client{Timeout: 10 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return "", fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("failed to read response: %w", err)
+		return "", fmt.Errorf("failed to read response: %w", err)
 	}
 
+	var pmResp PostmarkResponse
+	json.Unmarshal(respBody, &pmResp)
 	if resp.StatusCode != http.StatusOK {
-		var pmResp PostmarkResponse
-		json.Unmarshal(respBody, &pmResp)
-		return fmt.Errorf("postmark error %d: %s", pmResp.ErrorCode, pmResp.Message)
+		return "", fmt.Errorf("postmark error %d: %s", pmResp.ErrorCode, pmResp.Message)
 	}
 
-	return nil
+	return pmResp.MessageID, nil
 }
 
 // formatRevenue converts revenue code to human-readable string
@@ -111,14 +140,58 @@ func getServiceClass(service string) string {
 	return "bookkeeping"
 }
 
+// NotifyOptions adjusts the business notification for a lead
+type NotifyOptions struct {
+	// Priority is the lead's tier, which sets the subject and badge
+	Priority string
+
+	// Returning is set when the submission was merged into an earlier lead
+	Returning   bool
+	Submissions int // including this one
+	FirstSeen   time.Time
+}
+
+// priorityBadge returns the notification badge for a lead's tier. Leads
+// scored before tiers existed get the original badge.
+func priorityBadge(locale, priority string) string {
+	switch priority {
+	case PriorityHigh:
+		return translate(locale, "notify.badge_high")
+	case PriorityLow:
+		return translate(locale, "notify.badge_low")
+	}
+	return translate(locale, "notify.badge")
+}
+
 // SendContactFormEmail sends the notification email to the business
-func SendContactFormEmail(form *ContactForm, token, to, from string) error {
+// in the business's configured language
+func SendContactFormEmail(form *ContactForm, token, to, from string, opts NotifyOptions) error {
+	locale := businessLocale()
+	tr := func(key string, args ...any) string {
+		return translate(locale, key, args...)
+	}
+
 	// Get timestamp in PST
 	loc, err := time.LoadLocation("America/Los_Angeles")
 	if err != nil {
 		loc = time.UTC
 	}
-	timestamp := time.Now().In(loc).Format("Monday, January 2, 2006 at 3:04 PM MST")
+	timestamp := time.Now().In(loc).Format(tr("notify.timestamp"))
+	visitorLanguage := localeNames[form.Locale]
+	if visitorLanguage == "" {
+		visitorLanguage = localeNames[defaultLocale]
+	}
+	subject := tr("notify.subject", form.FirstName, form.LastName)
+	badge, heading := priorityBadge(locale, opts.Priority), tr("notify.heading")
+	source := tr("notify.source_value")
+	if opts.Returning {
+		subject = tr("notify.subject_returning", form.FirstName, form.LastName)
+		badge, heading = tr("notify.badge_returning"), tr("notify.heading_returning")
+		source = tr("notify.returning_since", opts.Submissions, opts.FirstSeen.In(loc).Format(tr("notify.date")))
+	}
+	if opts.Priority == PriorityHigh {
+		subject = tr("notify.subject_high", subject)
+	}
 
 	// Build services tags HTML
 	var serviceTagsHTML strings.Builder
@@ -141,30 +214,70 @@ func SendContactFormEmail(form *ContactForm, token, to, from string) error {
 	if form.Message != "" {
 		messageHTML = fmt.Sprintf(`
         <div class="section">
-            <h2>Client Message</h2>
+            <h2>%s</h2>
             <div class="message-box">
                 "%s"
             </div>
         </div>
-        `, form.Message)
+        `, tr("notify.message"), form.Message)
 	}
 
 	// Build message section text
 	messageText := ""
 	if form.Message != "" {
-		messageText = fmt.Sprintf(`CLIENT MESSAGE:
----------------
+		heading := strings.ToUpper(tr("notify.message"))
+		messageText = fmt.Sprintf(`%s:
+%s
 "%s"
 
-`, form.Message)
+`, heading, strings.Repeat("-", utf8.RuneCountInString(heading)), form.Message)
+	}
+
+	// Forward attachments through Postmark, or link them when too large
+	attachments, err := postmarkAttachments(form.Attachments)
+	if err != nil {
+		return fmt.Errorf("failed to read attachments: %w", err)
+	}
+	attachmentsHTML := ""
+	attachmentsText := ""
+	if len(form.Attachments) > 0 {
+		heading := tr("notify.attachments")
+		var items strings.Builder
+		var lines strings.Builder
+		for _, att := range form.Attachments {
+			if attachments != nil {
+				items.WriteString(fmt.Sprintf(`<li>%s (%d KB)</li>`, html.EscapeString(att.Filename), att.Size/1024))
+				lines.WriteString(fmt.Sprintf("* %s (%d KB)\n", att.Filename, att.Size/1024))
+			} else {
+				link := attachmentURL(att.ID, time.Now())
+				items.WriteString(fmt.Sprintf(`<li><a href="%s">%s</a> (%d KB)</li>`, html.EscapeString(link), html.EscapeString(att.Filename), att.Size/1024))
+				lines.WriteString(fmt.Sprintf("* %s (%d KB): %s\n", att.Filename, att.Size/1024, link))
+			}
+		}
+		note := ""
+		if attachments == nil {
+			note = tr("notify.attachments_link", int(attachmentLinkTTL()/(24*time.Hour)))
+		}
+		attachmentsHTML = fmt.Sprintf(`
+        <div class="section">
+            <h2>%s</h2>
+            <p>%s</p>
+            <ul>%s</ul>
+        </div>
+        `, heading, note, items.String())
+		attachmentsText = fmt.Sprintf(`%s:
+%s
+%s
+%s
+`, strings.ToUpper(heading), strings.Repeat("-", utf8.RuneCountInString(heading)), note, lines.String())
 	}
 
 	htmlBody := fmt.Sprintf(`<!DOCTYPE html>
-<html lang="en">
+<html lang="%s">
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>New Lead: Contact Form Submission - %s %s</title>
+    <title>%s</title>
     <style>
         body {
             font-family: 'Manrope', -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, Oxygen, Ubuntu, Cantarell, sans-serif;
@@ -304,123 +417,156 @@ func SendContactFormEmail(form *ContactForm, token, to, from string) error {
     <div class="email-container">
         <div class="header">
             <h1 class="company-name">Momentum Business Solutions</h1>
-            <p class="tagline">Where Strategy Meets Execution</p>
-            <span class="lead-priority">New Qualified Lead</span>
+            <p class="tagline">%s</p>
+            <span class="lead-priority">%s</span>
         </div>
 
         <div class="submission-meta">
-            <strong>Submitted:</strong> %s | <strong>Source:</strong> Website Contact Form
+            <strong>%s:</strong> %s | <strong>%s:</strong> %s | <strong>%s:</strong> %s
         </div>
 
         <div class="section">
-            <h2>Contact Information</h2>
+            <h2>%s</h2>
             <div class="info-grid">
                 <div class="info-item">
-                    <div class="info-label">Full Name</div>
+                    <div class="info-label">%s</div>
                     <div class="info-value">%s %s</div>
                 </div>
                 <div class="info-item">
-                    <div class="info-label">Email Address</div>
+                    <div class="info-label">%s</div>
                     <div class="info-value">%s</div>
                 </div>
                 <div class="info-item">
-                    <div class="info-label">Phone Number</div>
+                    <div class="info-label">%s</div>
                     <div class="info-value">%s</div>
                 </div>
                 <div class="info-item revenue-highlight">
-                    <div class="info-label">Annual Revenue</div>
+                    <div class="info-label">%s</div>
                     <div class="info-value">%s</div>
                 </div>
             </div>
         </div>
 
         <div class="section">
-            <h2>Services of Interest</h2>
+            <h2>%s</h2>
             <div class="services-list">
-                <div class="info-label" style="margin-bottom: 12px;">Client selected the following services:</div>
+                <div class="info-label" style="margin-bottom: 12px;">%s</div>
                 %s
             </div>
         </div>
 
         %s
 
+        %s
+
         <div class="footer">
             <p><strong>Momentum Business Solutions</strong></p>
-            <p>QuickBooks Online | Payroll Processing | Financial Consulting | Strategic Planning</p>
-            <p>Email: cade@momentumbusiness.org | Phone: (509) 554-8022</p>
+            <p>%s</p>
+            <p>%s: cade@momentumbusiness.org | %s: (509) 554-8022</p>
         </div>
     </div>
 </body>
 </html>`,
-		form.FirstName, form.LastName,
-		timestamp,
-		form.FirstName, form.LastName,
-		form.Email,
-		form.PhoneNumber,
-		formatRevenue(form.AnnualRevenue),
+		locale,
+		subject,
+		tr("email.tagline"), badge,
+		tr("notify.submitted"), timestamp, tr("notify.source"), source,
+		tr("notify.language"), visitorLanguage,
+		tr("notify.contact"),
+		tr("notify.full_name"), form.FirstName, form.LastName,
+		tr("notify.email"), form.Email,
+		tr("notify.phone"), form.PhoneNumber,
+		tr("notify.revenue"), formatRevenue(form.AnnualRevenue),
+		tr("notify.services_heading"), tr("notify.services_intro"),
 		serviceTagsHTML.String(),
 		messageHTML,
+		attachmentsHTML,
+		tr("email.services"),
+		tr("email.email"), tr("email.phone"),
 	)
 
-	textBody := fmt.Sprintf(`NEW QUALIFIED LEAD - Momentum Business Solutions
+	textBody := fmt.Sprintf(`%s - Momentum Business Solutions
 ===============================================
 
-SUBMISSION DETAILS:
-Submitted: %s
-Source: Website Contact Form
+%s:
+%s: %s
+%s: %s
+%s: %s
 
-CONTACT INFORMATION:
+%s:
 -------------------
-Name: %s %s
-Email: %s
-Phone: %s
-Annual Revenue: %s
+%s: %s %s
+%s: %s
+%s: %s
+%s: %s
 
-SERVICES OF INTEREST:
+%s:
 --------------------
-Client selected the following services:
 %s
-%sCONTACT INFORMATION:
+%s
+%s%s%s:
 -------------------
 Momentum Business Solutions
-Where Strategy Meets Execution
+%s
 
-QuickBooks Online | Payroll Processing | Financial Consulting | Strategic Planning
-Email: cade@momentumbusiness.org
-Phone: (509) 554-8022
+%s
+%s: cade@momentumbusiness.org
+%s: (509) 554-8022
 
 ---
-This email was generated from your website contact form.
+%s
 `,
-		timestamp,
-		form.FirstName, form.LastName,
-		form.Email,
-		form.PhoneNumber,
-		formatRevenue(form.AnnualRevenue),
+		heading,
+		strings.ToUpper(tr("notify.submission")),
+		tr("notify.submitted"), timestamp,
+		tr("notify.source"), source,
+		tr("notify.language"), visitorLanguage,
+		strings.ToUpper(tr("notify.contact")),
+		tr("notify.name"), form.FirstName, form.LastName,
+		tr("notify.email"), form.Email,
+		tr("notify.phone"), form.PhoneNumber,
+		tr("notify.revenue"), formatRevenue(form.AnnualRevenue),
+		strings.ToUpper(tr("notify.services_heading")),
+		tr("notify.services_intro"),
 		servicesList.String(),
 		messageText,
+		attachmentsText,
+		strings.ToUpper(tr("notify.contact")),
+		tr("email.tagline"),
+		tr("email.services"),
+		tr("email.email"),
+		tr("email.phone"),
+		tr("notify.generated"),
 	)
 
 	email := PostmarkEmail{
 		From:          from,
 		To:            to,
-		Subject:       fmt.Sprintf("New Lead: Contact Form Submission - %s %s", form.FirstName, form.LastName),
+		Subject:       subject,
 		TextBody:      textBody,
 		HtmlBody:      htmlBody,
 		MessageStream: "outbound",
+		Attachments:   attachments,
 	}
 
-	return sendEmail(token, email)
+	_, err = sendEmail(token, email)
+	return err
 }
 
-// SendThankYouEmail sends a thank you email to the customer
-func SendThankYouEmail(form *ContactForm, token, from string) error {
+// SendThankYouEmail sends a thank you email to the customer in their locale
+// and returns its MessageID. Replies go to replyTo if set.
+func SendThankYouEmail(form *ContactForm, token, from, replyTo string) (string, error) {
+	locale := form.Locale
+	tr := func(key string, args ...any) string {
+		return translate(locale, key, args...)
+	}
+
 	htmlBody := fmt.Sprintf(`<!DOCTYPE html>
-<html lang="en">
+<html lang="%s">
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>Thank You for Your Interest - Momentum Business Solutions</title>
+    <title>%s</title>
     <style>
         body {
             font-family: 'Manrope', -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, Oxygen, Ubuntu, Cantarell, sans-serif;
@@ -522,82 +668,117 @@ func SendThankYouEmail(form *ContactForm, token, from string) error {
     <div class="email-container">
         <div class="header">
             <h1 class="company-name">Momentum Business Solutions</h1>
-            <p class="tagline">Where Strategy Meets Execution</p>
+            <p class="tagline">%s</p>
         </div>
 
         <div class="greeting">
-            Thank you, %s!
+            %s
         </div>
 
         <div class="main-content">
-            <p>We sincerely appreciate you taking the time to reach out to Momentum Business Solutions. Your inquiry about our financial management services has been received and is very important to us.</p>
+            <p>%s</p>
 
-            <p>We understand that managing your business finances can be complex, and we're here to handle the bookkeeping, payroll, and reporting so you can focus on what you do best - growing your business.</p>
+            <p>%s</p>
         </div>
 
         <div class="timeline-box">
-            <h3>What Happens Next?</h3>
-            <p><strong>Within 24 hours:</strong> Cade from our team will personally review your submission and reach out to discuss your specific needs and how we can best support your business goals.</p>
+            <h3>%s</h3>
+            <p><strong>%s</strong> %s</p>
         </div>
 
         <div class="contact-info">
-            <h3>In the Meantime</h3>
-            <p>If you have any urgent questions or would like to speak with us immediately, please don't hesitate to reach out:</p>
-            <div class="contact-detail"><strong>Email:</strong> cade@momentumbusiness.org</div>
-            <div class="contact-detail"><strong>Phone:</strong> (509) 554-8022</div>
+            <h3>%s</h3>
+            <p>%s</p>
+            <div class="contact-detail"><strong>%s:</strong> cade@momentumbusiness.org</div>
+            <div class="contact-detail"><strong>%s:</strong> (509) 554-8022</div>
         </div>
 
         <div class="main-content">
-            <p>We look forward to the opportunity to partner with you and help your business achieve its financial goals.</p>
+            <p>%s</p>
 
-            <p>Best regards,<br>
-            <strong>The Momentum Business Solutions Team</strong></p>
+            <p>%s<br>
+            <strong>%s</strong></p>
         </div>
 
         <div class="footer">
             <p><strong>Momentum Business Solutions</strong></p>
-            <p>QuickBooks Online | Payroll Processing | Financial Consulting | Strategic Planning</p>
-            <p>Email: cade@momentumbusiness.org | Phone: (509) 554-8022</p>
+            <p>%s</p>
+            <p>%s: cade@momentumbusiness.org | %s: (509) 554-8022</p>
         </div>
     </div>
 </body>
-</html>`, form.FirstName)
+</html>`,
+		locale,
+		tr("thankyou.title"),
+		tr("email.tagline"),
+		tr("thankyou.greeting", form.FirstName),
+		tr("thankyou.intro"),
+		tr("thankyou.focus"),
+		tr("thankyou.next_heading"),
+		tr("thankyou.next_when"), tr("thankyou.next_body"),
+		tr("thankyou.meantime_heading"),
+		tr("thankyou.meantime_body"),
+		tr("email.email"),
+		tr("email.phone"),
+		tr("thankyou.closing"),
+		tr("thankyou.regards"),
+		tr("thankyou.signature"),
+		tr("email.services"),
+		tr("email.email"), tr("email.phone"),
+	)
 
-	textBody := fmt.Sprintf(`Thank you, %s!
+	textBody := fmt.Sprintf(`%s
 
-We sincerely appreciate you taking the time to reach out to Momentum Business Solutions. Your inquiry about our financial management services has been received and is very important to us.
+%s
 
-We understand that managing your business finances can be complex, and we're here to handle the bookkeeping, payroll, and reporting so you can focus on what you do best - growing your business.
+%s
 
-WHAT HAPPENS NEXT?
-Within 24 hours: Cade from our team will personally review your submission and reach out to discuss your specific needs and how we can best support your business goals.
+%s
+%s %s
 
-IN THE MEANTIME:
-If you have any urgent questions or would like to speak with us immediately, please don't hesitate to reach out:
+%s:
+%s
 
-Email: cade@momentumbusiness.org
-Phone: (509) 554-8022
+%s: cade@momentumbusiness.org
+%s: (509) 554-8022
 
-We look forward to the opportunity to partner with you and help your business achieve its financial goals.
+%s
 
-Best regards,
-The Momentum Business Solutions Team
+%s
+%s
 
 ---
 Momentum Business Solutions
-Where Strategy Meets Execution
+%s
 
-QuickBooks Online | Payroll Processing | Financial Consulting | Strategic Planning
-Email: cade@momentumbusiness.org | Phone: (509) 554-8022
-`, form.FirstName)
+%s
+%s: cade@momentumbusiness.org | %s: (509) 554-8022
+`,
+		tr("thankyou.greeting", form.FirstName),
+		tr("thankyou.intro"),
+		tr("thankyou.focus"),
+		strings.ToUpper(tr("thankyou.next_heading")),
+		tr("thankyou.next_when"), tr("thankyou.next_body"),
+		strings.ToUpper(tr("thankyou.meantime_heading")),
+		tr("thankyou.meantime_body"),
+		tr("email.email"),
+		tr("email.phone"),
+		tr("thankyou.closing"),
+		tr("thankyou.regards"),
+		tr("thankyou.signature"),
+		tr("email.tagline"),
+		tr("email.services"),
+		tr("email.email"), tr("email.phone"),
+	)
 
 	email := PostmarkEmail{
 		From:          from,
 		To:            form.Email,
-		Subject:       "Thank you for your interest in Momentum Business Solutions",
+		Subject:       tr("thankyou.subject"),
 		TextBody:      textBody,
 		HtmlBody:      htmlBody,
 		MessageStream: "outbound",
+		ReplyTo:       replyTo,
 	}
 
 	return sendEmail(token, email)
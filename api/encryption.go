@@ -0,0 +1,667 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// encryptedPrefix marks a field value as ciphertext, so records written
+// before encryption was enabled still load as plaintext
+const encryptedPrefix = "enc:"
+
+// Blind index kinds, hashed separately so an email never matches a phone
+const (
+	IndexEmail = "email"
+	IndexPhone = "phone"
+)
+
+// errNoKeys is returned when encrypted data is read without keys configured
+var errNoKeys = errors.New("data is encrypted but no encryption keys are configured")
+
+// Keyring holds the versioned key-encryption keys (KEKs) that wrap each
+// record's data key, and the separate key blind indexes are computed with.
+// New data is always sealed under the current version; older versions are
+// kept only to open data written before a rotation.
+//
+// The index key is deliberately unversioned: a lookup hashes the value once
+// and compares it against every record, which only works if all records
+// were indexed with the same key. The stores never trust the indexes on
+// disk, they recompute them from the decrypted data when they load, so
+// replacing the index key takes a restart (and rotate-keys to refresh the
+// stored copies) rather than a migration.
+type Keyring struct {
+	current int
+	keks    map[int]cipher.AEAD
+	index   []byte
+}
+
+// keyring is the process-wide keyring, loaded in main. Nil leaves stored
+// data in plaintext.
+var keyring *Keyring
+
+// keyFile is the format of ENCRYPTION_KEY_FILE
+type keyFile struct {
+	Current  int               `json:"current"`  // defaults to the highest version
+	Keys     map[string]string `json:"keys"`     // version → base64 256-bit key
+	IndexKey string            `json:"indexKey"` // base64, unversioned, see Keyring
+}
+
+// loadKeyring reads the keys from the JSON file at ENCRYPTION_KEY_FILE, or
+// from ENCRYPTION_KEYS ("1:<base64>,2:<base64>"), ENCRYPTION_KEY_VERSION and
+// ENCRYPTION_INDEX_KEY. It returns nil if no keys are configured.
+func loadKeyring() (*Keyring, error) {
+	var kf keyFile
+	if path := os.Getenv("ENCRYPTION_KEY_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &kf); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	} else if v := os.Getenv("ENCRYPTION_KEYS"); v != "" {
+		kf.Keys = make(map[string]string)
+		for _, entry := range strings.Split(v, ",") {
+			version, key, ok := strings.Cut(strings.TrimSpace(entry), ":")
+			if !ok {
+				return nil, errors.New("ENCRYPTION_KEYS entries must be <version>:<base64 key>")
+			}
+			kf.Keys[version] = key
+		}
+		kf.Current = envInt("ENCRYPTION_KEY_VERSION", 0)
+		kf.IndexKey = os.Getenv("ENCRYPTION_INDEX_KEY")
+	} else {
+		log.Printf("No encryption keys configured, lead data is stored in plaintext")
+		return nil, nil
+	}
+	return newKeyring(kf)
+}
+
+// newKeyring validates the keys and builds their ciphers
+func newKeyring(kf keyFile) (*Keyring, error) {
+	k := &Keyring{keks: make(map[int]cipher.AEAD)}
+	for v, encoded := range kf.Keys {
+		version, err := strconv.Atoi(v)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("invalid key version %q", v)
+		}
+		key, err := decodeKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key version %d: %w", version, err)
+		}
+		if k.keks[version], err = newAEAD(key); err != nil {
+			return nil, err
+		}
+		k.current = max(k.current, version)
+	}
+	if len(k.keks) == 0 {
+		return nil, errors.New("no encryption keys configured")
+	}
+	if kf.Current != 0 {
+		if _, ok := k.keks[kf.Current]; !ok {
+			return nil, fmt.Errorf("current key version %d is not configured", kf.Current)
+		}
+		k.current = kf.Current
+	}
+	index, err := decodeKey(kf.IndexKey)
+	if err != nil {
+		return nil, fmt.Errorf("index key: %w", err)
+	}
+	k.index = index
+	return k, nil
+}
+
+// decodeKey decodes a base64 256-bit key
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, errors.New("key must be base64")
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// newAEAD returns AES-256-GCM for the key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Current returns the version new data is sealed under
+func (k *Keyring) Current() int {
+	return k.current
+}
+
+// Envelope is stored with each encrypted record: its data key, wrapped by
+// the key-encryption key of the given version
+type Envelope struct {
+	KeyVersion int    `json:"keyVersion"`
+	DataKey    string `json:"dataKey"` // base64 nonce + ciphertext
+}
+
+// RecordCipher encrypts the fields of one record with its data key. The
+// record ID is bound as additional data, so ciphertext can't be moved
+// between records.
+type RecordCipher struct {
+	aead cipher.AEAD
+	aad  []byte
+}
+
+// Seal returns a cipher under a fresh data key for the record, with the
+// envelope to store alongside it
+func (k *Keyring) Seal(recordID string) (*RecordCipher, *Envelope, error) {
+	dek := make([]byte, 32)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, nil, err
+	}
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return nil, nil, err
+	}
+	aad := []byte(recordID)
+	wrapped := seal(k.keks[k.current], dek, aad)
+	env := &Envelope{KeyVersion: k.current, DataKey: base64.StdEncoding.EncodeToString(wrapped)}
+	return &RecordCipher{aead: aead, aad: aad}, env, nil
+}
+
+// Open unwraps the record's data key from its envelope
+func (k *Keyring) Open(env *Envelope, recordID string) (*RecordCipher, error) {
+	if k == nil {
+		return nil, errNoKeys
+	}
+	dek, err := k.unwrap(env, recordID)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(dek)
+	if err != nil {
+		return nil, err
+	}
+	return &RecordCipher{aead: aead, aad: []byte(recordID)}, nil
+}
+
+// Rewrap re-wraps an envelope's data key under the current version,
+// leaving the data it protects untouched
+func (k *Keyring) Rewrap(env *Envelope, recordID string) (*Envelope, error) {
+	dek, err := k.unwrap(env, recordID)
+	if err != nil {
+		return nil, err
+	}
+	wrapped := seal(k.keks[k.current], dek, []byte(recordID))
+	return &Envelope{KeyVersion: k.current, DataKey: base64.StdEncoding.EncodeToString(wrapped)}, nil
+}
+
+// unwrap decrypts an envelope's data key
+func (k *Keyring) unwrap(env *Envelope, recordID string) ([]byte, error) {
+	kek, ok := k.keks[env.KeyVersion]
+	if !ok {
+		return nil, fmt.Errorf("key version %d is not configured", env.KeyVersion)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(env.DataKey)
+	if err != nil {
+		return nil, err
+	}
+	dek, err := open(kek, wrapped, []byte(recordID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	return dek, nil
+}
+
+// BlindIndex returns a keyed hash of a normalized value, so records can be
+// matched on it without decrypting them. It returns "" for an empty value.
+func (k *Keyring) BlindIndex(kind, value string) string {
+	if value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, k.index)
+	mac.Write([]byte(kind + "|" + value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Encrypt seals the fields in place. Empty fields stay empty.
+func (c *RecordCipher) Encrypt(fields ...*string) {
+	for _, f := range fields {
+		if *f != "" {
+			*f = encryptedPrefix + base64.StdEncoding.EncodeToString(seal(c.aead, []byte(*f), c.aad))
+		}
+	}
+}
+
+// Decrypt opens the fields in place. Fields without the encrypted prefix
+// are left as they are.
+func (c *RecordCipher) Decrypt(fields ...*string) error {
+	for _, f := range fields {
+		encoded, ok := strings.CutPrefix(*f, encryptedPrefix)
+		if !ok {
+			continue
+		}
+		sealed, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return err
+		}
+		plain, err := open(c.aead, sealed, c.aad)
+		if err != nil {
+			return err
+		}
+		*f = string(plain)
+	}
+	return nil
+}
+
+// EncryptBytes seals a blob, such as an attachment's contents
+func (c *RecordCipher) EncryptBytes(data []byte) []byte {
+	return seal(c.aead, data, c.aad)
+}
+
+// DecryptBytes opens a blob sealed with EncryptBytes
+func (c *RecordCipher) DecryptBytes(data []byte) ([]byte, error) {
+	return open(c.aead, data, c.aad)
+}
+
+// seal encrypts data with a random nonce prepended to the ciphertext
+func seal(aead cipher.AEAD, data, aad []byte) []byte {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	rand.Read(nonce)
+	return aead.Seal(nonce, nonce, data, aad)
+}
+
+// open decrypts data sealed by seal
+func open(aead cipher.AEAD, data, aad []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], aad)
+}
+
+// matcher compares records against a normalized lookup value: by blind
+// index when encryption is on, by the record's normalized plaintext
+// otherwise
+type matcher func(plain, index string) bool
+
+// newMatcher builds a matcher for value, normalized with normalize
+func newMatcher(kind, value string, normalize func(string) string) matcher {
+	key := normalize(value)
+	if key == "" {
+		return func(string, string) bool { return false }
+	}
+	if keyring == nil {
+		return func(plain, _ string) bool { return normalize(plain) == key }
+	}
+	index := keyring.BlindIndex(kind, key)
+	return func(_, stored string) bool { return stored == index }
+}
+
+// emailMatcher matches records with the same email address
+func emailMatcher(email string) matcher {
+	return newMatcher(IndexEmail, email, normalizeEmail)
+}
+
+// phoneMatcher matches records with the same phone number
+func phoneMatcher(phone string) matcher {
+	return newMatcher(IndexPhone, phone, normalizePhone)
+}
+
+// blindIndex returns the stored index for a value, or "" when encryption
+// is off
+func blindIndex(kind, value string, normalize func(string) string) string {
+	if keyring == nil {
+		return ""
+	}
+	return keyring.BlindIndex(kind, normalize(value))
+}
+
+// sealedCache keeps the stored form of each record in a store, so a write
+// only encrypts the records that changed since the last one. Stores forget
+// a record whenever they change or delete it.
+type sealedCache[T any] map[string]*T
+
+// get returns the cached sealed form of the record with the given ID,
+// sealing live with seal if there's none yet
+func (c sealedCache[T]) get(id string, live *T, seal func(*T) (*T, error)) (*T, error) {
+	if sealed, ok := c[id]; ok {
+		return sealed, nil
+	}
+	sealed, err := seal(live)
+	if err != nil {
+		return nil, err
+	}
+	c[id] = sealed
+	return sealed, nil
+}
+
+// forget drops a record's sealed form, so it's sealed afresh on next write
+func (c sealedCache[T]) forget(id string) {
+	delete(c, id)
+}
+
+// piiFields returns the lead's encrypted fields: contact details, free
+// text, attachment filenames, the subjects of the emails sent (which carry
+// the prospect's name) and the timeline details (Postmark's bounce and
+// delivery messages quote the address)
+func (l *Lead) piiFields() []*string {
+	fields := []*string{&l.FirstName, &l.LastName, &l.Email, &l.PhoneNumber, &l.Message, &l.RemoteIP}
+	for i := range l.Emails {
+		fields = append(fields, &l.Emails[i].Subject)
+	}
+	for i := range l.Timeline {
+		fields = append(fields, &l.Timeline[i].Detail)
+	}
+	for i := range l.Attachments {
+		fields = append(fields, &l.Attachments[i].Filename)
+	}
+	for i := range l.Interactions {
+		in := &l.Interactions[i]
+		fields = append(fields, &in.Message, &in.RemoteIP)
+		for j := range in.Attachments {
+			fields = append(fields, &in.Attachments[j].Filename)
+		}
+	}
+	for i := range l.Conversation {
+		m := &l.Conversation[i]
+		fields = append(fields, &m.From, &m.Subject, &m.Text)
+		for j := range m.Attachments {
+			fields = append(fields, &m.Attachments[j])
+		}
+	}
+	return fields
+}
+
+// indexPII refreshes the lead's blind indexes from its contact details
+func (l *Lead) indexPII() {
+	l.EmailIndex = blindIndex(IndexEmail, l.Email, normalizeEmail)
+	l.PhoneIndex = blindIndex(IndexPhone, l.PhoneNumber, normalizePhone)
+}
+
+// sealLead returns a copy of the lead with its PII encrypted for storage,
+// or the lead itself when encryption is off
+func sealLead(l *Lead) (*Lead, error) {
+	if keyring == nil {
+		return l, nil
+	}
+	c, env, err := keyring.Seal(l.ID)
+	if err != nil {
+		return nil, err
+	}
+	cp := *l
+	cp.Emails = slices.Clone(l.Emails)
+	cp.Timeline = slices.Clone(l.Timeline)
+	cp.Attachments = slices.Clone(l.Attachments)
+	cp.Interactions = slices.Clone(l.Interactions)
+	for i := range cp.Interactions {
+		cp.Interactions[i].Attachments = slices.Clone(cp.Interactions[i].Attachments)
+	}
+	cp.Conversation = slices.Clone(l.Conversation)
+	for i := range cp.Conversation {
+		cp.Conversation[i].Attachments = slices.Clone(cp.Conversation[i].Attachments)
+	}
+	c.Encrypt(cp.piiFields()...)
+	cp.Envelope = env
+	return &cp, nil
+}
+
+// openLead decrypts a lead loaded from storage in place
+func openLead(l *Lead) error {
+	if l.Envelope != nil {
+		c, err := keyring.Open(l.Envelope, l.ID)
+		if err != nil {
+			return fmt.Errorf("lead %s: %w", l.ID, err)
+		}
+		if err := c.Decrypt(l.piiFields()...); err != nil {
+			return fmt.Errorf("lead %s: %w", l.ID, err)
+		}
+		l.Envelope = nil
+	}
+	l.indexPII()
+	return nil
+}
+
+// piiFields returns the booking's encrypted fields
+func (b *Booking) piiFields() []*string {
+	return []*string{&b.FirstName, &b.LastName, &b.Email, &b.PhoneNumber}
+}
+
+// sealBooking returns a copy of the booking with its PII encrypted for
+// storage, or the booking itself when encryption is off
+func sealBooking(b *Booking) (*Booking, error) {
+	if keyring == nil {
+		return b, nil
+	}
+	c, env, err := keyring.Seal(b.ID)
+	if err != nil {
+		return nil, err
+	}
+	cp := *b
+	c.Encrypt(cp.piiFields()...)
+	cp.Envelope = env
+	return &cp, nil
+}
+
+// openBooking decrypts a booking loaded from storage in place
+func openBooking(b *Booking) error {
+	if b.Envelope != nil {
+		c, err := keyring.Open(b.Envelope, b.ID)
+		if err != nil {
+			return fmt.Errorf("booking %s: %w", b.ID, err)
+		}
+		if err := c.Decrypt(b.piiFields()...); err != nil {
+			return fmt.Errorf("booking %s: %w", b.ID, err)
+		}
+		b.Envelope = nil
+	}
+	b.EmailIndex = blindIndex(IndexEmail, b.Email, normalizeEmail)
+	return nil
+}
+
+// piiFields returns the subscriber's encrypted fields
+func (sub *Subscriber) piiFields() []*string {
+	return []*string{&sub.Email, &sub.SignupIP, &sub.ConfirmIP}
+}
+
+// sealSubscriber returns a copy of the subscriber with its PII encrypted
+// for storage, or the subscriber itself when encryption is off
+func sealSubscriber(sub *Subscriber) (*Subscriber, error) {
+	if keyring == nil {
+		return sub, nil
+	}
+	c, env, err := keyring.Seal(sub.ID)
+	if err != nil {
+		return nil, err
+	}
+	cp := *sub
+	c.Encrypt(cp.piiFields()...)
+	cp.Envelope = env
+	return &cp, nil
+}
+
+// openSubscriber decrypts a subscriber loaded from storage in place
+func openSubscriber(sub *Subscriber) error {
+	if sub.Envelope == nil {
+		return nil
+	}
+	c, err := keyring.Open(sub.Envelope, sub.ID)
+	if err != nil {
+		return fmt.Errorf("subscriber %s: %w", sub.ID, err)
+	}
+	if err := c.Decrypt(sub.piiFields()...); err != nil {
+		return fmt.Errorf("subscriber %s: %w", sub.ID, err)
+	}
+	sub.Envelope = nil
+	return nil
+}
+
+// sealSuppression returns a copy of the suppression with the address and
+// detail encrypted for storage, or the suppression itself when encryption
+// is off
+func sealSuppression(e *Suppression) (*Suppression, error) {
+	if keyring == nil {
+		return e, nil
+	}
+	c, env, err := keyring.Seal(e.ID)
+	if err != nil {
+		return nil, err
+	}
+	cp := *e
+	c.Encrypt(&cp.Email, &cp.Detail)
+	cp.Envelope = env
+	return &cp, nil
+}
+
+// openSuppression decrypts a suppression loaded from storage in place
+func openSuppression(e *Suppression) error {
+	if e.Envelope == nil {
+		return nil
+	}
+	c, err := keyring.Open(e.Envelope, e.ID)
+	if err != nil {
+		return fmt.Errorf("suppression %s: %w", e.ID, err)
+	}
+	if err := c.Decrypt(&e.Email, &e.Detail); err != nil {
+		return fmt.Errorf("suppression %s: %w", e.ID, err)
+	}
+	e.Envelope = nil
+	return nil
+}
+
+// sealDelivery encrypts a delivery's payload for storage. Payloads never
+// change once queued, so this happens once per delivery.
+func sealDelivery(del *Delivery) error {
+	if keyring == nil {
+		return nil
+	}
+	c, env, err := keyring.Seal(del.ID)
+	if err != nil {
+		return err
+	}
+	del.sealedPayload = base64.StdEncoding.EncodeToString(c.EncryptBytes(del.Payload))
+	del.envelope = env
+	return nil
+}
+
+// openDelivery decrypts a delivery loaded from storage, keeping its sealed
+// payload for the next write. Plaintext payloads from before encryption was
+// enabled are sealed.
+func openDelivery(stored storedDelivery) (*Delivery, error) {
+	del := stored.Delivery
+	if stored.Envelope == nil {
+		return &del, sealDelivery(&del)
+	}
+	c, err := keyring.Open(stored.Envelope, del.ID)
+	if err != nil {
+		return nil, fmt.Errorf("delivery %s: %w", del.ID, err)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(stored.SealedPayload)
+	if err != nil {
+		return nil, fmt.Errorf("delivery %s: %w", del.ID, err)
+	}
+	if del.Payload, err = c.DecryptBytes(sealed); err != nil {
+		return nil, fmt.Errorf("delivery %s: %w", del.ID, err)
+	}
+	del.sealedPayload, del.envelope = stored.SealedPayload, stored.Envelope
+	return &del, nil
+}
+
+// runRotateKeys re-encrypts the stored data under the current key version:
+// leads, bookings, subscribers and suppressions get fresh data keys,
+// attachments and webhook deliveries get theirs rewrapped (or are
+// encrypted, if written before encryption was enabled). Run it with
+// the API stopped, after adding the new key and making it current; older
+// versions can be removed from the keyring once it succeeds.
+//
+//	go run . rotate-keys
+func runRotateKeys(args []string) error {
+	fs := flag.NewFlagSet("rotate-keys", flag.ExitOnError)
+	fs.Parse(args)
+
+	var err error
+	if keyring, err = loadKeyring(); err != nil {
+		return err
+	}
+	if keyring == nil {
+		return errors.New("set ENCRYPTION_KEY_FILE or ENCRYPTION_KEYS to rotate keys")
+	}
+
+	if leads, err = openLeadStore(dataDir()); err != nil {
+		return err
+	}
+	nLeads, err := leads.Reseal()
+	if err != nil {
+		return fmt.Errorf("failed to rewrite leads: %w", err)
+	}
+	if bookings, err = openBookingStore(dataDir(), nil); err != nil {
+		return err
+	}
+	nBookings, err := bookings.Reseal()
+	if err != nil {
+		return fmt.Errorf("failed to rewrite bookings: %w", err)
+	}
+	if subscribers, err = openSubscriberStore(dataDir()); err != nil {
+		return err
+	}
+	nSubscribers, err := subscribers.Reseal()
+	if err != nil {
+		return fmt.Errorf("failed to rewrite subscribers: %w", err)
+	}
+	if suppressions, err = openSuppressionList(dataDir()); err != nil {
+		return err
+	}
+	nSuppressions, err := suppressions.Reseal()
+	if err != nil {
+		return fmt.Errorf("failed to rewrite suppressions: %w", err)
+	}
+	if webhooks, err = newDispatcher(dataDir(), nil); err != nil {
+		return err
+	}
+	nDeliveries, err := webhooks.Reseal()
+	if err != nil {
+		return fmt.Errorf("failed to rewrite webhook deliveries: %w", err)
+	}
+
+	metas, err := filepath.Glob(filepath.Join(attachmentDir(), "*.json"))
+	if err != nil {
+		return err
+	}
+	var nAttachments, failed int
+	for _, path := range metas {
+		id := strings.TrimSuffix(filepath.Base(path), ".json")
+		if !isAttachmentID(id) {
+			continue
+		}
+		changed, err := resealAttachment(id)
+		if err != nil {
+			log.Printf("Failed to re-encrypt attachment %s: %v", id, err)
+			failed++
+			continue
+		}
+		if changed {
+			nAttachments++
+		}
+	}
+
+	log.Printf("Re-encrypted %d leads, %d bookings, %d subscribers, %d suppressions, %d webhook deliveries and %d attachments under key version %d",
+		nLeads, nBookings, nSubscribers, nSuppressions, nDeliveries, nAttachments, keyring.Current())
+	if failed > 0 {
+		return fmt.Errorf("%d attachments could not be re-encrypted; keep their key versions until they are", failed)
+	}
+	return nil
+}
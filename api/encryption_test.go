@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testKey returns a base64 256-bit key filled with b
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+// useTestKeyring turns encryption on with a random key for the test
+func useTestKeyring(t *testing.T) {
+	t.Helper()
+	randomKey := func() string {
+		key := make([]byte, 32)
+		rand.Read(key)
+		return base64.StdEncoding.EncodeToString(key)
+	}
+	k, err := newKeyring(keyFile{Keys: map[string]string{"1": randomKey()}, IndexKey: randomKey()})
+	if err != nil {
+		t.Fatalf("newKeyring: %v", err)
+	}
+	prev := keyring
+	keyring = k
+	t.Cleanup(func() { keyring = prev })
+}
+
+func TestSealLeadEncryptsPII(t *testing.T) {
+	useTestKeyring(t)
+	lead := testLead()
+	lead.RemoteIP = "203.0.113.7"
+	lead.Attachments = []Attachment{{ID: "att1", Filename: "ana-garcia-2025-taxes.pdf"}}
+	lead.Interactions = []Interaction{{Message: "Following up on my message", RemoteIP: "203.0.113.8"}}
+	lead.Conversation = []ConversationMessage{{From: "ana@example.com", Subject: "Re: your books", Text: "Thursday works"}}
+	lead.Emails = []SentEmail{{MessageID: "m1", Kind: "confirmation", Subject: "Thanks, Ana García"}}
+	lead.Timeline = []LeadEvent{{Type: LeadEventBounced, MessageID: "m1", Detail: "550 ana@example.com: mailbox unavailable"}}
+
+	sealed, err := sealLead(lead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		field func(*Lead) string
+	}{
+		{"first name", func(l *Lead) string { return l.FirstName }},
+		{"last name", func(l *Lead) string { return l.LastName }},
+		{"email", func(l *Lead) string { return l.Email }},
+		{"phone", func(l *Lead) string { return l.PhoneNumber }},
+		{"message", func(l *Lead) string { return l.Message }},
+		{"remote IP", func(l *Lead) string { return l.RemoteIP }},
+		{"attachment filename", func(l *Lead) string { return l.Attachments[0].Filename }},
+		{"interaction message", func(l *Lead) string { return l.Interactions[0].Message }},
+		{"interaction remote IP", func(l *Lead) string { return l.Interactions[0].RemoteIP }},
+		{"reply sender", func(l *Lead) string { return l.Conversation[0].From }},
+		{"reply subject", func(l *Lead) string { return l.Conversation[0].Subject }},
+		{"reply text", func(l *Lead) string { return l.Conversation[0].Text }},
+		{"email subject", func(l *Lead) string { return l.Emails[0].Subject }},
+		{"timeline detail", func(l *Lead) string { return l.Timeline[0].Detail }},
+	}
+	opened := sealed.clone()
+	if err := openLead(opened); err != nil {
+		t.Fatalf("openLead: %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plain := tt.field(lead)
+			if got := tt.field(sealed); !strings.HasPrefix(got, encryptedPrefix) {
+				t.Errorf("stored as %q", got)
+			}
+			if got := tt.field(opened); got != plain {
+				t.Errorf("opened as %q, want %q", got, plain)
+			}
+		})
+	}
+	if lead.Email != "ana@example.com" || lead.Timeline[0].Detail == sealed.Timeline[0].Detail {
+		t.Fatal("sealing changed the live lead")
+	}
+	if opened.EmailIndex == "" || opened.EmailIndex != blindIndex(IndexEmail, " ANA@example.com", normalizeEmail) {
+		t.Errorf("email index %q not rebuilt on open", opened.EmailIndex)
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	v1, err := newKeyring(keyFile{Keys: map[string]string{"1": testKey(1)}, IndexKey: testKey(9)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	both, err := newKeyring(keyFile{Keys: map[string]string{"1": testKey(1), "2": testKey(2)}, IndexKey: testKey(9)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, err := newKeyring(keyFile{Keys: map[string]string{"2": testKey(2)}, IndexKey: testKey(9)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, env, err := v1.Seal("lead1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	field := "ana@example.com"
+	c.Encrypt(&field)
+
+	rewrapped, err := both.Rewrap(env, "lead1")
+	if err != nil {
+		t.Fatalf("Rewrap: %v", err)
+	}
+	if rewrapped.KeyVersion != 2 {
+		t.Fatalf("rewrapped under version %d, want 2", rewrapped.KeyVersion)
+	}
+
+	tests := []struct {
+		name    string
+		keyring *Keyring
+		env     *Envelope
+		record  string
+		wantErr bool
+	}{
+		{"original key", v1, env, "lead1", false},
+		{"old version kept after rotation", both, env, "lead1", false},
+		{"rewrapped under the new version", v2, rewrapped, "lead1", false},
+		{"old version dropped", v2, env, "lead1", true},
+		{"moved to another record", both, rewrapped, "lead2", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := field
+			c, err := tt.keyring.Open(tt.env, tt.record)
+			if err == nil {
+				err = c.Decrypt(&got)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("opened")
+				}
+				return
+			}
+			if err != nil || got != "ana@example.com" {
+				t.Fatalf("opened %q, %v", got, err)
+			}
+		})
+	}
+}
+
+func TestKeyringConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		kf          keyFile
+		wantErr     bool
+		wantCurrent int
+	}{
+		{"highest version is current", keyFile{Keys: map[string]string{"1": testKey(1), "3": testKey(3)}, IndexKey: testKey(9)}, false, 3},
+		{"explicit current", keyFile{Current: 1, Keys: map[string]string{"1": testKey(1), "3": testKey(3)}, IndexKey: testKey(9)}, false, 1},
+		{"current not configured", keyFile{Current: 2, Keys: map[string]string{"1": testKey(1)}, IndexKey: testKey(9)}, true, 0},
+		{"no keys", keyFile{IndexKey: testKey(9)}, true, 0},
+		{"bad version", keyFile{Keys: map[string]string{"v1": testKey(1)}, IndexKey: testKey(9)}, true, 0},
+		{"short key", keyFile{Keys: map[string]string{"1": base64.StdEncoding.EncodeToString([]byte("short"))}, IndexKey: testKey(9)}, true, 0},
+		{"missing index key", keyFile{Keys: map[string]string{"1": testKey(1)}}, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := newKeyring(tt.kf)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("accepted")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if k.Current() != tt.wantCurrent {
+				t.Errorf("current = %d, want %d", k.Current(), tt.wantCurrent)
+			}
+		})
+	}
+}
+
+func TestLeadStoreRotateKeys(t *testing.T) {
+	dir := t.TempDir()
+	prev := keyring
+	t.Cleanup(func() { keyring = prev })
+
+	keyring, _ = newKeyring(keyFile{Keys: map[string]string{"1": testKey(1)}, IndexKey: testKey(9)})
+	store, err := openLeadStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lead := testLead()
+	lead.Timeline = []LeadEvent{{At: time.Now(), Type: LeadEventBounced, Detail: "ana@example.com bounced"}}
+	if err := store.Create(lead); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "leads.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("ana@example.com")) || bytes.Contains(data, []byte("García")) {
+		t.Fatalf("plaintext PII on disk:\n%s", data)
+	}
+
+	// Rotate: add version 2, make it current and rewrite the store
+	keyring, _ = newKeyring(keyFile{Keys: map[string]string{"1": testKey(1), "2": testKey(2)}, IndexKey: testKey(9)})
+	if store, err = openLeadStore(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Reseal(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Version 1 can now be dropped
+	keyring, _ = newKeyring(keyFile{Keys: map[string]string{"2": testKey(2)}, IndexKey: testKey(9)})
+	if store, err = openLeadStore(dir); err != nil {
+		t.Fatalf("reopening with only the new key: %v", err)
+	}
+	got, err := store.Get(lead.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Email != lead.Email || got.Timeline[0].Detail != "ana@example.com bounced" {
+		t.Errorf("reopened lead = %+v", got)
+	}
+	if matches := store.ByEmail("ANA@example.com"); len(matches) != 1 {
+		t.Errorf("blind index lookup found %d leads", len(matches))
+	}
+}
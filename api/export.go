@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Export formats
+const (
+	ExportCSV    = "csv"
+	ExportNDJSON = "ndjson"
+	ExportVCard  = "vcard"
+)
+
+// exportContentTypes maps each format to its response content type and
+// download file extension
+var exportContentTypes = map[string][2]string{
+	ExportCSV:    {"text/csv; charset=utf-8", "csv"},
+	ExportNDJSON: {"application/x-ndjson", "ndjson"},
+	ExportVCard:  {"text/vcard; charset=utf-8", "vcf"},
+}
+
+// exportFlushEvery is how many leads are written between flushes
+const exportFlushEvery = 100
+
+// LeadFilter selects leads by status and creation time. Zero fields match
+// everything; To is exclusive.
+type LeadFilter struct {
+	Status string
+	From   time.Time
+	To     time.Time
+}
+
+// Match reports whether the lead passes the filter
+func (f LeadFilter) Match(l *Lead) bool {
+	if f.Status != "" && l.Status != f.Status {
+		return false
+	}
+	if !f.From.IsZero() && l.CreatedAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !l.CreatedAt.Before(f.To) {
+		return false
+	}
+	return true
+}
+
+// parseLeadFilter builds a filter from status, from and to values. Dates
+// are YYYY-MM-DD (UTC, with to covering the whole day) or RFC 3339.
+func parseLeadFilter(status, from, to string) (LeadFilter, error) {
+	f := LeadFilter{Status: status}
+	var err error
+	if from != "" {
+		if f.From, err = parseExportTime(from, false); err != nil {
+			return f, fmt.Errorf("invalid from: %w", err)
+		}
+	}
+	if to != "" {
+		if f.To, err = parseExportTime(to, true); err != nil {
+			return f, fmt.Errorf("invalid to: %w", err)
+		}
+	}
+	return f, nil
+}
+
+func parseExportTime(v string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		if endOfDay {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// exportLeads writes the matching leads to w, oldest first. If w can be
+// flushed (an http.Flusher), rows are flushed as they're written so large
+// exports stream instead of buffering.
+func exportLeads(w io.Writer, format string, filter LeadFilter) error {
+	list := leads.List(filter.Match)
+	flush := func() {}
+	if f, ok := w.(http.Flusher); ok {
+		flush = f.Flush
+	}
+
+	switch format {
+	case ExportCSV:
+		return exportCSV(w, list, flush)
+	case ExportNDJSON:
+		enc := json.NewEncoder(w)
+		for i := len(list) - 1; i >= 0; i-- {
+			if err := enc.Encode(list[i]); err != nil {
+				return err
+			}
+			if i%exportFlushEvery == 0 {
+				flush()
+			}
+		}
+		return nil
+	case ExportVCard:
+		bw := bufio.NewWriter(w)
+		for i := len(list) - 1; i >= 0; i-- {
+			writeVCard(bw, list[i])
+			if i%exportFlushEvery == 0 {
+				if err := bw.Flush(); err != nil {
+					return err
+				}
+				flush()
+			}
+		}
+		return bw.Flush()
+	}
+	return fmt.Errorf("unknown export format %q", format)
+}
+
+// exportCSV writes a spreadsheet-friendly CSV with readable revenue and
+// service labels
+func exportCSV(w io.Writer, list []*Lead, flush func()) error {
+	// A BOM makes Excel read the file as UTF-8
+	if _, err := io.WriteString(w, "\ufeff"); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	cw.Write([]string{
+		"ID", "Status", "Priority", "Created", "First Name", "Last Name", "Email", "Phone",
+		"Annual Revenue", "Services", "Message", "Language", "Spam Score",
+	})
+	for i := len(list) - 1; i >= 0; i-- {
+		l := list[i]
+		row := []string{
+			l.ID, l.Status, l.Priority, l.CreatedAt.Format(time.RFC3339), l.FirstName, l.LastName, l.Email, l.PhoneNumber,
+			formatRevenue(l.AnnualRevenue), strings.Join(serviceLabels(l), "; "), l.Message, l.Locale, strconv.Itoa(l.SpamScore),
+		}
+		for j, cell := range row {
+			row[j] = csvSafe(cell)
+		}
+		cw.Write(row)
+		if i%exportFlushEvery == 0 {
+			cw.Flush()
+			flush()
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// csvSafe stops spreadsheets from evaluating visitor-supplied text as a
+// formula
+func csvSafe(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// writeVCard writes a vCard 4.0 (RFC 6350) for the lead
+func writeVCard(w *bufio.Writer, l *Lead) {
+	line := func(s string) {
+		w.WriteString(foldLine(s))
+	}
+
+	line("BEGIN:VCARD")
+	line("VERSION:4.0")
+	line("UID:urn:uuid:" + uuidFromHex(l.ID))
+	line("FN:" + vcardEscape(strings.TrimSpace(l.FirstName+" "+l.LastName)))
+	line("N:" + vcardEscape(l.LastName) + ";" + vcardEscape(l.FirstName) + ";;;")
+	if l.Email != "" {
+		line("EMAIL;TYPE=work:" + vcardEscape(l.Email))
+	}
+	if l.PhoneNumber != "" {
+		line("TEL;VALUE=text;TYPE=work,voice:" + vcardEscape(l.PhoneNumber))
+	}
+	if l.Locale != "" {
+		line("LANG:" + l.Locale)
+	}
+	var note []string
+	if l.AnnualRevenue != "" {
+		note = append(note, "Annual revenue: "+formatRevenue(l.AnnualRevenue))
+	}
+	if len(l.Services) > 0 {
+		note = append(note, "Services: "+strings.Join(serviceLabels(l), ", "))
+	}
+	if l.Message != "" {
+		note = append(note, l.Message)
+	}
+	if len(note) > 0 {
+		line("NOTE:" + vcardEscape(strings.Join(note, "\n")))
+	}
+	line("REV:" + l.UpdatedAt.UTC().Format("20060102T150405Z"))
+	line("END:VCARD")
+}
+
+// foldLine terminates a vCard or iCalendar content line with CRLF, folding
+// it at 75 octets without splitting UTF-8 sequences
+func foldLine(s string) string {
+	var b strings.Builder
+	for len(s) > 75 {
+		cut := 75
+		for cut > 0 && s[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		b.WriteString(s[:cut] + "\r\n ")
+		s = s[cut:]
+	}
+	b.WriteString(s + "\r\n")
+	return b.String()
+}
+
+// vcardEscape escapes a vCard text value. iCalendar TEXT uses the same rules.
+func vcardEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ",", `\,`, ";", `\;`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// uuidFromHex formats a 32-character hex ID as a UUID
+func uuidFromHex(id string) string {
+	if len(id) != 32 {
+		return id
+	}
+	return id[:8] + "-" + id[8:12] + "-" + id[12:16] + "-" + id[16:20] + "-" + id[20:]
+}
+
+// handleAdminExportLeads streams leads as CSV, NDJSON or vCard, filtered by
+// ?status=, ?from= and ?to=
+func handleAdminExportLeads(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format == "" {
+		format = ExportCSV
+	}
+	ct, ok := exportContentTypes[format]
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "format must be csv, ndjson or vcard"})
+		return
+	}
+	filter, err := parseLeadFilter(q.Get("status"), q.Get("from"), q.Get("to"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", ct[0])
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q",
+		"leads-"+time.Now().UTC().Format("20060102")+"."+ct[1]))
+	w.Header().Set("Cache-Control", "no-store")
+	if err := exportLeads(w, format, filter); err != nil {
+		// Headers are already sent, so all we can do is log and stop
+		log.Printf("Lead export failed: %v", err)
+	}
+}
+
+// runExportLeads writes the same export straight from the store:
+//
+//	go run . export-leads -format csv -status new -from 2026-01-01 > leads.csv
+func runExportLeads(args []string) error {
+	fs := flag.NewFlagSet("export-leads", flag.ExitOnError)
+	format := fs.String("format", ExportCSV, "csv, ndjson or vcard")
+	status := fs.String("status", "", "only leads with this status")
+	from := fs.String("from", "", "only leads created on or after this date (YYYY-MM-DD or RFC 3339)")
+	to := fs.String("to", "", "only leads created on or before this date")
+	out := fs.String("o", "", "output file (default stdout)")
+	fs.Parse(args)
+
+	if _, ok := exportContentTypes[*format]; !ok {
+		return errors.New("format must be csv, ndjson or vcard")
+	}
+	filter, err := parseLeadFilter(*status, *from, *to)
+	if err != nil {
+		return err
+	}
+
+	if keyring, err = loadKeyring(); err != nil {
+		return err
+	}
+	leads, err = openLeadStore(dataDir())
+	if err != nil {
+		return err
+	}
+
+	w := os.Stdout
+	if *out != "" {
+		f, err := os.OpenFile(*out, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return exportLeads(w, *format, filter)
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxMultipartMemory is the amount of a multipart body held in memory
+// before the remainder is spooled to temporary files
+const maxMultipartMemory = 1 << 20
+
+// defaultMaxBodyBytes caps JSON and URL-encoded bodies, which only carry
+// the text fields (the message alone is limited to 2000 characters)
+const defaultMaxBodyBytes = 64 << 10
+
+// defaultContactPath is where native form posts are sent back on failure
+const defaultContactPath = "/contact/"
+
+// errUnsupportedMediaType is returned for bodies that aren't JSON or a form
+var errUnsupportedMediaType = errors.New("unsupported content type")
+
+// errTrailingData is returned when a JSON body has content after the object
+var errTrailingData = errors.New("unexpected data after JSON object")
+
+// maxBodyBytes returns the size limit for non-multipart request bodies
+func maxBodyBytes() int64 {
+	return int64(envInt("CONTACT_MAX_BODY_BYTES", defaultMaxBodyBytes))
+}
+
+// strictJSON reports whether unknown JSON fields should be rejected
+func strictJSON() bool {
+	return envBool("CONTACT_STRICT_JSON", false)
+}
+
+// decodeErrorCode maps a decodeContactForm error to a response status, a
+// stable error code and a short detail for debugging
+func decodeErrorCode(err error) (int, string, string) {
+	var maxBytesErr *http.MaxBytesError
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+
+	switch {
+	case errors.Is(err, errUnsupportedMediaType):
+		return http.StatusUnsupportedMediaType, "unsupported_media_type", err.Error()
+	case errors.As(err, &maxBytesErr):
+		return http.StatusRequestEntityTooLarge, "body_too_large",
+			fmt.Sprintf("request body exceeds %d bytes", maxBytesErr.Limit)
+	case errors.Is(err, errTrailingData):
+		return http.StatusBadRequest, "trailing_data", err.Error()
+	case errors.As(err, &syntaxErr):
+		return http.StatusBadRequest, "invalid_json",
+			fmt.Sprintf("syntax error at offset %d", syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		return http.StatusBadRequest, "invalid_json",
+			fmt.Sprintf("field %q must be %s", typeErr.Field, typeErr.Type)
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return http.StatusBadRequest, "invalid_json", "empty or truncated body"
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no typed error for DisallowUnknownFields
+		field := strings.TrimPrefix(err.Error(), "json: unknown field ")
+		return http.StatusBadRequest, "unknown_field", "unknown field " + field
+	}
+	return http.StatusBadRequest, "invalid_body", err.Error()
+}
+
+// isNativeFormPost reports whether the request is a browser form submission
+// (no JavaScript) rather than a fetch call expecting JSON back
+func isNativeFormPost(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/x-www-form-urlencoded" && mediaType != "multipart/form-data" {
+		return false
+	}
+	return !strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// maxMultipartBytes leaves room for the attachments plus the text fields
+func maxMultipartBytes() int64 {
+	return int64(maxAttachments())*maxAttachmentBytes() + maxMultipartMemory
+}
+
+// formBody is the request body of a public form, posted as JSON by the
+// site's scripts or as a native form without them
+type formBody interface {
+	// readValues fills the body from URL-encoded or multipart form values
+	readValues(values url.Values)
+}
+
+// decodeContactForm decodes the contact form. Unknown JSON fields are only
+// rejected when CONTACT_STRICT_JSON is set.
+func decodeContactForm(w http.ResponseWriter, r *http.Request, form *ContactForm) error {
+	return decodeForm(w, r, form, strictJSON())
+}
+
+// decodeForm decodes a public form from a JSON, URL-encoded or multipart
+// body, negotiating on the Content-Type header. With strict set, unknown
+// JSON fields are rejected.
+func decodeForm(w http.ResponseWriter, r *http.Request, body formBody, strict bool) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		// Treat a missing or malformed Content-Type as JSON, as before
+		mediaType = "application/json"
+	}
+
+	switch mediaType {
+	case "application/json":
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes())
+		dec := json.NewDecoder(r.Body)
+		if strict {
+			dec.DisallowUnknownFields()
+		}
+		if err := dec.Decode(body); err != nil {
+			return err
+		}
+		// A second Decode must hit EOF, otherwise there's trailing data
+		if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				return err
+			}
+			return errTrailingData
+		}
+		return nil
+	case "application/x-www-form-urlencoded":
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes())
+		if err := r.ParseForm(); err != nil {
+			return err
+		}
+	case "multipart/form-data":
+		r.Body = http.MaxBytesReader(w, r.Body, maxMultipartBytes())
+		if err := r.ParseMultipartForm(maxMultipartMemory); err != nil {
+			return err
+		}
+	default:
+		return errUnsupportedMediaType
+	}
+	body.readValues(r.PostForm)
+	return nil
+}
+
+func (form *ContactForm) readValues(values url.Values) {
+	form.FirstName = values.Get("first-name")
+	form.LastName = values.Get("last-name")
+	form.Email = values.Get("email")
+	form.PhoneNumber = values.Get("phone-number")
+	form.AnnualRevenue = values.Get("annual-revenue")
+	form.Services = values["services"]
+	form.Message = values.Get("message")
+	form.Consent, _ = strconv.ParseBool(values.Get("consent"))
+	if values.Get("consent") == "on" {
+		form.Consent = true
+	}
+	form.Locale = values.Get("locale")
+	form.FormGuard.readValues(values)
+}
+
+func (g *FormGuard) readValues(values url.Values) {
+	g.Website = values.Get("website")
+	g.TurnstileResponse = values.Get("cf-turnstile-response")
+	g.HCaptchaResponse = values.Get("h-captcha-response")
+	g.RecaptchaResponse = values.Get("g-recaptcha-response")
+	g.CaptchaResponse = values.Get("captcha-response")
+	g.FormToken = values.Get("form-token")
+}
+
+// contactResponder writes contact endpoint outcomes either as JSON for fetch
+// clients or as 303 redirects for native form posts
+type contactResponder struct {
+	w      http.ResponseWriter
+	r      *http.Request
+	locale string
+	native bool
+}
+
+func newContactResponder(w http.ResponseWriter, r *http.Request, locale string) *contactResponder {
+	c := &contactResponder{w: w, r: r, locale: locale, native: isNativeFormPost(r)}
+	if !c.native {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	return c
+}
+
+// Error responds with a localized error identified by a stable code
+func (c *contactResponder) Error(status int, code string) {
+	c.ErrorDetail(status, code, "")
+}
+
+// ErrorDetail is like Error but includes a non-localized detail string to
+// help debug malformed requests
+func (c *contactResponder) ErrorDetail(status int, code, detail string) {
+	if c.native {
+		query := url.Values{}
+		query.Set("error", translate(c.locale, code))
+		query.Set("code", code)
+		c.redirectBack(query)
+		return
+	}
+
+	c.w.WriteHeader(status)
+	json.NewEncoder(c.w).Encode(ContactResponse{
+		Success: false,
+		Error:   translate(c.locale, code),
+		Code:    code,
+		Detail:  detail,
+	})
+}
+
+// ValidationFailed responds with the per-field validation errors
+func (c *contactResponder) ValidationFailed(errs []ValidationError) {
+	if c.native {
+		query := url.Values{}
+		query.Set("error", translate(c.locale, "validation_failed"))
+		query.Set("code", "validation_failed")
+		for _, e := range errs {
+			query.Add("field", e.Field)
+			query.Add("message", e.Message)
+		}
+		c.redirectBack(query)
+		return
+	}
+
+	c.w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(c.w).Encode(ContactResponse{
+		Success: false,
+		Error:   translate(c.locale, "validation_failed"),
+		Code:    "validation_failed",
+		Errors:  errs,
+	})
+}
+
+// Success responds that the message was sent. Data may be nil when the
+// submission was silently dropped (e.g. the honeypot was filled in). Native
+// posts are redirected with just the first name; a new lead gets the
+// booking cookie instead of IDs in the URL.
+func (c *contactResponder) Success(data *ContactData) {
+	if data != nil && data.LeadID != "" {
+		setLeadBookingCookie(c.w, data.LeadID, time.Now())
+	}
+	if c.native {
+		query := url.Values{}
+		if data != nil && data.FirstName != "" {
+			query.Set("name", data.FirstName)
+		}
+		target := "/success"
+		if len(query) > 0 {
+			target += "?" + query.Encode()
+		}
+		http.Redirect(c.w, c.r, target, http.StatusSeeOther)
+		return
+	}
+
+	c.w.WriteHeader(http.StatusOK)
+	json.NewEncoder(c.w).Encode(ContactResponse{
+		Success: true,
+		Message: translate(c.locale, "message_sent"),
+		Data:    data,
+	})
+}
+
+// Message responds with a localized success message identified by code.
+// Native form posts are sent back to their page with query added.
+func (c *contactResponder) Message(code string, query url.Values) {
+	if c.native {
+		c.redirectBack(query)
+		return
+	}
+
+	c.w.WriteHeader(http.StatusOK)
+	json.NewEncoder(c.w).Encode(ContactResponse{
+		Success: true,
+		Message: translate(c.locale, code),
+	})
+}
+
+// redirectBack sends the visitor back to the page the form was posted from.
+// Only the path of a same-host Referer is used, so this can't be turned
+// into an open redirect.
+func (c *contactResponder) redirectBack(query url.Values) {
+	target := cmp.Or(refererPath(c.r), defaultContactPath)
+	http.Redirect(c.w, c.r, target+"?"+query.Encode(), http.StatusSeeOther)
+}
+
+// refererPath returns the path of a same-host Referer, or ""
+func refererPath(r *http.Request) string {
+	if ref, err := url.Parse(r.Referer()); err == nil && ref.Host == r.Host &&
+		strings.HasPrefix(ref.Path, "/") && !strings.HasPrefix(ref.Path, "//") {
+		return ref.Path
+	}
+	return ""
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeForm(t *testing.T) {
+	values := url.Values{
+		"first-name":     {"Ana"},
+		"last-name":      {"García"},
+		"email":          {"ana@example.com"},
+		"phone-number":   {"5550100199"},
+		"annual-revenue": {"100k-500k"},
+		"services":       {"essentials", "cleanup"},
+		"message":        {"Hola"},
+		"consent":        {"on"},
+		"website":        {""},
+		"form-token":     {"tok"},
+	}
+	var multipartBody bytes.Buffer
+	mw := multipart.NewWriter(&multipartBody)
+	for key, vs := range values {
+		for _, v := range vs {
+			mw.WriteField(key, v)
+		}
+	}
+	mw.Close()
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		strict      bool
+		wantErr     error // nil means decode must succeed
+	}{
+		{"urlencoded", "application/x-www-form-urlencoded", values.Encode(), false, nil},
+		{"multipart", mw.FormDataContentType(), multipartBody.String(), false, nil},
+		{"json", "application/json", `{"first-name":"Ana","last-name":"García","email":"ana@example.com","phone-number":"5550100199","annual-revenue":"100k-500k","services":["essentials","cleanup"],"message":"Hola","consent":true,"form-token":"tok"}`, true, nil},
+		{"missing content type is json", "", `{"first-name":"Ana","last-name":"García","email":"ana@example.com","phone-number":"5550100199","annual-revenue":"100k-500k","services":["essentials","cleanup"],"message":"Hola","consent":true,"form-token":"tok"}`, false, nil},
+		{"trailing data", "application/json", `{"email":"a@b.co"} {}`, false, errTrailingData},
+		{"unsupported type", "text/plain", "email=a@b.co", false, errUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/api/contact", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				r.Header.Set("Content-Type", tt.contentType)
+			}
+			var form ContactForm
+			err := decodeForm(httptest.NewRecorder(), r, &form, tt.strict)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("decodeForm error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeForm: %v", err)
+			}
+			if form.FirstName != "Ana" || form.LastName != "García" || form.Email != "ana@example.com" ||
+				form.AnnualRevenue != "100k-500k" || form.Message != "Hola" || !form.Consent || form.FormToken != "tok" {
+				t.Errorf("decoded %+v", form)
+			}
+			if !slices.Equal(form.Services, []string{"essentials", "cleanup"}) {
+				t.Errorf("services = %q", form.Services)
+			}
+		})
+	}
+}
+
+func TestDecodeFormStrictRejectsUnknownFields(t *testing.T) {
+	r := httptest.NewRequest("POST", "/api/contact", strings.NewReader(`{"email":"a@b.co","admin":true}`))
+	r.Header.Set("Content-Type", "application/json")
+	var form ContactForm
+	err := decodeForm(httptest.NewRecorder(), r, &form, true)
+	if _, code, _ := decodeErrorCode(err); code != "unknown_field" {
+		t.Fatalf("decodeForm error = %v (%s), want unknown_field", err, code)
+	}
+}
+
+func TestContactResponderSuccess(t *testing.T) {
+	bookingSigner = &BookingLinkSigner{secret: []byte("test")}
+	data := &ContactData{FirstName: "Ana", Email: "ana@example.com", LeadID: "abc123"}
+
+	tests := []struct {
+		name         string
+		contentType  string
+		accept       string
+		wantStatus   int
+		wantLocation string
+	}{
+		{"native post", "application/x-www-form-urlencoded", "text/html", http.StatusSeeOther, "/success?name=Ana"},
+		{"fetch", "application/json", "application/json", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/api/contact", nil)
+			r.Header.Set("Content-Type", tt.contentType)
+			r.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+			newContactResponder(w, r, "en").Success(data)
+
+			resp := w.Result()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if got := resp.Header.Get("Location"); got != tt.wantLocation {
+				t.Errorf("Location = %q, want %q", got, tt.wantLocation)
+			}
+			if body := w.Body.String(); strings.Contains(body, "abc123") {
+				t.Errorf("response body leaks the lead ID: %s", body)
+			}
+
+			// The lead and its booking token travel in the cookie only
+			cookies := resp.Cookies()
+			if len(cookies) != 1 || cookies[0].Name != leadBookingCookie || !cookies[0].HttpOnly || cookies[0].Path != "/api/booking" {
+				t.Fatalf("cookies = %+v", cookies)
+			}
+			booking := httptest.NewRequest("POST", "/api/booking", nil)
+			booking.AddCookie(cookies[0])
+			leadID, token := leadBookingFromCookie(booking)
+			if leadID != "abc123" || bookingSigner.VerifyLead(leadID, token, time.Now()) != nil {
+				t.Errorf("cookie does not carry a valid token for the lead: %q %q", leadID, token)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Form token defaults, overridable via environment
+const (
+	defaultFormTokenTTL     = time.Hour
+	defaultFormTokenMinFill = 3 * time.Second
+	defaultMaxNonces        = 50000
+)
+
+// nativePostTokenScore is what a native form post without a token scores
+// when tokens are required. It's well below the quarantine threshold, so it
+// only tips a submission over together with other signals.
+const nativePostTokenScore = 2
+
+// Form token errors
+var (
+	errFormTokenInvalid = errors.New("invalid form token")
+	errFormTokenExpired = errors.New("form token expired")
+	errNonceReplayed    = errors.New("token replayed")
+	errNonceStoreFull   = errors.New("too many outstanding tokens")
+)
+
+// FormTokenIssuer issues and verifies HMAC-signed form-render tokens. Each
+// token embeds its issue time and a random nonce; a nonce can only be
+// redeemed once.
+type FormTokenIssuer struct {
+	secret  []byte
+	ttl     time.Duration
+	minFill time.Duration
+	nonces  *nonceStore
+}
+
+// formTokens is the process-wide token issuer, built in main
+var formTokens *FormTokenIssuer
+
+// newFormTokenIssuer builds the issuer from environment config. Without
+// FORM_TOKEN_SECRET a random key is used, so tokens don't survive restarts.
+func newFormTokenIssuer() *FormTokenIssuer {
+	secret := []byte(os.Getenv("FORM_TOKEN_SECRET"))
+	if len(secret) == 0 {
+		log.Println("FORM_TOKEN_SECRET not set, using a random key (tokens reset on restart)")
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	}
+	ttl := time.Duration(envInt("FORM_TOKEN_TTL_MINUTES", int(defaultFormTokenTTL/time.Minute))) * time.Minute
+	return &FormTokenIssuer{
+		secret:  secret,
+		ttl:     ttl,
+		minFill: time.Duration(envInt("FORM_TOKEN_MIN_FILL_SECONDS", int(defaultFormTokenMinFill/time.Second))) * time.Second,
+		nonces:  newNonceStore(envInt("FORM_TOKEN_MAX_NONCES", defaultMaxNonces)),
+	}
+}
+
+// Issue returns a new token issued at now
+func (f *FormTokenIssuer) Issue(now time.Time) string {
+	payload := make([]byte, 8+16)
+	binary.BigEndian.PutUint64(payload, uint64(now.UnixMilli()))
+	rand.Read(payload[8:])
+	enc := base64.RawURLEncoding
+	return enc.EncodeToString(payload) + "." + enc.EncodeToString(f.sign(payload))
+}
+
+// Verify checks the token's signature and expiry and returns its issue time
+// and nonce. It does not consume the nonce.
+func (f *FormTokenIssuer) Verify(token string, now time.Time) (time.Time, string, error) {
+	payload, err := f.payload(token)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	issued := time.UnixMilli(int64(binary.BigEndian.Uint64(payload)))
+	if now.Sub(issued) > f.ttl || issued.After(now.Add(time.Minute)) {
+		return issued, "", errFormTokenExpired
+	}
+	return issued, hex.EncodeToString(payload[8:]), nil
+}
+
+// CData returns the customer data the CAPTCHA widget is bound to for the
+// token: a keyed hash of its nonce, so it can't be chosen by the client and
+// a solved challenge only counts for the form it was rendered on. It
+// returns "" for a token that isn't validly signed.
+func (f *FormTokenIssuer) CData(token string) string {
+	payload, err := f.payload(token)
+	if err != nil {
+		return ""
+	}
+	mac := hmac.New(sha256.New, f.secret)
+	mac.Write([]byte("cdata|"))
+	mac.Write(payload[8:])
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// payload returns the signed payload of a token: the issue time in
+// milliseconds followed by the nonce
+func (f *FormTokenIssuer) payload(token string) ([]byte, error) {
+	enc := base64.RawURLEncoding
+	encPayload, encSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, errFormTokenInvalid
+	}
+	payload, err := enc.DecodeString(encPayload)
+	if err != nil || len(payload) != 24 {
+		return nil, errFormTokenInvalid
+	}
+	sig, err := enc.DecodeString(encSig)
+	if err != nil || !hmac.Equal(sig, f.sign(payload)) {
+		return nil, errFormTokenInvalid
+	}
+	return payload, nil
+}
+
+func (f *FormTokenIssuer) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, f.secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// nonceStore remembers redeemed nonces until their tokens expire. It holds
+// at most max entries. Only expired entries are ever dropped, since a
+// forgotten nonce could be replayed; when it's full of live ones, new
+// nonces are refused.
+type nonceStore struct {
+	mu   sync.Mutex
+	max  int
+	seen map[string]time.Time // nonce -> token expiry
+}
+
+func newNonceStore(max int) *nonceStore {
+	return &nonceStore{max: max, seen: make(map[string]time.Time)}
+}
+
+// Redeem records the nonce, failing with errNonceReplayed if it was
+// already used or errNonceStoreFull if there's no room for it
+func (s *nonceStore) Redeem(nonce string, expires, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if exp, ok := s.seen[nonce]; ok && exp.After(now) {
+		return errNonceReplayed
+	}
+	if len(s.seen) >= s.max {
+		for n, exp := range s.seen {
+			if !exp.After(now) {
+				delete(s.seen, n)
+			}
+		}
+		if len(s.seen) >= s.max {
+			return errNonceStoreFull
+		}
+	}
+	s.seen[nonce] = expires
+	return nil
+}
+
+// handleContactToken issues a form-render token for the contact form, with
+// the cdata to render the Turnstile widget with
+func handleContactToken(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	token := formTokens.Issue(now)
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]any{
+		"token":     token,
+		"cdata":     formTokens.CData(token),
+		"expiresAt": now.Add(formTokens.ttl).UTC(),
+	})
+}
+
+// formTokenCheck enforces the form-render token: it must be validly signed,
+// unexpired, older than the minimum fill time and not previously redeemed.
+// With FORM_TOKEN_REQUIRED a missing token is rejected on JavaScript
+// submissions but only scores nativePostTokenScore on a native form post,
+// since the token is fetched by the page's script and no-JS visitors never
+// get one. Otherwise a missing token passes.
+type formTokenCheck struct {
+	issuer   *FormTokenIssuer
+	required bool
+}
+
+func (formTokenCheck) Name() string { return "form-token" }
+
+func (c formTokenCheck) Check(ctx context.Context, sub *Submission) (SpamSignal, error) {
+	token := sub.Form.FormToken
+	if token == "" {
+		switch {
+		case !c.required:
+			return SpamSignal{}, nil
+		case isNativeFormPost(sub.Request):
+			return SpamSignal{Score: nativePostTokenScore, Reason: "missing token on a native form post"}, nil
+		}
+		return SpamSignal{Score: defaultSpamRejectScore, Reason: "missing token", Reject: true, Code: "form_token_required"}, nil
+	}
+
+	issued, nonce, err := c.issuer.Verify(token, sub.Now)
+	if err != nil {
+		return SpamSignal{Score: defaultSpamRejectScore, Reason: err.Error(), Reject: true, Code: "form_token_invalid"}, nil
+	}
+
+	elapsed := sub.Now.Sub(issued)
+	if elapsed < c.issuer.minFill {
+		return SpamSignal{
+			Score:  defaultSpamRejectScore,
+			Reason: fmt.Sprintf("submitted %s after render", elapsed.Round(time.Millisecond)),
+			Reject: true,
+		}, nil
+	}
+
+	switch err := c.issuer.nonces.Redeem(nonce, issued.Add(c.issuer.ttl), sub.Now); {
+	case errors.Is(err, errNonceStoreFull):
+		log.Printf("Form token nonce store is full (%d live tokens), refusing new tokens", c.issuer.nonces.max)
+		return SpamSignal{Score: defaultSpamRejectScore, Reason: err.Error(), Reject: true, Code: "form_token_invalid"}, nil
+	case err != nil:
+		return SpamSignal{Score: defaultSpamRejectScore, Reason: err.Error(), Reject: true}, nil
+	}
+	return SpamSignal{}, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testFormTokenIssuer(maxNonces int) *FormTokenIssuer {
+	return &FormTokenIssuer{
+		secret:  []byte("test-secret"),
+		ttl:     time.Hour,
+		minFill: 3 * time.Second,
+		nonces:  newNonceStore(maxNonces),
+	}
+}
+
+func TestFormTokenCheck(t *testing.T) {
+	issued := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	issuer := testFormTokenIssuer(100)
+	good := issuer.Issue(issued)
+	otherIssuer := testFormTokenIssuer(100)
+	otherIssuer.secret = []byte("other-secret")
+
+	tests := []struct {
+		name       string
+		required   bool
+		native     bool
+		token      string
+		at         time.Time
+		wantScore  int
+		wantReject bool
+		wantCode   string
+	}{
+		{"valid token", true, false, good, issued.Add(time.Minute), 0, false, ""},
+		{"missing, required, fetch", true, false, "", issued, defaultSpamRejectScore, true, "form_token_required"},
+		{"missing, required, native post", true, true, "", issued, nativePostTokenScore, false, ""},
+		{"missing, optional, fetch", false, false, "", issued, 0, false, ""},
+		{"missing, optional, native post", false, true, "", issued, 0, false, ""},
+		{"filled too fast", true, false, issuer.Issue(issued), issued.Add(time.Second), defaultSpamRejectScore, true, ""},
+		{"expired", true, false, issuer.Issue(issued), issued.Add(2 * time.Hour), defaultSpamRejectScore, true, "form_token_invalid"},
+		{"forged signature", true, false, otherIssuer.Issue(issued), issued.Add(time.Minute), defaultSpamRejectScore, true, "form_token_invalid"},
+		{"malformed", true, false, "not-a-token", issued.Add(time.Minute), defaultSpamRejectScore, true, "form_token_invalid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/contact", strings.NewReader(""))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.native {
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				req.Header.Set("Accept", "text/html")
+			}
+			check := formTokenCheck{issuer: issuer, required: tt.required}
+			signal, err := check.Check(context.Background(), &Submission{
+				Form:    &ContactForm{FormGuard: FormGuard{FormToken: tt.token}},
+				Request: req,
+				Now:     tt.at,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if signal.Score != tt.wantScore || signal.Reject != tt.wantReject || signal.Code != tt.wantCode {
+				t.Errorf("got score %d reject %v code %q, want %d %v %q (%s)",
+					signal.Score, signal.Reject, signal.Code, tt.wantScore, tt.wantReject, tt.wantCode, signal.Reason)
+			}
+		})
+	}
+}
+
+func TestFormTokenReplay(t *testing.T) {
+	issued := time.Now()
+	issuer := testFormTokenIssuer(100)
+	check := formTokenCheck{issuer: issuer, required: true}
+	sub := &Submission{
+		Form:    &ContactForm{FormGuard: FormGuard{FormToken: issuer.Issue(issued)}},
+		Request: httptest.NewRequest("POST", "/api/contact", nil),
+		Now:     issued.Add(10 * time.Second),
+	}
+
+	if signal, _ := check.Check(context.Background(), sub); signal.Score != 0 {
+		t.Fatalf("first use scored %+v", signal)
+	}
+	sub.Now = sub.Now.Add(time.Minute)
+	if signal, _ := check.Check(context.Background(), sub); !signal.Reject {
+		t.Fatalf("replayed token accepted: %+v", signal)
+	}
+}
+
+func TestNonceStore(t *testing.T) {
+	now := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	s := newNonceStore(2)
+
+	if err := s.Redeem("a", now.Add(time.Hour), now); err != nil {
+		t.Fatalf("Redeem(a) = %v", err)
+	}
+	if err := s.Redeem("a", now.Add(time.Hour), now); !errors.Is(err, errNonceReplayed) {
+		t.Fatalf("second Redeem(a) = %v, want errNonceReplayed", err)
+	}
+	if err := s.Redeem("b", now.Add(time.Minute), now); err != nil {
+		t.Fatalf("Redeem(b) = %v", err)
+	}
+
+	// Full of live nonces: refuse rather than forget one that could be replayed
+	if err := s.Redeem("c", now.Add(time.Hour), now); !errors.Is(err, errNonceStoreFull) {
+		t.Fatalf("Redeem(c) on a full store = %v, want errNonceStoreFull", err)
+	}
+	if err := s.Redeem("a", now.Add(time.Hour), now.Add(30*time.Minute)); !errors.Is(err, errNonceReplayed) {
+		t.Fatalf("live nonce a was evicted: %v", err)
+	}
+
+	// Once b expires its slot frees up, and a is still remembered
+	later := now.Add(2 * time.Minute)
+	if err := s.Redeem("c", later.Add(time.Hour), later); err != nil {
+		t.Fatalf("Redeem(c) after b expired = %v", err)
+	}
+	if err := s.Redeem("a", now.Add(time.Hour), later); !errors.Is(err, errNonceReplayed) {
+		t.Fatalf("Redeem(a) after eviction = %v, want errNonceReplayed", err)
+	}
+}
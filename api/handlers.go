@@ -1,144 +1,74 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
-	"io"
+	"errors"
 	"log"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 )
 
-// TurnstileResponse represents Cloudflare's siteverify response
-type TurnstileResponse struct {
-	Success     bool     `json:"success"`
-	ErrorCodes  []string `json:"error-codes,omitempty"`
-	ChallengeTS string   `json:"challenge_ts,omitempty"`
-	Hostname    string   `json:"hostname,omitempty"`
-}
-
-// verifyTurnstile verifies the Turnstile token with Cloudflare
-func verifyTurnstile(token, secretKey, remoteIP string) (bool, error) {
-	if secretKey == "" {
-		log.Println("TURNSTILE_SECRET_KEY not set, skipping verification")
-		return true, nil
-	}
-
-	payload := map[string]string{
-		"secret":   secretKey,
-		"response": token,
-	}
-	if remoteIP != "" {
-		payload["remoteip"] = remoteIP
-	}
-
-	jsonPayload, err := json.Marshal(payload)
-	if err != nil {
-		return false, err
-	}
-
-	resp, err := http.Post(
-		"https://challenges.cloudflare.com/turnstile/v0/siteverify",
-		"application/json",
-		bytes.NewBuffer(jsonPayload),
-	)
-	if err != nil {
-		return false, err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return false, err
-	}
-
-	var result TurnstileResponse
-	if err := json.Unmarshal(body, &result); err != nil {
-		return false, err
-	}
-
-	if !result.Success {
-		log.Printf("Turnstile verification failed: %v", result.ErrorCodes)
-	}
-
-	return result.Success, nil
-}
-
 // ContactResponse represents the response from the contact endpoint
 type ContactResponse struct {
 	Success bool              `json:"success"`
 	Message string            `json:"message,omitempty"`
 	Error   string            `json:"error,omitempty"`
+	Code    string            `json:"code,omitempty"`
+	Detail  string            `json:"detail,omitempty"`
 	Errors  []ValidationError `json:"errors,omitempty"`
 	Data    *ContactData      `json:"data,omitempty"`
 }
 
-// ContactData contains data to pass back to the client
+// ContactData contains data to pass back to the client. A new lead's ID
+// goes back in the booking cookie rather than the body.
 type ContactData struct {
 	FirstName string `json:"firstName"`
 	Email     string `json:"email"`
+	LeadID    string `json:"-"`
 }
 
 func handleContact(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+	// Until the body is parsed, only Accept-Language is available
+	locale := negotiateLocale("", r.Header.Get("Accept-Language"))
+	resp := newContactResponder(w, r, locale)
 
-	// Parse request body
+	// Parse request body (JSON, or a native form post without JavaScript)
 	var form ContactForm
-	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
-		log.Printf("Failed to decode request body: %v", err)
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ContactResponse{
-			Success: false,
-			Error:   "Invalid request body",
-		})
+	if err := decodeContactForm(w, r, &form); err != nil {
+		status, code, detail := decodeErrorCode(err)
+		log.Printf("Failed to decode request body (%s): %v", code, err)
+		resp.ErrorDetail(status, code, detail)
 		return
 	}
 
-	// Check honeypot field - if filled, it's a bot
-	// Return fake success to not alert the bot
-	if strings.TrimSpace(form.Website) != "" {
-		log.Printf("Honeypot triggered - likely bot submission from IP: %s", r.RemoteAddr)
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(ContactResponse{
-			Success: true,
-			Message: "Message sent successfully",
-		})
-		return
-	}
+	locale = negotiateLocale(form.Locale, r.Header.Get("Accept-Language"))
+	form.Locale = locale
+	resp.locale = locale
+	w.Header().Set("Content-Language", locale)
 
-	// Verify Turnstile token
-	turnstileSecret := os.Getenv("TURNSTILE_SECRET_KEY")
-	if form.TurnstileResponse == "" && turnstileSecret != "" {
-		log.Printf("Missing Turnstile token from IP: %s", r.RemoteAddr)
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ContactResponse{
-			Success: false,
-			Error:   "Please complete the security check",
-		})
+	// Score the submission (honeypot, Turnstile, links, blocklist, repeats)
+	remoteIP := clientIP(r)
+	verdict, err := spamPipeline.Evaluate(r.Context(), &Submission{
+		Form:     &form,
+		Request:  r,
+		RemoteIP: remoteIP,
+		Now:      time.Now(),
+	})
+	if err != nil {
+		log.Printf("Spam check error: %v", err)
+		resp.Error(http.StatusInternalServerError, "captcha_error")
 		return
 	}
-
-	if turnstileSecret != "" {
-		verified, err := verifyTurnstile(form.TurnstileResponse, turnstileSecret, r.RemoteAddr)
-		if err != nil {
-			log.Printf("Turnstile verification error: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(ContactResponse{
-				Success: false,
-				Error:   "Security verification failed. Please try again.",
-			})
-			return
-		}
-		if !verified {
-			log.Printf("Turnstile verification failed for IP: %s", r.RemoteAddr)
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(ContactResponse{
-				Success: false,
-				Error:   "Security check failed. Please try again.",
-			})
+	if verdict.Decision == SpamReject {
+		log.Printf("Rejected likely spam from IP %s: %v", remoteIP, verdict.Reasons())
+		if code := verdict.RejectCode(); code != "" {
+			resp.Error(http.StatusBadRequest, code)
 			return
 		}
+		// Return fake success to not alert the bot
+		resp.Success(nil)
+		return
 	}
 
 	// Trim whitespace from all string fields
@@ -150,15 +80,10 @@ func handleContact(w http.ResponseWriter, r *http.Request) {
 	form.Message = strings.TrimSpace(form.Message)
 
 	// Validate form
-	validationResult := form.Validate()
+	validationResult := form.Validate(locale)
 	if !validationResult.Valid {
 		log.Printf("Validation failed: %+v", validationResult.Errors)
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ContactResponse{
-			Success: false,
-			Error:   "Validation failed",
-			Errors:  validationResult.Errors,
-		})
+		resp.ValidationFailed(validationResult.Errors)
 		return
 	}
 
@@ -170,41 +95,155 @@ func handleContact(w http.ResponseWriter, r *http.Request) {
 	if postmarkToken == "" || postmarkTo == "" || postmarkFrom == "" {
 		log.Printf("Missing email configuration: token=%v, to=%v, from=%v",
 			postmarkToken != "", postmarkTo != "", postmarkFrom != "")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ContactResponse{
-			Success: false,
-			Error:   "Server configuration error",
+		resp.Error(http.StatusInternalServerError, "server_config")
+		return
+	}
+
+	// Check and store any uploaded files (multipart submissions only)
+	if r.MultipartForm != nil {
+		files := r.MultipartForm.File["attachments"]
+		if err := checkAttachments(files); err != nil {
+			log.Printf("Rejected attachments from IP %s: %v", r.RemoteAddr, err)
+			switch {
+			case errors.Is(err, errTooManyAttachments):
+				resp.Error(http.StatusBadRequest, "attachment_too_many")
+			case errors.Is(err, errAttachmentTooLarge):
+				resp.Error(http.StatusRequestEntityTooLarge, "attachment_too_large")
+			case errors.Is(err, errAttachmentForbidden):
+				resp.Error(http.StatusUnsupportedMediaType, "attachment_type")
+			default:
+				resp.Error(http.StatusBadRequest, "invalid_body")
+			}
+			return
+		}
+		attachments, err := storeAttachments(files)
+		if err != nil {
+			log.Printf("Failed to store attachments: %v", err)
+			resp.Error(http.StatusInternalServerError, "send_failed")
+			return
+		}
+		form.Attachments = attachments
+	}
+
+	// Hold suspicious submissions for admin review instead of emailing them
+	if verdict.Decision == SpamQuarantine {
+		lead := newLead(&form, LeadQuarantined)
+		lead.SpamScore = verdict.Score
+		lead.SpamReasons = verdict.Reasons()
+		lead.RemoteIP = remoteIP
+		scoring.Prioritize(lead)
+		if err := leads.Create(lead); err != nil {
+			log.Printf("Failed to store quarantined lead: %v", err)
+			resp.Error(http.StatusInternalServerError, "send_failed")
+			return
+		}
+		log.Printf("Quarantined lead %s from IP %s: %v", lead.ID, remoteIP, verdict.Reasons())
+		resp.Success(&ContactData{
+			FirstName: form.FirstName,
+			Email:     form.Email,
 		})
 		return
 	}
 
-	// Send notification email to business
-	if err := SendContactFormEmail(&form, postmarkToken, postmarkTo, postmarkFrom); err != nil {
-		log.Printf("Failed to send contact form email: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ContactResponse{
-			Success: false,
-			Error:   "Failed to send message. Please try again.",
+	// A prospect who already submitted recently is merged into their
+	// existing lead and announced as returning rather than new
+	now := time.Now().UTC()
+	if existing := leads.FindDuplicate(form.Email, form.PhoneNumber, now.Add(-dedupWindow())); existing != nil {
+		merged := existing.clone()
+		merged.Merge(&form, remoteIP, now)
+		scoring.Prioritize(merged)
+		notice := merged.ContactForm()
+		notice.Attachments = form.Attachments // only forward the new files
+		opts := NotifyOptions{
+			Priority:    merged.Priority,
+			Returning:   true,
+			Submissions: len(merged.Interactions) + 1,
+			FirstSeen:   merged.CreatedAt,
+		}
+		thankYouID, err := deliverLead(notice, existing.ID, postmarkToken, postmarkTo, postmarkFrom, opts)
+		if err != nil {
+			log.Printf("Failed to send contact form email: %v", err)
+			resp.Error(http.StatusInternalServerError, "send_failed")
+			return
+		}
+		lead, err := leads.Update(existing.ID, func(l *Lead) error {
+			l.Merge(&form, remoteIP, now)
+			scoring.Prioritize(l)
+			l.trackEmail(EmailThankYou, translate(locale, "thankyou.subject"), thankYouID)
+			return nil
 		})
+		if err != nil {
+			log.Printf("Failed to merge into lead %s: %v", existing.ID, err)
+		} else {
+			webhooks.Enqueue(EventLeadUpdated, lead)
+		}
+		log.Printf("Returning lead %s: %s %s <%s> (%s)", existing.ID, form.FirstName, form.LastName, form.Email, locale)
+		resp.Success(&ContactData{FirstName: form.FirstName, Email: form.Email})
 		return
 	}
 
-	// Send thank you email to customer
-	if err := SendThankYouEmail(&form, postmarkToken, postmarkFrom); err != nil {
-		// Log the error but don't fail the request
-		log.Printf("Failed to send thank you email: %v", err)
+	lead := newLead(&form, LeadNew)
+	lead.SpamScore = verdict.Score
+	lead.SpamReasons = verdict.Reasons()
+	lead.RemoteIP = remoteIP
+	scoring.Prioritize(lead)
+
+	thankYouID, err := deliverLead(&form, lead.ID, postmarkToken, postmarkTo, postmarkFrom, NotifyOptions{Priority: lead.Priority})
+	if err != nil {
+		log.Printf("Failed to send contact form email: %v", err)
+		resp.Error(http.StatusInternalServerError, "send_failed")
+		return
 	}
+	lead.trackEmail(EmailThankYou, translate(locale, "thankyou.subject"), thankYouID)
 
-	log.Printf("Contact form submitted successfully: %s %s <%s>",
-		form.FirstName, form.LastName, form.Email)
+	// The email went out, so a storage failure here only loses the record
+	if err := leads.Create(lead); err != nil {
+		log.Printf("Failed to store lead %s: %v", lead.ID, err)
+	}
+	leadAccepted(lead)
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(ContactResponse{
-		Success: true,
-		Message: "Message sent successfully",
-		Data: &ContactData{
-			FirstName: form.FirstName,
-			Email:     form.Email,
-		},
+	log.Printf("Contact form submitted successfully: %s %s <%s> (%s, %s priority)",
+		form.FirstName, form.LastName, form.Email, locale, lead.Priority)
+
+	resp.Success(&ContactData{
+		FirstName: form.FirstName,
+		Email:     form.Email,
+		LeadID:    lead.ID,
 	})
 }
+
+// Default window in which a repeat submission is merged into the earlier lead
+const defaultDedupWindow = 30 * 24 * time.Hour
+
+// dedupWindow returns the LEAD_DEDUP_WINDOW_HOURS setting; 0 disables merging
+func dedupWindow() time.Duration {
+	return time.Duration(envInt("LEAD_DEDUP_WINDOW_HOURS", int(defaultDedupWindow/time.Hour))) * time.Hour
+}
+
+// leadAccepted fires the integrations for a lead that reached the business,
+// either directly or on release from quarantine
+func leadAccepted(lead *Lead) {
+	webhooks.Enqueue(EventLeadCreated, lead)
+	scheduler.StartNurture(lead)
+}
+
+// deliverLead sends the notification email to the business and the thank
+// you email to the customer, returning the thank you email's MessageID.
+// Only the notification is required to succeed. High-priority leads are
+// also routed to HIGH_PRIORITY_NOTIFY_TO. Replies to the thank you email
+// are threaded into the lead with leadID.
+func deliverLead(form *ContactForm, leadID, token, to, from string, opts NotifyOptions) (string, error) {
+	if extra := priorityRecipients(opts.Priority); len(extra) > 0 {
+		to = strings.Join(append([]string{to}, extra...), ", ")
+	}
+	if err := SendContactFormEmail(form, token, to, from, opts); err != nil {
+		return "", err
+	}
+
+	id, err := SendThankYouEmail(form, token, from, leadReplyAddress(leadID))
+	if err != nil {
+		// Log the error but don't fail the request
+		log.Printf("Failed to send thank you email: %v", err)
+	}
+	return id, nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// defaultHubSpotURL is the HubSpot API origin; HUBSPOT_API_URL overrides it
+// to point at a mock server
+const defaultHubSpotURL = "https://api.hubapi.com"
+
+// hubSpotAdapter syncs leads to HubSpot contacts and deals using a private
+// app token
+type hubSpotAdapter struct {
+	baseURL          string
+	token            string
+	revenueProperty  string
+	servicesProperty string
+	pipeline         string
+	dealStage        string
+	client           *http.Client
+}
+
+// newHubSpotAdapter builds the adapter, or returns nil if HUBSPOT_TOKEN isn't set.
+// HUBSPOT_REVENUE_PROPERTY and HUBSPOT_SERVICES_PROPERTY name the contact
+// properties AnnualRevenue and Services are written to; empty skips them.
+func newHubSpotAdapter() *hubSpotAdapter {
+	token := os.Getenv("HUBSPOT_TOKEN")
+	if token == "" {
+		return nil
+	}
+	a := &hubSpotAdapter{
+		baseURL:          strings.TrimRight(os.Getenv("HUBSPOT_API_URL"), "/"),
+		token:            token,
+		revenueProperty:  os.Getenv("HUBSPOT_REVENUE_PROPERTY"),
+		servicesProperty: os.Getenv("HUBSPOT_SERVICES_PROPERTY"),
+		pipeline:         os.Getenv("HUBSPOT_PIPELINE"),
+		dealStage:        os.Getenv("HUBSPOT_DEAL_STAGE"),
+		client:           &http.Client{Timeout: 15 * time.Second},
+	}
+	if a.baseURL == "" {
+		a.baseURL = defaultHubSpotURL
+	}
+	if a.pipeline == "" {
+		a.pipeline = "default"
+	}
+	if a.dealStage == "" {
+		a.dealStage = "appointmentscheduled"
+	}
+	return a
+}
+
+// hubSpotObject is the request and response shape of the CRM objects API
+type hubSpotObject struct {
+	ID           string               `json:"id,omitempty"`
+	Properties   map[string]string    `json:"properties"`
+	Associations []hubSpotAssociation `json:"associations,omitempty"`
+}
+
+type hubSpotAssociation struct {
+	To    hubSpotRef               `json:"to"`
+	Types []hubSpotAssociationType `json:"types"`
+}
+
+type hubSpotRef struct {
+	ID string `json:"id"`
+}
+
+type hubSpotAssociationType struct {
+	Category string `json:"associationCategory"`
+	TypeID   int    `json:"associationTypeId"`
+}
+
+// Default association type for deal to contact
+const hubSpotDealToContact = 3
+
+func (a *hubSpotAdapter) header() http.Header {
+	return http.Header{"Authorization": {"Bearer " + a.token}}
+}
+
+func (a *hubSpotAdapter) Sync(ctx context.Context, lead *Lead, ref CRMRef) (CRMRef, int, error) {
+	contact := map[string]string{
+		"email":     lead.Email,
+		"firstname": lead.FirstName,
+		"lastname":  lead.LastName,
+		"phone":     lead.PhoneNumber,
+	}
+	if a.revenueProperty != "" {
+		contact[a.revenueProperty] = formatRevenue(lead.AnnualRevenue)
+	}
+	if a.servicesProperty != "" {
+		// Multi-checkbox properties take internal values joined with ";"
+		contact[a.servicesProperty] = strings.Join(lead.Services, ";")
+	}
+
+	// Match an existing contact by email if we haven't synced this lead yet
+	if ref.ContactID == "" {
+		id, status, err := a.findContact(ctx, lead.Email)
+		if err != nil {
+			return ref, status, err
+		}
+		ref.ContactID = id
+	}
+
+	if status, err := a.upsert(ctx, "contacts", &ref.ContactID, contact, nil, nil); err != nil {
+		return ref, status, err
+	}
+
+	deal := map[string]string{"dealname": dealTitle(lead)}
+	// The stage is only set on creation; it may have moved since
+	newDeal := map[string]string{"pipeline": a.pipeline, "dealstage": a.dealStage}
+	assoc := hubSpotAssociation{
+		To:    hubSpotRef{ID: ref.ContactID},
+		Types: []hubSpotAssociationType{{Category: "HUBSPOT_DEFINED", TypeID: hubSpotDealToContact}},
+	}
+	status, err := a.upsert(ctx, "deals", &ref.DealID, deal, newDeal, []hubSpotAssociation{assoc})
+	return ref, status, err
+}
+
+// upsert updates the object with *id, or creates it if *id is empty or the
+// object was deleted in HubSpot, storing the new ID in *id. createProps and
+// assoc are only sent on creation.
+func (a *hubSpotAdapter) upsert(ctx context.Context, objectType string, id *string, props, createProps map[string]string, assoc []hubSpotAssociation) (int, error) {
+	base := a.baseURL + "/crm/v3/objects/" + objectType
+	if *id != "" {
+		status, err := crmRequest(ctx, a.client, "PATCH", base+"/"+*id, a.header(), hubSpotObject{Properties: props}, nil)
+		if !isCRMNotFound(err) {
+			return status, err
+		}
+	}
+	all := make(map[string]string, len(props)+len(createProps))
+	maps.Copy(all, props)
+	maps.Copy(all, createProps)
+	var created hubSpotObject
+	status, err := crmRequest(ctx, a.client, "POST", base, a.header(), hubSpotObject{Properties: all, Associations: assoc}, &created)
+	if err != nil {
+		return status, err
+	}
+	*id = created.ID
+	return status, nil
+}
+
+// findContact returns the ID of the contact with the given email, or ""
+func (a *hubSpotAdapter) findContact(ctx context.Context, email string) (string, int, error) {
+	search := map[string]any{
+		"filterGroups": []any{map[string]any{
+			"filters": []any{map[string]string{"propertyName": "email", "operator": "EQ", "value": email}},
+		}},
+		"limit": 1,
+	}
+	var result struct {
+		Results []hubSpotObject `json:"results"`
+	}
+	status, err := crmRequest(ctx, a.client, "POST", a.baseURL+"/crm/v3/objects/contacts/search", a.header(), search, &result)
+	if err != nil || len(result.Results) == 0 {
+		return "", status, err
+	}
+	return result.Results[0].ID, status, nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+// hubSpotAt returns an adapter for the HubSpot API at baseURL
+func hubSpotAt(t *testing.T, baseURL string) *hubSpotAdapter {
+	t.Helper()
+	t.Setenv("HUBSPOT_TOKEN", "pat-test")
+	t.Setenv("HUBSPOT_API_URL", baseURL+"/")
+	t.Setenv("HUBSPOT_REVENUE_PROPERTY", "annual_revenue_range")
+	t.Setenv("HUBSPOT_SERVICES_PROPERTY", "services_interested")
+	t.Setenv("HUBSPOT_PIPELINE", "")
+	t.Setenv("HUBSPOT_DEAL_STAGE", "")
+	return newHubSpotAdapter()
+}
+
+func TestHubSpotCreatesContactAndDeal(t *testing.T) {
+	server := newFakeCRM(t, map[string]crmResponse{
+		"POST /crm/v3/objects/contacts/search": {body: `{"total":0,"results":[]}`},
+		"POST /crm/v3/objects/contacts":        {body: `{"id":"101"}`},
+		"POST /crm/v3/objects/deals":           {body: `{"id":"202"}`},
+	})
+	lead := testLead()
+
+	ref, _, err := hubSpotAt(t, server.URL).Sync(context.Background(), lead, CRMRef{})
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if ref.ContactID != "101" || ref.DealID != "202" {
+		t.Errorf("ref = %+v, want contact 101 and deal 202", ref)
+	}
+
+	calls := server.Calls()
+	for _, c := range calls {
+		if got := c.header.Get("Authorization"); got != "Bearer pat-test" {
+			t.Errorf("%s: Authorization = %q", c.route, got)
+		}
+		if got := c.header.Get("Content-Type"); got != "application/json" {
+			t.Errorf("%s: Content-Type = %q", c.route, got)
+		}
+	}
+	want := []string{
+		"POST /crm/v3/objects/contacts/search",
+		"POST /crm/v3/objects/contacts",
+		"POST /crm/v3/objects/deals",
+	}
+	if routes := server.Routes(); !slices.Equal(routes, want) {
+		t.Fatalf("calls = %q, want %q", routes, want)
+	}
+
+	var search struct {
+		FilterGroups []struct {
+			Filters []map[string]string `json:"filters"`
+		} `json:"filterGroups"`
+	}
+	calls[0].decode(t, &search)
+	filter := search.FilterGroups[0].Filters[0]
+	if filter["propertyName"] != "email" || filter["operator"] != "EQ" || filter["value"] != lead.Email {
+		t.Errorf("search filter = %v", filter)
+	}
+
+	var contact hubSpotObject
+	calls[1].decode(t, &contact)
+	wantContact := map[string]string{
+		"email":                lead.Email,
+		"firstname":            lead.FirstName,
+		"lastname":             lead.LastName,
+		"phone":                lead.PhoneNumber,
+		"annual_revenue_range": "$100,000 - $500,000",
+		"services_interested":  "essentials;consulting",
+	}
+	for k, v := range wantContact {
+		if got := contact.Properties[k]; got != v {
+			t.Errorf("contact %s = %q, want %q", k, got, v)
+		}
+	}
+
+	var deal hubSpotObject
+	calls[2].decode(t, &deal)
+	if deal.Properties["dealname"] != "Ana García - Website Lead" ||
+		deal.Properties["pipeline"] != "default" || deal.Properties["dealstage"] != "appointmentscheduled" {
+		t.Errorf("deal properties = %v", deal.Properties)
+	}
+	if len(deal.Associations) != 1 || deal.Associations[0].To.ID != "101" ||
+		deal.Associations[0].Types[0] != (hubSpotAssociationType{Category: "HUBSPOT_DEFINED", TypeID: hubSpotDealToContact}) {
+		t.Errorf("deal associations = %+v", deal.Associations)
+	}
+}
+
+func TestHubSpotUpdatesSyncedRecords(t *testing.T) {
+	server := newFakeCRM(t, map[string]crmResponse{
+		"PATCH /crm/v3/objects/contacts/55": {body: `{"id":"55"}`},
+		"PATCH /crm/v3/objects/deals/66":    {body: `{"id":"66"}`},
+	})
+
+	ref, _, err := hubSpotAt(t, server.URL).Sync(context.Background(), testLead(), CRMRef{ContactID: "55", DealID: "66"})
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if ref.ContactID != "55" || ref.DealID != "66" {
+		t.Errorf("ref = %+v, want the existing IDs", ref)
+	}
+
+	want := []string{"PATCH /crm/v3/objects/contacts/55", "PATCH /crm/v3/objects/deals/66"}
+	if routes := server.Routes(); !slices.Equal(routes, want) {
+		t.Fatalf("calls = %q, want %q", routes, want)
+	}
+	// The stage may have moved in HubSpot since creation, so it's left alone
+	var deal hubSpotObject
+	server.Calls()[1].decode(t, &deal)
+	if _, ok := deal.Properties["dealstage"]; ok || len(deal.Associations) != 0 {
+		t.Errorf("deal update sent %+v", deal)
+	}
+}
+
+func TestHubSpotRecreatesDeletedDeal(t *testing.T) {
+	// The deal was deleted in HubSpot, the contact is still there
+	server := newFakeCRM(t, map[string]crmResponse{
+		"PATCH /crm/v3/objects/contacts/55": {body: `{"id":"55"}`},
+		"PATCH /crm/v3/objects/deals/66":    {http.StatusNotFound, `{"status":"error","message":"Object not found"}`},
+		"POST /crm/v3/objects/deals":        {body: `{"id":"202"}`},
+	})
+
+	ref, _, err := hubSpotAt(t, server.URL).Sync(context.Background(), testLead(), CRMRef{ContactID: "55", DealID: "66"})
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if ref.ContactID != "55" || ref.DealID != "202" {
+		t.Errorf("ref = %+v, want contact 55 and new deal 202", ref)
+	}
+	calls := server.Calls()
+	last := calls[len(calls)-1]
+	if last.route != "POST /crm/v3/objects/deals" {
+		t.Fatalf("last call = %s, want the deal created", last.route)
+	}
+	var deal hubSpotObject
+	last.decode(t, &deal)
+	if len(deal.Associations) != 1 || deal.Associations[0].To.ID != "55" {
+		t.Errorf("new deal associated with %+v", deal.Associations)
+	}
+}
+
+func TestHubSpotReportsAPIErrors(t *testing.T) {
+	server := newFakeCRM(t, map[string]crmResponse{
+		"POST /crm/v3/objects/contacts/search": {http.StatusUnauthorized, `{"message":"Authentication credentials not found"}`},
+	})
+
+	_, status, err := hubSpotAt(t, server.URL).Sync(context.Background(), testLead(), CRMRef{})
+	if err == nil || status != http.StatusUnauthorized {
+		t.Fatalf("Sync = %d, %v; want a 401 error", status, err)
+	}
+}
@@ -0,0 +1,481 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultLocale is used when no supported locale can be negotiated
+const defaultLocale = "en"
+
+// localeNames are the human-readable names of the supported locales
+var localeNames = map[string]string{
+	"en": "English",
+	"es": "Español",
+}
+
+// catalogs holds the translated messages keyed by locale, then message key.
+// Keys double as the stable error codes returned to API clients.
+var catalogs = map[string]map[string]string{
+	"en": {
+		// Validation
+		"first_name_required":  "First name is required",
+		"first_name_too_short": "First name must be at least 2 characters",
+		"first_name_too_long":  "First name must be less than 50 characters",
+		"first_name_invalid":   "First name can only contain letters, spaces, hyphens, and apostrophes",
+		"last_name_required":   "Last name is required",
+		"last_name_too_short":  "Last name must be at least 2 characters",
+		"last_name_too_long":   "Last name must be less than 50 characters",
+		"last_name_invalid":    "Last name can only contain letters, spaces, hyphens, and apostrophes",
+		"email_required":       "Email is required",
+		"email_too_long":       "Email must be less than 254 characters",
+		"email_invalid":        "Please enter a valid email address",
+		"phone_required":       "Phone number is required",
+		"phone_invalid":        "Please enter a valid phone number",
+		"revenue_required":     "Please select your annual revenue range",
+		"revenue_invalid":      "Please select a valid revenue range",
+		"services_required":    "Please select at least one service you're interested in",
+		"service_invalid":      "Invalid service selected: %s",
+		"message_too_long":     "Message must be less than 2000 characters",
+
+		// API responses
+		"invalid_body":           "Invalid request body",
+		"invalid_json":           "Invalid request body",
+		"unknown_field":          "Invalid request body",
+		"trailing_data":          "Invalid request body",
+		"body_too_large":         "The submission is too large",
+		"unsupported_media_type": "Unsupported request format",
+		"captcha_required":       "Please complete the security check",
+		"captcha_error":          "Security verification failed. Please try again.",
+		"captcha_failed":         "Security check failed. Please try again.",
+		"form_token_required":    "Please reload the page and try again.",
+		"form_token_invalid":     "This form has expired. Please reload the page and try again.",
+		"validation_failed":      "Validation failed",
+		"server_config":          "Server configuration error",
+		"send_failed":            "Failed to send message. Please try again.",
+		"message_sent":           "Message sent successfully",
+
+		// Booking
+		"booking_confirmed":        "Your discovery call is booked. The invite is on its way to your inbox.",
+		"booking_invalid_time":     "Please choose a valid time",
+		"booking_invalid_timezone": "Please choose a valid timezone",
+		"booking_slot_unavailable": "That time isn't available. Please choose another.",
+		"booking_slot_taken":       "Sorry, that time was just booked. Please choose another.",
+		"booking_lead_not_found":   "We couldn't find your inquiry. Please use the contact form first.",
+		"booking_rejected":         "We couldn't book this call. Please try again later or contact us directly.",
+		"booking_cancelled":        "Your discovery call on %s is cancelled. We've emailed you the calendar update.",
+		"booking_rescheduled":      "Your discovery call is moved to %s. We've emailed you the updated invite.",
+		"booking_inactive":         "This discovery call was already cancelled.",
+		"booking_link_invalid":     "This link isn't valid. Please use the latest link from your booking email.",
+		"unsubscribe_done":         "%s won't receive any more follow-up emails from us. Confirmations for calls you book will still arrive.",
+		"unsubscribe_invalid":      "This unsubscribe link isn't valid. Reply to any of our emails and we'll take you off the list.",
+		"subscribe_pending":        "Almost done. Check your inbox and click the link to confirm your subscription.",
+		"subscribe_confirmed":      "You're in. %s is subscribed to our newsletter.",
+		"subscribe_link_invalid":   "This confirmation link isn't valid. Please sign up again from our website.",
+		"subscribe_link_expired":   "This confirmation link has expired. Please sign up again from our website.",
+		"consent_required":         "Please agree to the privacy policy to send the form",
+		"privacy_action_invalid":   "Choose whether to download or erase your data",
+		"privacy_request_sent":     "If we hold data about that address, we've emailed it a link to continue. Please check your inbox.",
+		"privacy_link_invalid":     "This link isn't valid. Please make the request again from our website.",
+		"privacy_link_expired":     "This link has expired. Please make the request again from our website.",
+		"privacy_erased":           "Done. We've erased the data we held about %s.",
+		"booking_link_expired":     "This link has expired because the call has already started.",
+		"booking_no_slots":         "There are no open times right now. Please reply to your booking email and we'll find one.",
+
+		// Attachments
+		"attachment_too_many":  "Too many files attached",
+		"attachment_too_large": "An attached file is too large",
+		"attachment_type":      "Attachments must be PDF, CSV, XLSX or QBO files",
+
+		// Shared email content
+		"email.tagline":  "Where Strategy Meets Execution",
+		"email.services": "QuickBooks Online | Payroll Processing | Financial Consulting | Strategic Planning",
+		"email.email":    "Email",
+		"email.phone":    "Phone",
+
+		// Thank you email
+		"thankyou.subject":          "Thank you for your interest in Momentum Business Solutions",
+		"thankyou.title":            "Thank You for Your Interest - Momentum Business Solutions",
+		"thankyou.greeting":         "Thank you, %s!",
+		"thankyou.intro":            "We sincerely appreciate you taking the time to reach out to Momentum Business Solutions. Your inquiry about our financial management services has been received and is very important to us.",
+		"thankyou.focus":            "We understand that managing your business finances can be complex, and we're here to handle the bookkeeping, payroll, and reporting so you can focus on what you do best - growing your business.",
+		"thankyou.next_heading":     "What Happens Next?",
+		"thankyou.next_when":        "Within 24 hours:",
+		"thankyou.next_body":        "Cade from our team will personally review your submission and reach out to discuss your specific needs and how we can best support your business goals.",
+		"thankyou.meantime_heading": "In the Meantime",
+		"thankyou.meantime_body":    "If you have any urgent questions or would like to speak with us immediately, please don't hesitate to reach out:",
+		"thankyou.closing":          "We look forward to the opportunity to partner with you and help your business achieve its financial goals.",
+		"thankyou.regards":          "Best regards,",
+		"thankyou.signature":        "The Momentum Business Solutions Team",
+
+		// Business notification email
+		"notify.subject":           "New Lead: Contact Form Submission - %s %s",
+		"notify.subject_returning": "Returning Lead: Contact Form Submission - %s %s",
+		"notify.subject_high":      "[High Priority] %s",
+		"notify.heading":           "NEW QUALIFIED LEAD",
+		"notify.heading_returning": "RETURNING LEAD",
+		"notify.badge":             "New Qualified Lead",
+		"notify.badge_returning":   "Returning Lead",
+		"notify.badge_high":        "High-Priority Lead",
+		"notify.badge_low":         "New Lead",
+		"notify.submitted":         "Submitted",
+		"notify.source":            "Source",
+		"notify.source_value":      "Website Contact Form",
+		"notify.returning_since":   "Website Contact Form (submission %d, first on %s)",
+		"notify.date":              "January 2, 2006",
+		"notify.language":          "Visitor Language",
+		"notify.submission":        "Submission Details",
+		"notify.contact":           "Contact Information",
+		"notify.full_name":         "Full Name",
+		"notify.name":              "Name",
+		"notify.email":             "Email Address",
+		"notify.phone":             "Phone Number",
+		"notify.revenue":           "Annual Revenue",
+		"notify.services_heading":  "Services of Interest",
+		"notify.services_intro":    "Client selected the following services:",
+		"notify.message":           "Client Message",
+		"notify.attachments":       "Attachments",
+		"notify.attachments_link":  "Too large to attach to this email. Download them from these links within %d days:",
+		"notify.view_lead":         "View lead",
+		"notify.generated":         "This email was generated from your website contact form.",
+		"notify.timestamp":         "Monday, January 2, 2006 at 3:04 PM MST",
+
+		// Booking emails
+		"booking.subject":                    "Your discovery call with Momentum Business Solutions - %s",
+		"booking.summary":                    "Discovery Call - Momentum Business Solutions",
+		"booking.description":                "Free discovery call to discuss your business finances and goals. We'll call you at the number you gave us.",
+		"booking.greeting":                   "Hi %s,",
+		"booking.intro":                      "Your free discovery call is booked. We'll call you at the number you gave us. The calendar invite is attached.",
+		"booking.when":                       "When",
+		"booking.time":                       "Monday, January 2, 2006 at 3:04 PM MST",
+		"booking.duration":                   "%d minutes",
+		"booking.change":                     "Need to change it?",
+		"booking.cancel":                     "Cancel",
+		"booking.reschedule":                 "Reschedule",
+		"booking.cancel_subject":             "Cancel discovery call on %s",
+		"booking.reschedule_subject":         "Reschedule discovery call on %s",
+		"booking.notify_subject":             "Discovery call booked: %s %s - %s",
+		"booking.notify_heading":             "DISCOVERY CALL BOOKED",
+		"booking.notify_intro":               "%s booked a discovery call.",
+		"booking.subject_rescheduled":        "Your discovery call is moved to %s",
+		"booking.subject_cancelled":          "Your discovery call on %s is cancelled",
+		"booking.intro_rescheduled":          "Your discovery call has a new time. The updated calendar invite is attached.",
+		"booking.intro_cancelled":            "Your discovery call is cancelled. The attached update removes it from your calendar. You're welcome to book another time whenever suits you.",
+		"booking.notify_subject_rescheduled": "Discovery call rescheduled: %s %s - %s",
+		"booking.notify_subject_cancelled":   "Discovery call cancelled: %s %s - %s",
+		"booking.notify_heading_rescheduled": "DISCOVERY CALL RESCHEDULED",
+		"booking.notify_heading_cancelled":   "DISCOVERY CALL CANCELLED",
+		"booking.notify_intro_rescheduled":   "%s moved their discovery call.",
+		"booking.notify_intro_cancelled":     "%s cancelled their discovery call.",
+		"booking.page_title":                 "Your Discovery Call",
+		"booking.cancel_prompt":              "Cancel your discovery call on %s?",
+		"booking.cancel_confirm":             "Yes, cancel the call",
+		"booking.reschedule_prompt":          "Your call is on %s. Choose a new time:",
+		"booking.day":                        "Monday, January 2",
+		"booking.clock":                      "3:04 PM",
+
+		// Reminders and follow-ups
+		"reminder.subject":        "Reminder: your discovery call on %s",
+		"reminder.subject_soon":   "Starting soon: your discovery call (%s)",
+		"reminder.body":           "This is a friendly reminder of your free discovery call with Momentum Business Solutions on %s. We'll call you at the number you gave us.\n\nIf the time no longer works, you can reschedule or cancel below.",
+		"nurture.pricing.subject": "Our packages and pricing, {firstName}",
+		"nurture.pricing.body":    "Hi {firstName},\n\nThanks again for reaching out. In case it helps while you decide, our packages start at Essentials for day-to-day bookkeeping, with Growth Strategy and Complete Business Support for businesses that want a proactive financial partner. Full details and pricing are at {siteUrl}/services/.\n\nThe easiest next step is a free 30-minute discovery call, where we'll talk through your situation and recommend the right fit.",
+		"nurture.checkin.subject": "Still interested, {firstName}?",
+		"nurture.checkin.body":    "Hi {firstName},\n\nWe haven't connected yet, so I wanted to check in. If getting your books and finances in order is still on your list, we'd be glad to help. If now isn't the right time, no problem at all.\n\nJust reply to this email or pick a time for a free discovery call below.",
+		"nurture.cta":             "Book a free discovery call",
+		"nurture.footer":          "You're receiving this because you contacted us through our website.",
+		"unsubscribe.link":        "Unsubscribe",
+		"unsubscribe.page_title":  "Email preferences",
+		"unsubscribe.prompt":      "Stop follow-up emails to %s?",
+		"unsubscribe.confirm":     "Unsubscribe",
+		"subscribe.subject":       "Confirm your newsletter subscription",
+		"subscribe.body":          "Thanks for signing up for the Momentum Business Solutions newsletter. Confirm your address to start receiving it. If you didn't ask for this, just ignore this email.",
+		"subscribe.confirm":       "Confirm subscription",
+		"subscribe.page_title":    "Newsletter subscription",
+		"subscribe.prompt":        "Subscribe %s to our newsletter?",
+		"privacy.page_title":      "Your data",
+		"privacy.export.subject":  "Your request for a copy of your data",
+		"privacy.export.body":     "We received a request to download the data Momentum Business Solutions holds about this email address. Use the link to download it; it expires in %d hours. If you didn't ask for this, just ignore this email.",
+		"privacy.export.confirm":  "Download my data",
+		"privacy.export.prompt":   "Download the data we hold about %s?",
+		"privacy.erase.subject":   "Your request to erase your data",
+		"privacy.erase.body":      "We received a request to erase the data Momentum Business Solutions holds about this email address. Use the link to confirm; it expires in %d hours. If you didn't ask for this, just ignore this email and nothing will be erased.",
+		"privacy.erase.confirm":   "Erase my data",
+		"privacy.erase.prompt":    "Erase the data we hold about %s? This can't be undone.",
+		"bounce.subject":          "Email to %s bounced - please call",
+		"bounce.body":             "Our email to %s <%s> hard-bounced, so the address doesn't work. Please reach them by phone instead.",
+		"bounce.reason":           "Reason",
+		"reply.subject":           "Reply from %s: %s",
+		"reply.intro":             "%s (%s) replied:",
+		"reply.unmatched":         "%s replied, but the email doesn't match any lead:",
+		"reply.skipped":           "Attachments too large to forward: %s",
+	},
+	"es": {
+		// Validation
+		"first_name_required":  "El nombre es obligatorio",
+		"first_name_too_short": "El nombre debe tener al menos 2 caracteres",
+		"first_name_too_long":  "El nombre debe tener menos de 50 caracteres",
+		"first_name_invalid":   "El nombre solo puede contener letras, espacios, guiones y apóstrofos",
+		"last_name_required":   "El apellido es obligatorio",
+		"last_name_too_short":  "El apellido debe tener al menos 2 caracteres",
+		"last_name_too_long":   "El apellido debe tener menos de 50 caracteres",
+		"last_name_invalid":    "El apellido solo puede contener letras, espacios, guiones y apóstrofos",
+		"email_required":       "El correo electrónico es obligatorio",
+		"email_too_long":       "El correo electrónico debe tener menos de 254 caracteres",
+		"email_invalid":        "Ingrese un correo electrónico válido",
+		"phone_required":       "El número de teléfono es obligatorio",
+		"phone_invalid":        "Ingrese un número de teléfono válido",
+		"revenue_required":     "Seleccione el rango de sus ingresos anuales",
+		"revenue_invalid":      "Seleccione un rango de ingresos válido",
+		"services_required":    "Seleccione al menos un servicio de su interés",
+		"service_invalid":      "Servicio seleccionado no válido: %s",
+		"message_too_long":     "El mensaje debe tener menos de 2000 caracteres",
+
+		// API responses
+		"invalid_body":           "Cuerpo de la solicitud no válido",
+		"invalid_json":           "Cuerpo de la solicitud no válido",
+		"unknown_field":          "Cuerpo de la solicitud no válido",
+		"trailing_data":          "Cuerpo de la solicitud no válido",
+		"body_too_large":         "El envío es demasiado grande",
+		"unsupported_media_type": "Formato de solicitud no compatible",
+		"captcha_required":       "Complete la verificación de seguridad",
+		"captcha_error":          "La verificación de seguridad falló. Inténtelo de nuevo.",
+		"captcha_failed":         "No se superó la verificación de seguridad. Inténtelo de nuevo.",
+		"form_token_required":    "Vuelva a cargar la página e inténtelo de nuevo.",
+		"form_token_invalid":     "Este formulario ha caducado. Vuelva a cargar la página e inténtelo de nuevo.",
+		"validation_failed":      "La validación falló",
+		"server_config":          "Error de configuración del servidor",
+		"send_failed":            "No se pudo enviar el mensaje. Inténtelo de nuevo.",
+		"message_sent":           "Mensaje enviado correctamente",
+
+		// Booking
+		"booking_confirmed":        "Su llamada de descubrimiento está reservada. La invitación va en camino a su bandeja de entrada.",
+		"booking_invalid_time":     "Elija una hora válida",
+		"booking_invalid_timezone": "Elija una zona horaria válida",
+		"booking_slot_unavailable": "Esa hora no está disponible. Elija otra.",
+		"booking_slot_taken":       "Lo sentimos, esa hora se acaba de reservar. Elija otra.",
+		"booking_lead_not_found":   "No encontramos su consulta. Use primero el formulario de contacto.",
+		"booking_rejected":         "No pudimos reservar esta llamada. Inténtelo más tarde o contáctenos directamente.",
+		"booking_cancelled":        "Su llamada de descubrimiento del %s está cancelada. Le enviamos la actualización del calendario.",
+		"booking_rescheduled":      "Su llamada de descubrimiento se cambió al %s. Le enviamos la invitación actualizada.",
+		"booking_inactive":         "Esta llamada de descubrimiento ya fue cancelada.",
+		"booking_link_invalid":     "Este enlace no es válido. Use el enlace más reciente de su correo de reserva.",
+		"unsubscribe_done":         "%s ya no recibirá más correos de seguimiento. Seguirá recibiendo las confirmaciones de las llamadas que reserve.",
+		"unsubscribe_invalid":      "Este enlace para cancelar la suscripción no es válido. Responda a cualquiera de nuestros correos y le quitaremos de la lista.",
+		"subscribe_pending":        "Casi listo. Revise su correo y haga clic en el enlace para confirmar su suscripción.",
+		"subscribe_confirmed":      "Listo. %s está suscrito a nuestro boletín.",
+		"subscribe_link_invalid":   "Este enlace de confirmación no es válido. Vuelva a suscribirse desde nuestro sitio web.",
+		"subscribe_link_expired":   "Este enlace de confirmación ha caducado. Vuelva a suscribirse desde nuestro sitio web.",
+		"consent_required":         "Acepte la política de privacidad para enviar el formulario",
+		"privacy_action_invalid":   "Elija si desea descargar o eliminar sus datos",
+		"privacy_request_sent":     "Si tenemos datos sobre esa dirección, le enviamos un enlace para continuar. Revise su correo.",
+		"privacy_link_invalid":     "Este enlace no es válido. Vuelva a hacer la solicitud desde nuestro sitio web.",
+		"privacy_link_expired":     "Este enlace ha caducado. Vuelva a hacer la solicitud desde nuestro sitio web.",
+		"privacy_erased":           "Listo. Eliminamos los datos que guardábamos sobre %s.",
+		"booking_link_expired":     "Este enlace caducó porque la llamada ya comenzó.",
+		"booking_no_slots":         "No hay horarios disponibles en este momento. Responda a su correo de reserva y buscaremos uno.",
+
+		// Attachments
+		"attachment_too_many":  "Se adjuntaron demasiados archivos",
+		"attachment_too_large": "Un archivo adjunto es demasiado grande",
+		"attachment_type":      "Los archivos adjuntos deben ser PDF, CSV, XLSX o QBO",
+
+		// Shared email content
+		"email.tagline":  "Donde la estrategia se une a la ejecución",
+		"email.services": "QuickBooks Online | Procesamiento de nómina | Consultoría financiera | Planificación estratégica",
+		"email.email":    "Correo",
+		"email.phone":    "Teléfono",
+
+		// Thank you email
+		"thankyou.subject":          "Gracias por su interés en Momentum Business Solutions",
+		"thankyou.title":            "Gracias por su interés - Momentum Business Solutions",
+		"thankyou.greeting":         "¡Gracias, %s!",
+		"thankyou.intro":            "Le agradecemos sinceramente que se haya tomado el tiempo de comunicarse con Momentum Business Solutions. Hemos recibido su consulta sobre nuestros servicios de gestión financiera y es muy importante para nosotros.",
+		"thankyou.focus":            "Sabemos que administrar las finanzas de su negocio puede ser complicado. Nosotros nos encargamos de la contabilidad, la nómina y los informes para que usted pueda concentrarse en lo que mejor sabe hacer: hacer crecer su negocio.",
+		"thankyou.next_heading":     "¿Qué sigue?",
+		"thankyou.next_when":        "En un plazo de 24 horas:",
+		"thankyou.next_body":        "Cade, de nuestro equipo, revisará personalmente su solicitud y se comunicará con usted para conversar sobre sus necesidades y cómo podemos apoyar mejor los objetivos de su negocio.",
+		"thankyou.meantime_heading": "Mientras tanto",
+		"thankyou.meantime_body":    "Si tiene alguna pregunta urgente o desea hablar con nosotros de inmediato, no dude en comunicarse:",
+		"thankyou.closing":          "Esperamos tener la oportunidad de trabajar con usted y ayudar a su negocio a alcanzar sus metas financieras.",
+		"thankyou.regards":          "Saludos cordiales,",
+		"thankyou.signature":        "El equipo de Momentum Business Solutions",
+
+		// Business notification email
+		"notify.subject":           "Nuevo cliente potencial: formulario de contacto - %s %s",
+		"notify.subject_returning": "Cliente potencial recurrente: formulario de contacto - %s %s",
+		"notify.subject_high":      "[Alta prioridad] %s",
+		"notify.heading":           "NUEVO CLIENTE POTENCIAL CALIFICADO",
+		"notify.heading_returning": "CLIENTE POTENCIAL RECURRENTE",
+		"notify.badge":             "Nuevo cliente potencial calificado",
+		"notify.badge_returning":   "Cliente potencial recurrente",
+		"notify.badge_high":        "Cliente potencial de alta prioridad",
+		"notify.badge_low":         "Nuevo cliente potencial",
+		"notify.submitted":         "Enviado",
+		"notify.source":            "Origen",
+		"notify.source_value":      "Formulario de contacto del sitio web",
+		"notify.returning_since":   "Formulario de contacto del sitio web (envío %d, el primero el %s)",
+		"notify.date":              "02/01/2006",
+		"notify.language":          "Idioma del visitante",
+		"notify.submission":        "Detalles del envío",
+		"notify.contact":           "Información de contacto",
+		"notify.full_name":         "Nombre completo",
+		"notify.name":              "Nombre",
+		"notify.email":             "Correo electrónico",
+		"notify.phone":             "Número de teléfono",
+		"notify.revenue":           "Ingresos anuales",
+		"notify.services_heading":  "Servicios de interés",
+		"notify.services_intro":    "El cliente seleccionó los siguientes servicios:",
+		"notify.message":           "Mensaje del cliente",
+		"notify.attachments":       "Archivos adjuntos",
+		"notify.attachments_link":  "Demasiado grandes para adjuntar a este correo. Descárguelos desde estos enlaces en un plazo de %d días:",
+		"notify.view_lead":         "Ver cliente potencial",
+		"notify.generated":         "Este correo fue generado por el formulario de contacto de su sitio web.",
+		"notify.timestamp":         "02/01/2006 15:04 MST",
+
+		// Booking emails
+		"booking.subject":                    "Su llamada de descubrimiento con Momentum Business Solutions - %s",
+		"booking.summary":                    "Llamada de descubrimiento - Momentum Business Solutions",
+		"booking.description":                "Llamada de descubrimiento gratuita para conversar sobre las finanzas y los objetivos de su negocio. Le llamaremos al número que nos dio.",
+		"booking.greeting":                   "Hola, %s:",
+		"booking.intro":                      "Su llamada de descubrimiento gratuita está reservada. Le llamaremos al número que nos dio. La invitación de calendario va adjunta.",
+		"booking.when":                       "Cuándo",
+		"booking.time":                       "02/01/2006 15:04 MST",
+		"booking.duration":                   "%d minutos",
+		"booking.change":                     "¿Necesita cambiarla?",
+		"booking.cancel":                     "Cancelar",
+		"booking.reschedule":                 "Reprogramar",
+		"booking.cancel_subject":             "Cancelar la llamada de descubrimiento del %s",
+		"booking.reschedule_subject":         "Reprogramar la llamada de descubrimiento del %s",
+		"booking.notify_subject":             "Llamada de descubrimiento reservada: %s %s - %s",
+		"booking.notify_heading":             "LLAMADA DE DESCUBRIMIENTO RESERVADA",
+		"booking.notify_intro":               "%s reservó una llamada de descubrimiento.",
+		"booking.subject_rescheduled":        "Su llamada de descubrimiento se cambió al %s",
+		"booking.subject_cancelled":          "Su llamada de descubrimiento del %s está cancelada",
+		"booking.intro_rescheduled":          "Su llamada de descubrimiento tiene un nuevo horario. La invitación de calendario actualizada va adjunta.",
+		"booking.intro_cancelled":            "Su llamada de descubrimiento está cancelada. La actualización adjunta la quita de su calendario. Puede reservar otro horario cuando le convenga.",
+		"booking.notify_subject_rescheduled": "Llamada de descubrimiento reprogramada: %s %s - %s",
+		"booking.notify_subject_cancelled":   "Llamada de descubrimiento cancelada: %s %s - %s",
+		"booking.notify_heading_rescheduled": "LLAMADA DE DESCUBRIMIENTO REPROGRAMADA",
+		"booking.notify_heading_cancelled":   "LLAMADA DE DESCUBRIMIENTO CANCELADA",
+		"booking.notify_intro_rescheduled":   "%s cambió su llamada de descubrimiento.",
+		"booking.notify_intro_cancelled":     "%s canceló su llamada de descubrimiento.",
+		"booking.page_title":                 "Su llamada de descubrimiento",
+		"booking.cancel_prompt":              "¿Cancelar su llamada de descubrimiento del %s?",
+		"booking.cancel_confirm":             "Sí, cancelar la llamada",
+		"booking.reschedule_prompt":          "Su llamada es el %s. Elija un nuevo horario:",
+		"booking.day":                        "02/01",
+		"booking.clock":                      "15:04",
+
+		// Reminders and follow-ups
+		"reminder.subject":        "Recordatorio: su llamada de descubrimiento del %s",
+		"reminder.subject_soon":   "Comienza pronto: su llamada de descubrimiento (%s)",
+		"reminder.body":           "Le recordamos su llamada de descubrimiento gratuita con Momentum Business Solutions el %s. Le llamaremos al número que nos dio.\n\nSi el horario ya no le conviene, puede reprogramarla o cancelarla a continuación.",
+		"nurture.pricing.subject": "Nuestros paquetes y precios, {firstName}",
+		"nurture.pricing.body":    "Hola, {firstName}:\n\nGracias de nuevo por comunicarse con nosotros. Por si le ayuda a decidir, nuestros paquetes empiezan con Essentials para la contabilidad diaria, y Growth Strategy y Complete Business Support para negocios que buscan un socio financiero proactivo. Encontrará todos los detalles y precios en {siteUrl}/services/.\n\nEl siguiente paso más sencillo es una llamada de descubrimiento gratuita de 30 minutos, en la que hablaremos de su situación y le recomendaremos la mejor opción.",
+		"nurture.checkin.subject": "¿Sigue interesado, {firstName}?",
+		"nurture.checkin.body":    "Hola, {firstName}:\n\nTodavía no hemos hablado, así que quería saber cómo está. Si poner en orden su contabilidad y sus finanzas sigue en su lista, con gusto le ayudamos. Si ahora no es el momento, no hay ningún problema.\n\nSolo responda a este correo o elija un horario para una llamada de descubrimiento gratuita.",
+		"nurture.cta":             "Reservar una llamada de descubrimiento gratuita",
+		"nurture.footer":          "Recibe este correo porque se comunicó con nosotros a través de nuestro sitio web.",
+		"unsubscribe.link":        "Cancelar suscripción",
+		"unsubscribe.page_title":  "Preferencias de correo",
+		"unsubscribe.prompt":      "¿Dejar de enviar correos de seguimiento a %s?",
+		"unsubscribe.confirm":     "Cancelar suscripción",
+		"subscribe.subject":       "Confirme su suscripción a nuestro boletín",
+		"subscribe.body":          "Gracias por suscribirse al boletín de Momentum Business Solutions. Confirme su dirección para empezar a recibirlo. Si no lo solicitó, ignore este correo.",
+		"subscribe.confirm":       "Confirmar suscripción",
+		"subscribe.page_title":    "Suscripción al boletín",
+		"subscribe.prompt":        "¿Suscribir %s a nuestro boletín?",
+		"privacy.page_title":      "Sus datos",
+		"privacy.export.subject":  "Su solicitud de copia de sus datos",
+		"privacy.export.body":     "Recibimos una solicitud para descargar los datos que Momentum Business Solutions guarda sobre esta dirección de correo. Use el enlace para descargarlos; caduca en %d horas. Si no lo solicitó, ignore este correo.",
+		"privacy.export.confirm":  "Descargar mis datos",
+		"privacy.export.prompt":   "¿Descargar los datos que guardamos sobre %s?",
+		"privacy.erase.subject":   "Su solicitud de eliminación de datos",
+		"privacy.erase.body":      "Recibimos una solicitud para eliminar los datos que Momentum Business Solutions guarda sobre esta dirección de correo. Use el enlace para confirmarla; caduca en %d horas. Si no lo solicitó, ignore este correo y no se eliminará nada.",
+		"privacy.erase.confirm":   "Eliminar mis datos",
+		"privacy.erase.prompt":    "¿Eliminar los datos que guardamos sobre %s? No se puede deshacer.",
+		"bounce.subject":          "El correo a %s rebotó; por favor llame",
+		"bounce.body":             "Nuestro correo a %s <%s> rebotó de forma permanente, así que la dirección no funciona. Por favor, comuníquese por teléfono.",
+		"bounce.reason":           "Motivo",
+		"reply.subject":           "Respuesta de %s: %s",
+		"reply.intro":             "%s (%s) respondió:",
+		"reply.unmatched":         "%s respondió, pero el correo no coincide con ningún prospecto:",
+		"reply.skipped":           "Archivos adjuntos demasiado grandes para reenviar: %s",
+	},
+}
+
+// translate returns the message for key in the given locale, falling back to
+// the default locale and finally to the key itself
+func translate(locale, key string, args ...any) string {
+	msg, ok := catalogs[locale][key]
+	if !ok {
+		msg, ok = catalogs[defaultLocale][key]
+	}
+	if !ok {
+		msg = key
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+// normalizeLocale reduces a language tag such as "es-MX" to a supported
+// base locale, returning "" if it is not supported
+func normalizeLocale(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	if _, ok := catalogs[tag]; ok {
+		return tag
+	}
+	return ""
+}
+
+// negotiateLocale picks the visitor's locale, preferring an explicit value
+// (e.g. the "locale" form field) over the Accept-Language header
+func negotiateLocale(explicit, acceptLanguage string) string {
+	if locale := normalizeLocale(explicit); locale != "" {
+		return locale
+	}
+
+	type candidate struct {
+		locale string
+		q      float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if locale := normalizeLocale(tag); locale != "" && q > 0 {
+			candidates = append(candidates, candidate{locale, q})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+	if len(candidates) > 0 {
+		return candidates[0].locale
+	}
+	return defaultLocale
+}
+
+// businessLocale returns the language used for notifications sent to the business
+func businessLocale() string {
+	if locale := normalizeLocale(os.Getenv("BUSINESS_LOCALE")); locale != "" {
+		return locale
+	}
+	return defaultLocale
+}
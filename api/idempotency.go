@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Idempotency cache defaults, overridable via environment
+const (
+	defaultIdempotencyTTL     = 24 * time.Hour
+	defaultIdempotencyEntries = 10000
+	maxIdempotencyKeyLen      = 255
+)
+
+// idempotentResponse is a recorded response to replay for retries
+type idempotentResponse struct {
+	fingerprint [sha256.Size]byte // see requestFingerprint
+	done        chan struct{}     // closed once the response is recorded
+	status      int
+	header      http.Header
+	body        []byte
+	expires     time.Time
+}
+
+// idempotencyCache remembers responses by Idempotency-Key so a client that
+// retries after a dropped connection gets the original response instead of
+// resubmitting. CAPTCHA and form tokens are single-use, so without this a
+// retry of a request that actually succeeded would be rejected.
+type idempotencyCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	max     int
+	entries map[string]*idempotentResponse
+	order   []string
+}
+
+func newIdempotencyCache() *idempotencyCache {
+	return &idempotencyCache{
+		ttl:     time.Duration(envInt("IDEMPOTENCY_TTL_HOURS", int(defaultIdempotencyTTL/time.Hour))) * time.Hour,
+		max:     envInt("IDEMPOTENCY_MAX_ENTRIES", defaultIdempotencyEntries),
+		entries: make(map[string]*idempotentResponse),
+	}
+}
+
+// begin returns the entry for key and whether the caller owns it. If not,
+// the entry belongs to an earlier request and may still be in flight.
+func (c *idempotencyCache) begin(key string, now time.Time) (*idempotentResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok && e.expires.After(now) {
+		return e, false
+	}
+
+	// Drop expired entries from the front, then the oldest if still full
+	for len(c.order) > 0 {
+		oldest := c.order[0]
+		if e, ok := c.entries[oldest]; ok && e.expires.After(now) && len(c.entries) < c.max {
+			break
+		}
+		delete(c.entries, oldest)
+		c.order = c.order[1:]
+	}
+
+	e := &idempotentResponse{done: make(chan struct{}), expires: now.Add(c.ttl)}
+	c.entries[key] = e
+	c.order = append(c.order, key)
+	return e, true
+}
+
+// forget removes an entry so the request can be retried from scratch
+func (c *idempotencyCache) forget(key string, e *idempotentResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries[key] == e {
+		delete(c.entries, key)
+	}
+}
+
+// withIdempotency wraps a POST handler with Idempotency-Key support.
+// Requests without the header pass straight through. Server errors aren't
+// cached, so a retry after a 5xx runs the handler again.
+func (c *idempotencyCache) withIdempotency(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			http.Error(w, "Idempotency-Key too long", http.StatusBadRequest)
+			return
+		}
+
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			mediaType = "application/json"
+		}
+		entry, owner := c.begin(key, time.Now())
+		if !owner {
+			// Fingerprint the retried request so a reused key with a
+			// different payload is refused rather than answered with a
+			// stale response
+			fingerprint := requestFingerprint(r, mediaType, readForFingerprint(w, r, mediaType))
+
+			select {
+			case <-entry.done:
+			case <-r.Context().Done():
+				return
+			}
+			if entry.status == 0 {
+				// The original request failed and was forgotten
+				http.Error(w, "Original request failed, retry with a new key", http.StatusConflict)
+				return
+			}
+			if fingerprint != entry.fingerprint {
+				http.Error(w, "Idempotency-Key reused with a different request", http.StatusUnprocessableEntity)
+				return
+			}
+			for k, v := range entry.header {
+				w.Header()[k] = v
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(entry.status)
+			w.Write(entry.body)
+			return
+		}
+
+		// Waiters are released however the handler ends; one that failed
+		// or panicked leaves no response, so its key is forgotten
+		defer func() {
+			if entry.status == 0 {
+				c.forget(key, entry)
+			}
+			close(entry.done)
+		}()
+
+		// Forms are fingerprinted from what the handler parsed, anything
+		// else from a copy of the body it read
+		var raw bytes.Buffer
+		if !isFormMediaType(mediaType) {
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.TeeReader(r.Body, &raw), r.Body}
+		}
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+
+		if rec.status < 500 {
+			if !isFormMediaType(mediaType) {
+				// Copy whatever the handler left unread
+				io.Copy(io.Discard, io.LimitReader(r.Body, maxBodyBytes()))
+			}
+			entry.fingerprint = requestFingerprint(r, mediaType, raw.Bytes())
+			entry.header = w.Header().Clone()
+			entry.body = rec.body.Bytes()
+			entry.status = rec.status
+		}
+	}
+}
+
+// isFormMediaType reports whether a body of the media type is parsed into
+// the request's form values
+func isFormMediaType(mediaType string) bool {
+	return mediaType == "multipart/form-data" || mediaType == "application/x-www-form-urlencoded"
+}
+
+// readForFingerprint reads a retried request's body the way decodeForm
+// would: forms are parsed into the request, anything else is returned
+func readForFingerprint(w http.ResponseWriter, r *http.Request, mediaType string) []byte {
+	switch mediaType {
+	case "multipart/form-data":
+		r.Body = http.MaxBytesReader(w, r.Body, maxMultipartBytes())
+		r.ParseMultipartForm(maxMultipartMemory)
+		return nil
+	case "application/x-www-form-urlencoded":
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes())
+		r.ParseForm()
+		return nil
+	}
+	raw, _ := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes()))
+	return raw
+}
+
+// requestFingerprint identifies a request by what it submitted rather than
+// its bytes: the form fields and a digest of each uploaded file, or the
+// JSON document in canonical form. A browser retrying a multipart post picks
+// a new boundary, so the raw bodies of two identical submissions differ.
+func requestFingerprint(r *http.Request, mediaType string, raw []byte) [sha256.Size]byte {
+	h := sha256.New()
+	switch mediaType {
+	case "multipart/form-data":
+		if r.MultipartForm == nil {
+			break
+		}
+		io.WriteString(h, url.Values(r.MultipartForm.Value).Encode()+"\n")
+		fields := make([]string, 0, len(r.MultipartForm.File))
+		for field := range r.MultipartForm.File {
+			fields = append(fields, field)
+		}
+		slices.Sort(fields)
+		for _, field := range fields {
+			for _, fh := range r.MultipartForm.File[field] {
+				fmt.Fprintf(h, "file %q %q %x\n", field, fh.Filename, fileDigest(fh))
+			}
+		}
+	case "application/x-www-form-urlencoded":
+		io.WriteString(h, r.PostForm.Encode()+"\n")
+	default:
+		var doc any
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		if dec.Decode(&doc) == nil {
+			// Marshalling sorts object keys and drops insignificant space
+			raw, _ = json.Marshal(doc)
+		}
+		h.Write(raw)
+	}
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// fileDigest returns the SHA-256 of an uploaded file, or nil if it can't
+// be read
+func fileDigest(fh *multipart.FileHeader) []byte {
+	f, err := fh.Open()
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil
+	}
+	return h.Sum(nil)
+}
+
+// responseRecorder passes a response through while keeping a copy of it
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// multipartBody encodes the fields and a file with the given boundary
+func multipartBody(t *testing.T, boundary string, fields map[string]string, file string) (string, string) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	if err := mw.SetBoundary(boundary); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	part, _ := mw.CreateFormFile("attachments", "statement.pdf")
+	part.Write([]byte(file))
+	mw.Close()
+	return mw.FormDataContentType(), body.String()
+}
+
+func TestIdempotencyFingerprint(t *testing.T) {
+	fields := map[string]string{"email": "ana@example.com", "message": "Hola"}
+	firstType, firstBody := multipartBody(t, "boundary-one", fields, "%PDF-1.7 statement")
+	retryType, retryBody := multipartBody(t, "boundary-two", fields, "%PDF-1.7 statement")
+	otherFileType, otherFileBody := multipartBody(t, "boundary-two", fields, "%PDF-1.7 other statement")
+	otherFieldType, otherFieldBody := multipartBody(t, "boundary-two", map[string]string{"email": "ana@example.com", "message": "Adiós"}, "%PDF-1.7 statement")
+
+	tests := []struct {
+		name             string
+		firstType, first string
+		retryType, retry string
+		wantStatus       int
+		wantReplayed     bool
+	}{
+		{"multipart with a new boundary", firstType, firstBody, retryType, retryBody, http.StatusCreated, true},
+		{"multipart with another file", firstType, firstBody, otherFileType, otherFileBody, http.StatusUnprocessableEntity, false},
+		{"multipart with another field", firstType, firstBody, otherFieldType, otherFieldBody, http.StatusUnprocessableEntity, false},
+		{"urlencoded in another order", "application/x-www-form-urlencoded", "email=ana%40example.com&message=Hola",
+			"application/x-www-form-urlencoded", "message=Hola&email=ana%40example.com", http.StatusCreated, true},
+		{"json with keys reordered", "application/json", `{"email":"ana@example.com","message":"Hola"}`,
+			"application/json", "{\n  \"message\": \"Hola\",\n  \"email\": \"ana@example.com\"\n}", http.StatusCreated, true},
+		{"json with another value", "application/json", `{"email":"ana@example.com","message":"Hola"}`,
+			"application/json", `{"email":"ana@example.com","message":"Adiós"}`, http.StatusUnprocessableEntity, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var runs atomic.Int32
+			handler := newIdempotencyCache().withIdempotency(func(w http.ResponseWriter, r *http.Request) {
+				runs.Add(1)
+				var form ContactForm
+				if err := decodeForm(w, r, &form, false); err != nil {
+					t.Errorf("decodeForm: %v", err)
+				}
+				w.WriteHeader(http.StatusCreated)
+				io.WriteString(w, form.Message)
+			})
+			send := func(contentType, body string) *httptest.ResponseRecorder {
+				r := httptest.NewRequest("POST", "/api/contact", strings.NewReader(body))
+				r.Header.Set("Content-Type", contentType)
+				r.Header.Set("Idempotency-Key", "key-1")
+				w := httptest.NewRecorder()
+				handler(w, r)
+				return w
+			}
+
+			if w := send(tt.firstType, tt.first); w.Code != http.StatusCreated {
+				t.Fatalf("first request = %d", w.Code)
+			}
+			w := send(tt.retryType, tt.retry)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("retry = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if replayed := w.Header().Get("Idempotent-Replayed") == "true"; replayed != tt.wantReplayed {
+				t.Errorf("replayed = %v, want %v", replayed, tt.wantReplayed)
+			}
+			if runs.Load() != 1 {
+				t.Errorf("handler ran %d times", runs.Load())
+			}
+		})
+	}
+}
+
+func TestIdempotencyPanicReleasesWaiters(t *testing.T) {
+	cache := newIdempotencyCache()
+	started, crash := make(chan struct{}), make(chan struct{})
+	var runs atomic.Int32
+	handler := cache.withIdempotency(func(w http.ResponseWriter, r *http.Request) {
+		if runs.Add(1) == 1 {
+			close(started)
+			<-crash
+			panic("handler bug")
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+	send := func(body io.Reader) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/api/contact", body)
+		r.Header.Set("Idempotency-Key", "key-1")
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	go func() {
+		defer func() { recover() }()
+		send(strings.NewReader(`{}`))
+	}()
+	<-started
+
+	// A retry reads its body once it's found the original in flight, so
+	// the crash waits until it's actually waiting
+	waiter := make(chan *httptest.ResponseRecorder)
+	read := make(chan struct{})
+	go func() { waiter <- send(&signalReader{Reader: strings.NewReader(`{}`), read: read}) }()
+	<-read
+	close(crash)
+
+	// The retry waiting on the panicked request is released, and the key is
+	// free for the next one
+	if w := <-waiter; w.Code != http.StatusConflict {
+		t.Fatalf("waiting retry = %d, want %d", w.Code, http.StatusConflict)
+	}
+	if w := send(strings.NewReader(`{}`)); w.Code != http.StatusCreated || runs.Load() != 2 {
+		t.Fatalf("next retry = %d after %d runs, want the handler run again", w.Code, runs.Load())
+	}
+}
+
+// signalReader closes read once the body has been read to the end
+type signalReader struct {
+	io.Reader
+	read chan struct{}
+	once sync.Once
+}
+
+func (r *signalReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err == io.EOF {
+		r.once.Do(func() { close(r.read) })
+	}
+	return n, err
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"os"
+	"strings"
+	"time"
+)
+
+// defaultInboundMaxBodyBytes caps inbound email webhooks, which carry
+// attachments base64 encoded
+const defaultInboundMaxBodyBytes = 20 << 20
+
+// maxInboundText caps a reply's text kept on the lead
+const maxInboundText = 20000
+
+// ConversationMessage is an email from the prospect, kept on the lead
+type ConversationMessage struct {
+	At          time.Time `json:"at"`
+	From        string    `json:"from"`
+	Subject     string    `json:"subject"`
+	Text        string    `json:"text"`
+	MessageID   string    `json:"messageId"`
+	Attachments []string  `json:"attachments,omitempty"` // filenames; the files are forwarded, not stored
+}
+
+// PostmarkInbound is the subset of Postmark's inbound webhook payload we use
+type PostmarkInbound struct {
+	FromName string `json:"FromName"`
+	FromFull struct {
+		Email string `json:"Email"`
+		Name  string `json:"Name"`
+	} `json:"FromFull"`
+	ToFull []struct {
+		Email       string `json:"Email"`
+		MailboxHash string `json:"MailboxHash"`
+	} `json:"ToFull"`
+	MailboxHash       string `json:"MailboxHash"`
+	Subject           string `json:"Subject"`
+	MessageID         string `json:"MessageID"`
+	Date              string `json:"Date"`
+	TextBody          string `json:"TextBody"`
+	StrippedTextReply string `json:"StrippedTextReply"`
+	Attachments       []struct {
+		Name          string `json:"Name"`
+		Content       string `json:"Content"`
+		ContentType   string `json:"ContentType"`
+		ContentLength int64  `json:"ContentLength"`
+	} `json:"Attachments"`
+}
+
+// leadReplyAddress returns the Reply-To address threading replies into a
+// lead: INBOUND_EMAIL_ADDRESS with the lead ID as its +tag, e.g.
+// lead+<id>@reply.example.com. Empty without the setting or a lead.
+func leadReplyAddress(leadID string) string {
+	addr := os.Getenv("INBOUND_EMAIL_ADDRESS")
+	local, domain, ok := strings.Cut(addr, "@")
+	if leadID == "" || !ok {
+		return ""
+	}
+	return local + "+" + leadID + "@" + domain
+}
+
+// mailboxHash returns the +tag the reply was sent to
+func (in *PostmarkInbound) mailboxHash() string {
+	if in.MailboxHash != "" {
+		return in.MailboxHash
+	}
+	for _, to := range in.ToFull {
+		if to.MailboxHash != "" {
+			return to.MailboxHash
+		}
+	}
+	return ""
+}
+
+// text returns the reply without the quoted thread, capped in length
+func (in *PostmarkInbound) text() string {
+	text := strings.TrimSpace(cmp.Or(in.StrippedTextReply, in.TextBody))
+	if len(text) > maxInboundText {
+		text = strings.ToValidUTF8(text[:maxInboundText], "") + "\n[…]"
+	}
+	return text
+}
+
+// at returns when the email was sent, or now if the Date header won't parse
+func (in *PostmarkInbound) at() time.Time {
+	if t, err := mail.ParseDate(in.Date); err == nil {
+		return t.UTC()
+	}
+	return time.Now().UTC()
+}
+
+// matchLead finds the lead a reply belongs to: by the +tag of the address
+// it was sent to, else by the sender's address. Nil if neither matches.
+func (in *PostmarkInbound) matchLead() *Lead {
+	if id := in.mailboxHash(); id != "" {
+		if lead, err := leads.Get(id); err == nil {
+			return lead
+		}
+	}
+	return leads.FindDuplicate(in.FromFull.Email, "", time.Time{})
+}
+
+// errDuplicateReply skips an inbound email Postmark delivered twice
+var errDuplicateReply = errors.New("reply already recorded")
+
+// handlePostmarkInbound takes a prospect's reply from Postmark's inbound
+// webhook, forwards it to the business and appends it to the lead's
+// conversation. Replies that match no lead are still forwarded.
+func handlePostmarkInbound(w http.ResponseWriter, r *http.Request) {
+	var in PostmarkInbound
+	limit := int64(envInt("INBOUND_MAX_BODY_BYTES", defaultInboundMaxBodyBytes))
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, limit)).Decode(&in); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	lead := in.matchLead()
+	if lead != nil {
+		for _, m := range lead.Conversation {
+			if m.MessageID == in.MessageID {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+		}
+	}
+
+	// Forward first: if that fails Postmark retries, and a reply recorded
+	// but never forwarded would be missed
+	if err := forwardReply(&in, lead); err != nil {
+		log.Printf("Failed to forward inbound email %s: %v", in.MessageID, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if lead == nil {
+		log.Printf("Forwarded inbound email from %s matching no lead", in.FromFull.Email)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	msg := ConversationMessage{
+		At:        in.at(),
+		From:      in.FromFull.Email,
+		Subject:   in.Subject,
+		Text:      in.text(),
+		MessageID: in.MessageID,
+	}
+	for _, a := range in.Attachments {
+		msg.Attachments = append(msg.Attachments, a.Name)
+	}
+	_, err := leads.Update(lead.ID, func(l *Lead) error {
+		for _, m := range l.Conversation {
+			if m.MessageID == msg.MessageID {
+				return errDuplicateReply
+			}
+		}
+		l.Conversation = append(l.Conversation, msg)
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDuplicateReply) {
+		log.Printf("Failed to record reply on lead %s: %v", lead.ID, err)
+	} else {
+		log.Printf("Lead %s replied: %q", lead.ID, in.Subject)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// forwardReply sends a prospect's reply to the business, with Reply-To set
+// to the prospect so answering it goes straight back to them. Attachments
+// are included up to ATTACHMENT_INLINE_MAX_BYTES in total.
+func forwardReply(in *PostmarkInbound, lead *Lead) error {
+	token, to, from := os.Getenv("POSTMARK_TOKEN"), os.Getenv("POSTMARK_TO"), os.Getenv("POSTMARK_FROM")
+	if token == "" || to == "" || from == "" {
+		return fmt.Errorf("missing email configuration")
+	}
+	locale := businessLocale()
+	tr := func(key string, args ...any) string {
+		return translate(locale, key, args...)
+	}
+
+	sender := (&mail.Address{Name: cmp.Or(in.FromFull.Name, in.FromName), Address: in.FromFull.Email}).String()
+	name := cmp.Or(in.FromFull.Name, in.FromName, in.FromFull.Email)
+	intro := tr("reply.unmatched", sender)
+	var links []emailLink
+	if lead != nil {
+		name = strings.TrimSpace(lead.FirstName + " " + lead.LastName)
+		intro = tr("reply.intro", name, in.FromFull.Email)
+		links = append(links, emailLink{Label: tr("notify.view_lead"), URL: adminLeadURL(lead.ID)})
+	}
+
+	var attachments []PostmarkAttachment
+	var skipped []string
+	var total int64
+	for _, a := range in.Attachments {
+		if total+a.ContentLength > inlineAttachmentMax() {
+			skipped = append(skipped, a.Name)
+			continue
+		}
+		total += a.ContentLength
+		attachments = append(attachments, PostmarkAttachment{Name: a.Name, Content: a.Content, ContentType: a.ContentType})
+	}
+	paragraphs := []string{intro, in.text()}
+	if len(skipped) > 0 {
+		paragraphs = append(paragraphs, tr("reply.skipped", strings.Join(skipped, ", ")))
+	}
+
+	subject := tr("reply.subject", name, in.Subject)
+	htmlBody, textBody := simpleEmail(locale, subject, paragraphs, links, "", "")
+	_, err := sendEmail(token, PostmarkEmail{
+		From:          from,
+		To:            to,
+		Subject:       subject,
+		TextBody:      textBody,
+		HtmlBody:      htmlBody,
+		MessageStream: "outbound",
+		ReplyTo:       sender,
+		Attachments:   attachments,
+	})
+	return err
+}
@@ -1,13 +1,36 @@
 package main
 
 import (
+	"context"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"strings"
 )
 
 func main() {
+	// Subcommands for local tooling; the server is the default
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "webhook-receiver":
+			if err := runWebhookReceiver(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "rotate-keys":
+			if err := runRotateKeys(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		case "export-leads":
+			if err := runExportLeads(os.Args[2:]); err != nil {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+
 	// Get configuration from environment
 	// Use API_PORT to avoid conflict with Caddy's PORT
 	port := os.Getenv("API_PORT")
@@ -30,13 +53,130 @@ func main() {
 		}
 	}
 
+	// Open persistent stores
+	var err error
+	keyring, err = loadKeyring()
+	if err != nil {
+		log.Fatalf("Failed to load encryption keys: %v", err)
+	}
+	leads, err = openLeadStore(dataDir())
+	if err != nil {
+		log.Fatalf("Failed to open lead store: %v", err)
+	}
+
+	suppressions, err = openSuppressionList(dataDir())
+	if err != nil {
+		log.Fatalf("Failed to open suppression list: %v", err)
+	}
+	unsubscribeSigner = newUnsubscribeSigner()
+
+	subscribers, err = openSubscriberStore(dataDir())
+	if err != nil {
+		log.Fatalf("Failed to open subscriber store: %v", err)
+	}
+	subscribeSigner = newSubscribeSigner()
+
+	audit, err = openAuditLog(dataDir())
+	if err != nil {
+		log.Fatalf("Failed to open audit log: %v", err)
+	}
+	privacySigner = newPrivacyLinkSigner()
+
+	formTokens = newFormTokenIssuer()
+	captchaVerifier = newCaptchaVerifier()
+	spamPipeline = newSpamPipeline()
+
+	scoring, err = loadScoringModel()
+	if err != nil {
+		log.Fatalf("Failed to load lead scoring model: %v", err)
+	}
+
+	bookingConfig, err = loadBookingConfig()
+	if err != nil {
+		log.Fatalf("Failed to load booking config: %v", err)
+	}
+	bookings, err = openBookingStore(dataDir(), bookingConfig)
+	if err != nil {
+		log.Fatalf("Failed to open booking store: %v", err)
+	}
+	bookingSigner = newBookingLinkSigner()
+
+	nurture, err := loadNurtureSequence()
+	if err != nil {
+		log.Fatalf("Failed to load nurture sequence: %v", err)
+	}
+	scheduler, err = newScheduler(dataDir(), nurture)
+	if err != nil {
+		log.Fatalf("Failed to open schedule: %v", err)
+	}
+
+	endpoints, err := loadWebhookEndpoints()
+	if err != nil {
+		log.Fatalf("Failed to load webhook endpoints: %v", err)
+	}
+	webhooks, err = newDispatcher(dataDir(), endpoints)
+	if err != nil {
+		log.Fatalf("Failed to open webhook delivery log: %v", err)
+	}
+	janitor = newJanitor(loadRetentionPolicy())
+	go webhooks.Run(context.Background())
+	go scheduler.Run(context.Background())
+	go janitor.Run(context.Background())
+	idempotency := newIdempotencyCache()
+
 	// Create router
 	mux := http.NewServeMux()
 
 	// Register handlers
-	mux.HandleFunc("POST /api/contact", handleContact)
+	mux.HandleFunc("POST /api/contact", idempotency.withIdempotency(handleContact))
+	mux.HandleFunc("GET /api/contact/token", handleContactToken)
+	mux.HandleFunc("GET /api/captcha/challenge", handleCaptchaChallenge)
+	mux.HandleFunc("GET /api/booking/slots", handleBookingSlots)
+	mux.HandleFunc("POST /api/booking", idempotency.withIdempotency(handleCreateBooking))
+	mux.HandleFunc("GET /api/booking/{id}/cancel", handleBookingCancel)
+	mux.HandleFunc("POST /api/booking/{id}/cancel", handleBookingCancel)
+	mux.HandleFunc("GET /api/booking/{id}/reschedule", handleBookingReschedule)
+	mux.HandleFunc("POST /api/booking/{id}/reschedule", handleBookingReschedule)
+	mux.HandleFunc("POST /api/subscribe", idempotency.withIdempotency(handleSubscribe))
+	mux.HandleFunc("GET /api/subscribe/confirm", handleSubscribeConfirm)
+	mux.HandleFunc("POST /api/subscribe/confirm", handleSubscribeConfirm)
+	mux.HandleFunc("POST /api/privacy/request", idempotency.withIdempotency(handlePrivacyRequest))
+	mux.HandleFunc("GET /api/privacy/{action}", handlePrivacyLink)
+	mux.HandleFunc("POST /api/privacy/{action}", handlePrivacyLink)
+	mux.HandleFunc("GET /api/unsubscribe", handleUnsubscribe)
+	mux.HandleFunc("POST /api/unsubscribe", handleUnsubscribe)
+	mux.HandleFunc("POST /api/webhooks/postmark", requirePostmarkAuth(handlePostmarkWebhook))
+	mux.HandleFunc("POST /api/webhooks/postmark/inbound", requirePostmarkAuth(handlePostmarkInbound))
 	mux.HandleFunc("GET /api/health", handleHealth)
 
+	// Admin API (requires ADMIN_TOKEN)
+	mux.HandleFunc("GET /api/admin/metrics", requireAdmin(metrics.ServeHTTP))
+	mux.HandleFunc("GET /api/admin/attachments/{id}", requireAdminOrAttachmentLink(handleAdminAttachment))
+	mux.HandleFunc("GET /api/admin/audit", requireAdmin(handleAdminListAudit))
+	mux.HandleFunc("GET /api/admin/bookings", requireAdmin(handleAdminListBookings))
+	mux.HandleFunc("GET /api/admin/leads", requireAdmin(handleAdminListLeads))
+	mux.HandleFunc("GET /api/admin/leads/export", requireAdmin(handleAdminExportLeads))
+	mux.HandleFunc("GET /api/admin/leads/{id}", requireAdmin(handleAdminGetLead))
+	mux.HandleFunc("POST /api/admin/leads/{id}/release", requireAdmin(handleAdminReleaseLead))
+	mux.HandleFunc("POST /api/admin/leads/{id}/reject", requireAdmin(handleAdminRejectLead))
+	mux.HandleFunc("POST /api/admin/leads/{id}/status", requireAdmin(handleAdminSetLeadStatus))
+	mux.HandleFunc("POST /api/admin/leads/{id}/unsubscribe", requireAdmin(handleAdminUnsubscribeLead))
+	mux.HandleFunc("GET /api/admin/privacy/export", requireAdmin(handleAdminPrivacyExport))
+	mux.HandleFunc("POST /api/admin/privacy/erase", requireAdmin(handleAdminPrivacyErase))
+	mux.HandleFunc("GET /api/admin/retention", requireAdmin(handleAdminRetention))
+	mux.HandleFunc("POST /api/admin/retention/run", requireAdmin(handleAdminRunRetention))
+	mux.HandleFunc("GET /api/admin/schedules", requireAdmin(handleAdminListSchedules))
+	mux.HandleFunc("GET /api/admin/schedules/{id}/preview", requireAdmin(handleAdminPreviewSchedule))
+	mux.HandleFunc("POST /api/admin/schedules/{id}/cancel", requireAdmin(handleAdminCancelSchedule))
+	mux.HandleFunc("GET /api/admin/subscribers", requireAdmin(handleAdminListSubscribers))
+	mux.HandleFunc("GET /api/admin/subscribers/export", requireAdmin(handleAdminExportSubscribers))
+	mux.HandleFunc("GET /api/admin/suppressions", requireAdmin(handleAdminListSuppressions))
+	mux.HandleFunc("POST /api/admin/suppressions", requireAdmin(handleAdminAddSuppression))
+	mux.HandleFunc("DELETE /api/admin/suppressions/{email}", requireAdmin(handleAdminRemoveSuppression))
+	mux.HandleFunc("GET /api/admin/webhooks", requireAdmin(handleAdminListWebhooks))
+	mux.HandleFunc("GET /api/admin/webhooks/{name}/deliveries", requireAdmin(handleAdminWebhookDeliveries))
+	mux.HandleFunc("POST /api/admin/webhooks/deliveries/{id}/retry", requireAdmin(handleAdminRetryDelivery))
+
 	// Wrap with CORS middleware
 	handler := corsMiddleware(mux, allowedOrigins)
 
@@ -59,7 +199,7 @@ func corsMiddleware(next http.Handler, allowedOrigins map[string]bool) http.Hand
 		}
 
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Idempotency-Key")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -75,3 +215,20 @@ func handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(`{"status":"ok"}`))
 }
+
+// clientIP returns the visitor's IP address. X-Forwarded-For is only
+// trusted when the request comes from Caddy on the loopback interface.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			// The last entry was added by Caddy itself
+			parts := strings.Split(fwd, ",")
+			return strings.TrimSpace(parts[len(parts)-1])
+		}
+	}
+	return host
+}
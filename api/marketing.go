@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Marketing endpoint kinds
+const (
+	KindMailchimp = "mailchimp"
+)
+
+// MarketingAdapter mirrors a confirmed or unsubscribed newsletter
+// subscriber into an email marketing provider. The returned status is the
+// HTTP status of the failing call.
+type MarketingAdapter interface {
+	Subscribe(ctx context.Context, sub *WebhookSubscriber) (int, error)
+	Unsubscribe(ctx context.Context, sub *WebhookSubscriber) (int, error)
+}
+
+// marketingAdapters holds the configured adapters by endpoint name, built in main
+var marketingAdapters = map[string]MarketingAdapter{}
+
+// loadMarketingEndpoints builds the adapters whose API keys are set and
+// returns a dispatcher endpoint for each, so syncs share the webhook retry
+// queue
+func loadMarketingEndpoints() []*WebhookEndpoint {
+	var endpoints []*WebhookEndpoint
+	if mc := newMailchimpAdapter(); mc != nil {
+		marketingAdapters[KindMailchimp] = mc
+		endpoints = append(endpoints, &WebhookEndpoint{Name: KindMailchimp, Kind: KindMailchimp, URL: mc.baseURL,
+			Events: []string{EventSubscriberConfirmed, EventSubscriberUnsubscribed}})
+	}
+	return endpoints
+}
+
+// syncMarketing runs a queued marketing delivery
+func syncMarketing(ctx context.Context, adapter MarketingAdapter, payload []byte) (int, error) {
+	var p WebhookPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return 0, err
+	}
+	if p.Subscriber == nil {
+		return 0, fmt.Errorf("%s is not a subscriber event", p.Event)
+	}
+	switch p.Event {
+	case EventSubscriberConfirmed:
+		return adapter.Subscribe(ctx, p.Subscriber)
+	case EventSubscriberUnsubscribed:
+		return adapter.Unsubscribe(ctx, p.Subscriber)
+	}
+	return 0, fmt.Errorf("unexpected event %s", p.Event)
+}
+
+// mailchimpAdapter keeps a Mailchimp audience in step with the subscriber
+// list, passing the double opt-in consent record along
+type mailchimpAdapter struct {
+	baseURL string
+	apiKey  string
+	listID  string
+	client  *http.Client
+}
+
+// newMailchimpAdapter builds the adapter, or returns nil unless both
+// MAILCHIMP_API_KEY and MAILCHIMP_LIST_ID are set. The API host comes from
+// the key's data center suffix; MAILCHIMP_API_URL overrides it to point at
+// a mock server.
+func newMailchimpAdapter() *mailchimpAdapter {
+	key, list := os.Getenv("MAILCHIMP_API_KEY"), os.Getenv("MAILCHIMP_LIST_ID")
+	if key == "" || list == "" {
+		return nil
+	}
+	a := &mailchimpAdapter{
+		baseURL: strings.TrimRight(os.Getenv("MAILCHIMP_API_URL"), "/"),
+		apiKey:  key,
+		listID:  list,
+		client:  &http.Client{Timeout: 15 * time.Second},
+	}
+	if a.baseURL == "" {
+		_, dc, _ := strings.Cut(key, "-")
+		a.baseURL = "https://" + dc + ".api.mailchimp.com"
+	}
+	return a
+}
+
+// mailchimpMember is the request body of the list members API
+type mailchimpMember struct {
+	EmailAddress    string `json:"email_address"`
+	Status          string `json:"status"`
+	StatusIfNew     string `json:"status_if_new,omitempty"`
+	Language        string `json:"language,omitempty"`
+	IPSignup        string `json:"ip_signup,omitempty"`
+	TimestampSignup string `json:"timestamp_signup,omitempty"`
+	IPOpt           string `json:"ip_opt,omitempty"`
+	TimestampOpt    string `json:"timestamp_opt,omitempty"`
+}
+
+// memberURL is the member's resource, keyed by the MD5 of the lowercased
+// email as Mailchimp requires
+func (a *mailchimpAdapter) memberURL(email string) string {
+	sum := md5.Sum([]byte(normalizeEmail(email)))
+	return a.baseURL + "/3.0/lists/" + a.listID + "/members/" + hex.EncodeToString(sum[:])
+}
+
+// header authenticates with the API key as the basic-auth password
+func (a *mailchimpAdapter) header() http.Header {
+	auth := base64.StdEncoding.EncodeToString([]byte("momentum:" + a.apiKey))
+	return http.Header{"Authorization": {"Basic " + auth}}
+}
+
+// Subscribe creates or resubscribes the member with its consent record
+func (a *mailchimpAdapter) Subscribe(ctx context.Context, sub *WebhookSubscriber) (int, error) {
+	member := mailchimpMember{
+		EmailAddress:    sub.Email,
+		Status:          "subscribed",
+		StatusIfNew:     "subscribed",
+		Language:        sub.Locale,
+		IPSignup:        sub.SignupIP,
+		TimestampSignup: sub.RequestedAt.UTC().Format(time.RFC3339),
+		IPOpt:           sub.ConfirmIP,
+	}
+	if sub.ConfirmedAt != nil {
+		member.TimestampOpt = sub.ConfirmedAt.UTC().Format(time.RFC3339)
+	}
+	return crmRequest(ctx, a.client, http.MethodPut, a.memberURL(sub.Email), a.header(), member, nil)
+}
+
+// Unsubscribe marks the member unsubscribed. A member Mailchimp never had
+// is already as good as unsubscribed.
+func (a *mailchimpAdapter) Unsubscribe(ctx context.Context, sub *WebhookSubscriber) (int, error) {
+	status, err := crmRequest(ctx, a.client, http.MethodPatch, a.memberURL(sub.Email), a.header(),
+		mailchimpMember{EmailAddress: sub.Email, Status: "unsubscribed"}, nil)
+	if isCRMNotFound(err) {
+		return status, nil
+	}
+	return status, err
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// emailLink is a call-to-action link in a simple email
+type emailLink struct {
+	Label string
+	URL   string
+}
+
+// simpleEmail renders the plain one-column layout used by reminders and
+// follow-ups. Paragraphs are plain text; blank lines in them start new
+// paragraphs. A non-empty unsubscribeURL adds an unsubscribe link under
+// the footer.
+func simpleEmail(locale, subject string, paragraphs []string, links []emailLink, footer, unsubscribeURL string) (string, string) {
+	tr := func(key string, args ...any) string {
+		return translate(locale, key, args...)
+	}
+
+	var bodyHTML, bodyText strings.Builder
+	for _, p := range paragraphs {
+		for _, para := range strings.Split(p, "\n\n") {
+			bodyHTML.WriteString("<p>" + strings.ReplaceAll(html.EscapeString(para), "\n", "<br>") + "</p>\n        ")
+			bodyText.WriteString(para + "\n\n")
+		}
+	}
+	for _, l := range links {
+		bodyHTML.WriteString(fmt.Sprintf(`<p><a class="button" href="%s">%s</a></p>`+"\n        ", html.EscapeString(l.URL), html.EscapeString(l.Label)))
+		bodyText.WriteString(l.Label + ": " + l.URL + "\n")
+	}
+	if len(links) > 0 {
+		bodyText.WriteString("\n")
+	}
+	footerHTML := html.EscapeString(footer)
+	if unsubscribeURL != "" {
+		footerHTML += fmt.Sprintf(` <a href="%s">%s</a>`, html.EscapeString(unsubscribeURL), tr("unsubscribe.link"))
+	}
+
+	htmlBody := fmt.Sprintf(`<!DOCTYPE html>
+<html lang="%s">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>%s</title>
+    <style>
+        body {
+            font-family: 'Manrope', -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, Oxygen, Ubuntu, Cantarell, sans-serif;
+            line-height: 1.6;
+            color: #374151;
+            max-width: 600px;
+            margin: 0 auto;
+            padding: 20px;
+            background-color: #f8fafc;
+        }
+        .email-container {
+            background: white;
+            border-radius: 12px;
+            padding: 32px;
+            border: 1px solid #e2e8f0;
+        }
+        .company-name {
+            color: #53945c;
+            font-size: 28px;
+            font-weight: 700;
+            margin: 0 0 24px 0;
+            font-family: 'Outfit', sans-serif;
+        }
+        .button {
+            display: inline-block;
+            background: #53945c;
+            color: white;
+            padding: 10px 20px;
+            border-radius: 8px;
+            font-weight: 600;
+            text-decoration: none;
+        }
+        .footer {
+            margin-top: 32px;
+            padding-top: 24px;
+            border-top: 2px solid #e5e7eb;
+            text-align: center;
+            color: #64748b;
+            font-size: 13px;
+        }
+    </style>
+</head>
+<body>
+    <div class="email-container">
+        <h1 class="company-name">Momentum Business Solutions</h1>
+        %s
+        <div class="footer">
+            <p><strong>Momentum Business Solutions</strong></p>
+            <p>%s: %s | %s: (509) 554-8022</p>
+            <p>%s</p>
+        </div>
+    </div>
+</body>
+</html>`,
+		locale,
+		html.EscapeString(subject),
+		bodyHTML.String(),
+		tr("email.email"), businessEmail, tr("email.phone"),
+		footerHTML,
+	)
+
+	textBody := fmt.Sprintf(`%s---
+Momentum Business Solutions
+%s: %s | %s: (509) 554-8022
+`,
+		bodyText.String(),
+		tr("email.email"), businessEmail, tr("email.phone"),
+	)
+	if footer != "" {
+		textBody += footer + "\n"
+	}
+	if unsubscribeURL != "" {
+		textBody += tr("unsubscribe.link") + ": " + unsubscribeURL + "\n"
+	}
+	return htmlBody, textBody
+}
+
+// reminderEmail reminds the visitor of their discovery call. step is the
+// reminder's lead time, e.g. "24h".
+func reminderEmail(b *Booking, step, from string) PostmarkEmail {
+	locale := b.Locale
+	tr := func(key string, args ...any) string {
+		return translate(locale, key, args...)
+	}
+	when := b.Start.In(b.visitorLocation()).Format(tr("booking.time"))
+
+	subject := tr("reminder.subject", when)
+	if step == "1h" {
+		subject = tr("reminder.subject_soon", when)
+	}
+	htmlBody, textBody := simpleEmail(locale, subject,
+		[]string{tr("booking.greeting", b.FirstName), tr("reminder.body", when)},
+		[]emailLink{
+			{Label: tr("booking.reschedule"), URL: bookingSigner.URL(b, bookingActionReschedule)},
+			{Label: tr("booking.cancel"), URL: bookingSigner.URL(b, bookingActionCancel)},
+		},
+		"", "")
+	return PostmarkEmail{
+		From:          from,
+		To:            b.Email,
+		Subject:       subject,
+		TextBody:      textBody,
+		HtmlBody:      htmlBody,
+		MessageStream: "outbound",
+		ReplyTo:       leadReplyAddress(b.LeadID),
+	}
+}
+
+// nurtureEmail renders a follow-up step for a lead who hasn't booked a call
+func nurtureEmail(lead *Lead, step *NurtureStep, from string) PostmarkEmail {
+	locale := lead.Locale
+	tr := func(key string, args ...any) string {
+		return translate(locale, key, args...)
+	}
+	text := func(custom map[string]string, key string) string {
+		msg, ok := custom[locale]
+		if !ok {
+			msg, ok = custom[defaultLocale]
+		}
+		if !ok {
+			msg = tr(key)
+		}
+		return strings.NewReplacer("{firstName}", lead.FirstName, "{siteUrl}", publicBaseURL()).Replace(msg)
+	}
+
+	subject := text(step.Subject, "nurture."+step.Name+".subject")
+	htmlBody, textBody := simpleEmail(locale, subject,
+		[]string{text(step.Body, "nurture."+step.Name+".body"), tr("thankyou.regards") + "\n" + tr("thankyou.signature")},
+		[]emailLink{{Label: tr("nurture.cta"), URL: bookingPageURL(lead)}},
+		tr("nurture.footer"), unsubscribeSigner.URL(lead.Email, locale))
+	return withUnsubscribe(PostmarkEmail{
+		From:     from,
+		To:       lead.Email,
+		Subject:  subject,
+		TextBody: textBody,
+		HtmlBody: htmlBody,
+		ReplyTo:  leadReplyAddress(lead.ID),
+	}, locale)
+}
+
+// bookingPageURL links to the slot picker on the success page, prefilled
+// with the lead's name and email and signed so the call books under the lead
+func bookingPageURL(lead *Lead) string {
+	q := url.Values{
+		"name":  {lead.FirstName},
+		"email": {lead.Email},
+		"lead":  {lead.ID},
+		"token": {bookingSigner.LeadToken(lead.ID, time.Now().Add(leadBookingLinkTTL))},
+	}
+	return publicBaseURL() + "/success/?" + q.Encode()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Metrics is a minimal registry of counters exposed in the Prometheus text
+// format. Counters are keyed by name plus label pairs.
+type Metrics struct {
+	mu       sync.Mutex
+	counters map[string]map[string]float64 // name -> rendered labels -> value
+	help     map[string]string
+}
+
+// metrics is the process-wide registry
+var metrics = &Metrics{
+	counters: make(map[string]map[string]float64),
+	help:     make(map[string]string),
+}
+
+// Describe sets the help text shown for a counter
+func (m *Metrics) Describe(name, help string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.help[name] = help
+}
+
+// Inc adds one to the counter with the given label pairs
+// ("key1", "value1", "key2", "value2", ...)
+func (m *Metrics) Inc(name string, labels ...string) {
+	m.Add(name, 1, labels...)
+}
+
+// Add adds delta to the counter with the given label pairs
+func (m *Metrics) Add(name string, delta float64, labels ...string) {
+	var pairs []string
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", labels[i], labels[i+1]))
+	}
+	key := strings.Join(pairs, ",")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	series, ok := m.counters[name]
+	if !ok {
+		series = make(map[string]float64)
+		m.counters[name] = series
+	}
+	series[key] += delta
+}
+
+// ServeHTTP writes every counter in the Prometheus text exposition format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.counters))
+	for name := range m.counters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, name := range names {
+		if help := m.help[name]; help != "" {
+			fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+		}
+		fmt.Fprintf(w, "# TYPE %s counter\n", name)
+
+		series := m.counters[name]
+		keys := make([]string, 0, len(series))
+		for key := range series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if key == "" {
+				fmt.Fprintf(w, "%s %g\n", name, series[key])
+			} else {
+				fmt.Fprintf(w, "%s{%s} %g\n", name, key, series[key])
+			}
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Endpoint kinds. Chat kinds post a rendered card to an incoming-webhook
+// URL instead of the signed JSON payload.
+const (
+	KindWebhook = "webhook"
+	KindSlack   = "slack"
+	KindDiscord = "discord"
+	KindTeams   = "teams"
+)
+
+// chatNotifierEnv maps each chat kind to the environment variable holding
+// its incoming-webhook URL. Each one is enabled independently.
+var chatNotifierEnv = map[string]string{
+	KindSlack:   "SLACK_WEBHOOK_URL",
+	KindDiscord: "DISCORD_WEBHOOK_URL",
+	KindTeams:   "TEAMS_WEBHOOK_URL",
+}
+
+// loadChatNotifiers returns an endpoint for every chat kind with a URL set.
+// They only receive lead.created.
+func loadChatNotifiers() []*WebhookEndpoint {
+	var endpoints []*WebhookEndpoint
+	for _, kind := range []string{KindSlack, KindDiscord, KindTeams} {
+		if url := os.Getenv(chatNotifierEnv[kind]); url != "" {
+			endpoints = append(endpoints, &WebhookEndpoint{
+				Name:   kind,
+				Kind:   kind,
+				URL:    url,
+				Events: []string{EventLeadCreated},
+			})
+		}
+	}
+	return endpoints
+}
+
+// adminLeadURL returns the admin API link for a lead
+func adminLeadURL(id string) string {
+	return publicBaseURL() + "/api/admin/leads/" + id
+}
+
+// leadCard holds the compact lead summary shared by every chat format
+type leadCard struct {
+	Title    string
+	Name     string
+	Email    string
+	Phone    string
+	Revenue  string
+	Services string
+	Link     string
+	LinkText string
+	Labels   map[string]string
+}
+
+func newLeadCard(lead *Lead) leadCard {
+	locale := businessLocale()
+	services := make([]string, len(lead.Services))
+	for i, s := range lead.Services {
+		services[i] = formatService(s)
+	}
+	return leadCard{
+		Title:    priorityBadge(locale, lead.Priority),
+		Name:     strings.TrimSpace(lead.FirstName + " " + lead.LastName),
+		Email:    orDash(lead.Email),
+		Phone:    orDash(lead.PhoneNumber),
+		Revenue:  orDash(formatRevenue(lead.AnnualRevenue)),
+		Services: orDash(strings.Join(services, ", ")),
+		Link:     adminLeadURL(lead.ID),
+		LinkText: translate(locale, "notify.view_lead"),
+		Labels: map[string]string{
+			"email":    translate(locale, "notify.email"),
+			"phone":    translate(locale, "notify.phone"),
+			"revenue":  translate(locale, "notify.revenue"),
+			"services": translate(locale, "notify.services_heading"),
+		},
+	}
+}
+
+// orDash stands in for empty values, which Discord rejects in embed fields
+func orDash(s string) string {
+	if s == "" {
+		return "—"
+	}
+	return s
+}
+
+// renderChat builds the request body for a chat endpoint
+func renderChat(kind string, lead *Lead) ([]byte, error) {
+	card := newLeadCard(lead)
+	switch kind {
+	case KindSlack:
+		return json.Marshal(slackMessage(card))
+	case KindDiscord:
+		return json.Marshal(discordMessage(card))
+	case KindTeams:
+		return json.Marshal(teamsMessage(card))
+	}
+	return nil, fmt.Errorf("unknown notifier kind %q", kind)
+}
+
+// slackMessage renders the card with Block Kit
+func slackMessage(c leadCard) map[string]any {
+	field := func(label, value string) map[string]string {
+		return map[string]string{"type": "mrkdwn", "text": fmt.Sprintf("*%s*\n%s", label, value)}
+	}
+	return map[string]any{
+		"text": fmt.Sprintf("%s: %s", c.Title, c.Name),
+		"blocks": []any{
+			map[string]any{
+				"type": "header",
+				"text": map[string]string{"type": "plain_text", "text": c.Title + ": " + c.Name},
+			},
+			map[string]any{
+				"type": "section",
+				"fields": []any{
+					field(c.Labels["email"], c.Email),
+					field(c.Labels["phone"], c.Phone),
+					field(c.Labels["revenue"], c.Revenue),
+					field(c.Labels["services"], c.Services),
+				},
+			},
+			map[string]any{
+				"type": "actions",
+				"elements": []any{map[string]any{
+					"type": "button",
+					"text": map[string]string{"type": "plain_text", "text": c.LinkText},
+					"url":  c.Link,
+				}},
+			},
+		},
+	}
+}
+
+// discordMessage renders the card as an embed
+func discordMessage(c leadCard) map[string]any {
+	field := func(label, value string, inline bool) map[string]any {
+		return map[string]any{"name": label, "value": value, "inline": inline}
+	}
+	return map[string]any{
+		"embeds": []any{map[string]any{
+			"title": c.Title + ": " + c.Name,
+			"url":   c.Link,
+			"color": 0x1e40af,
+			"fields": []any{
+				field(c.Labels["email"], c.Email, true),
+				field(c.Labels["phone"], c.Phone, true),
+				field(c.Labels["revenue"], c.Revenue, false),
+				field(c.Labels["services"], c.Services, false),
+			},
+		}},
+	}
+}
+
+// teamsMessage renders the card as an Adaptive Card, as accepted by Teams
+// workflow incoming webhooks
+func teamsMessage(c leadCard) map[string]any {
+	fact := func(label, value string) map[string]string {
+		return map[string]string{"title": label, "value": value}
+	}
+	return map[string]any{
+		"type": "message",
+		"attachments": []any{map[string]any{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content": map[string]any{
+				"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+				"type":    "AdaptiveCard",
+				"version": "1.4",
+				"body": []any{
+					map[string]any{"type": "TextBlock", "size": "Medium", "weight": "Bolder", "text": c.Title + ": " + c.Name},
+					map[string]any{"type": "FactSet", "facts": []any{
+						fact(c.Labels["email"], c.Email),
+						fact(c.Labels["phone"], c.Phone),
+						fact(c.Labels["revenue"], c.Revenue),
+						fact(c.Labels["services"], c.Services),
+					}},
+				},
+				"actions": []any{map[string]string{"type": "Action.OpenUrl", "title": c.LinkText, "url": c.Link}},
+			},
+		}},
+	}
+}
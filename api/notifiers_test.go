@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// chatMessage renders the lead's card for a chat kind and decodes it
+func chatMessage(t *testing.T, kind string, lead *Lead) map[string]any {
+	t.Helper()
+	t.Setenv("PUBLIC_BASE_URL", "https://example.org")
+	t.Setenv("BUSINESS_LOCALE", "en")
+
+	data, err := renderChat(kind, lead)
+	if err != nil {
+		t.Fatalf("renderChat: %v", err)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(data, &body); err != nil {
+		t.Fatalf("body is not a JSON object: %v\n%s", err, data)
+	}
+	return body
+}
+
+// jsonPath walks decoded JSON through object keys and array indexes
+func jsonPath(t *testing.T, v any, keys ...any) any {
+	t.Helper()
+	for _, key := range keys {
+		switch k := key.(type) {
+		case string:
+			obj, ok := v.(map[string]any)
+			if !ok {
+				t.Fatalf("expected an object at %q, got %T", k, v)
+			}
+			v = obj[k]
+		case int:
+			arr, ok := v.([]any)
+			if !ok || k >= len(arr) {
+				t.Fatalf("expected an array with index %d, got %v", k, v)
+			}
+			v = arr[k]
+		}
+	}
+	return v
+}
+
+func TestSlackNotification(t *testing.T) {
+	lead := testLead()
+	body := chatMessage(t, KindSlack, lead)
+
+	if text, _ := body["text"].(string); !strings.Contains(text, "Ana García") {
+		t.Errorf("fallback text = %q, want the lead's name", text)
+	}
+	if got := jsonPath(t, body, "blocks", 0, "type"); got != "header" {
+		t.Errorf("first block type = %v, want header", got)
+	}
+	fields := jsonPath(t, body, "blocks", 1, "fields").([]any)
+	if len(fields) != 4 {
+		t.Fatalf("got %d section fields, want 4", len(fields))
+	}
+	for i, want := range []string{lead.Email, lead.PhoneNumber, "$100,000 - $500,000", "Essentials Package, Financial Consulting"} {
+		if got := jsonPath(t, fields[i], "type"); got != "mrkdwn" {
+			t.Errorf("field %d type = %v, want mrkdwn", i, got)
+		}
+		if text := jsonPath(t, fields[i], "text").(string); !strings.HasSuffix(text, "\n"+want) {
+			t.Errorf("field %d = %q, want value %q", i, text, want)
+		}
+	}
+	button := jsonPath(t, body, "blocks", 2, "elements", 0)
+	if got := jsonPath(t, button, "url"); got != "https://example.org/api/admin/leads/"+lead.ID {
+		t.Errorf("button url = %v", got)
+	}
+}
+
+func TestDiscordNotification(t *testing.T) {
+	lead := testLead()
+	lead.PhoneNumber = ""
+	body := chatMessage(t, KindDiscord, lead)
+
+	embed := jsonPath(t, body, "embeds", 0)
+	if title, _ := jsonPath(t, embed, "title").(string); !strings.HasSuffix(title, ": Ana García") {
+		t.Errorf("title = %q", title)
+	}
+	if got := jsonPath(t, embed, "url"); got != "https://example.org/api/admin/leads/"+lead.ID {
+		t.Errorf("url = %v", got)
+	}
+	fields := jsonPath(t, embed, "fields").([]any)
+	if len(fields) != 4 {
+		t.Fatalf("got %d fields, want 4", len(fields))
+	}
+	// Discord rejects empty field values
+	if got := jsonPath(t, fields[1], "value"); got != "—" {
+		t.Errorf("empty phone rendered as %q, want a dash", got)
+	}
+	if got := jsonPath(t, fields[0], "inline"); got != true {
+		t.Errorf("email field inline = %v, want true", got)
+	}
+}
+
+func TestTeamsNotification(t *testing.T) {
+	lead := testLead()
+	body := chatMessage(t, KindTeams, lead)
+
+	if got := body["type"]; got != "message" {
+		t.Errorf("type = %v, want message", got)
+	}
+	attachment := jsonPath(t, body, "attachments", 0)
+	if got := jsonPath(t, attachment, "contentType"); got != "application/vnd.microsoft.card.adaptive" {
+		t.Errorf("contentType = %v", got)
+	}
+	card := jsonPath(t, attachment, "content")
+	if got := jsonPath(t, card, "type"); got != "AdaptiveCard" {
+		t.Errorf("card type = %v, want AdaptiveCard", got)
+	}
+	facts := jsonPath(t, card, "body", 1, "facts").([]any)
+	if len(facts) != 4 || jsonPath(t, facts[0], "value") != lead.Email {
+		t.Errorf("facts = %v", facts)
+	}
+	action := jsonPath(t, card, "actions", 0)
+	if jsonPath(t, action, "type") != "Action.OpenUrl" || jsonPath(t, action, "url") != "https://example.org/api/admin/leads/"+lead.ID {
+		t.Errorf("action = %v", action)
+	}
+}
+
+func TestChatEndpointDelivery(t *testing.T) {
+	type received struct {
+		path, contentType string
+		body              []byte
+	}
+	requests := make(chan received, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- received{r.URL.Path, r.Header.Get("Content-Type"), body}
+	}))
+	defer server.Close()
+	t.Setenv("SLACK_WEBHOOK_URL", server.URL+"/hook")
+	t.Setenv("DISCORD_WEBHOOK_URL", "")
+	t.Setenv("TEAMS_WEBHOOK_URL", "")
+	t.Setenv("PUBLIC_BASE_URL", "https://example.org")
+	endpoints := loadChatNotifiers()
+	if len(endpoints) != 1 {
+		t.Fatalf("got %d chat endpoints, want only Slack", len(endpoints))
+	}
+	d := newTestDispatcher(t, t.TempDir(), endpoints...)
+
+	lead := testLead()
+	d.Enqueue(EventLeadCreated, lead)
+	d.attempt(endpoints[0], onlyDelivery(t, d, KindSlack).ID)
+
+	// The endpoint gets the card in place of the shared payload
+	req := <-requests
+	want, _ := renderChat(KindSlack, lead)
+	if req.path != "/hook" || req.contentType != "application/json" {
+		t.Errorf("posted to %s as %q", req.path, req.contentType)
+	}
+	if !bytes.Equal(req.body, want) {
+		t.Errorf("body = %s, want the Slack card %s", req.body, want)
+	}
+}
+
+func TestChatEndpointsSkipOtherEvents(t *testing.T) {
+	t.Setenv("SLACK_WEBHOOK_URL", "https://hooks.slack.example/services/T0/B0/x")
+	d := newTestDispatcher(t, t.TempDir(), loadChatNotifiers()...)
+
+	d.Enqueue(EventLeadUpdated, testLead())
+	if got := d.Deliveries(KindSlack); len(got) != 0 {
+		t.Errorf("queued %d deliveries for lead.updated, want none", len(got))
+	}
+}
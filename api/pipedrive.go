@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultPipedriveURL is the Pipedrive API base; PIPEDRIVE_API_URL overrides
+// it with a company domain or a mock server
+const defaultPipedriveURL = "https://api.pipedrive.com/v1"
+
+// pipedriveAdapter syncs leads to Pipedrive persons and deals using an API
+// token
+type pipedriveAdapter struct {
+	baseURL       string
+	token         string
+	revenueField  string
+	servicesField string
+	client        *http.Client
+}
+
+// newPipedriveAdapter builds the adapter, or returns nil if PIPEDRIVE_TOKEN
+// isn't set. PIPEDRIVE_REVENUE_FIELD and PIPEDRIVE_SERVICES_FIELD are the
+// API keys (40-character hashes) of the deal custom fields AnnualRevenue and
+// Services are written to; empty skips them.
+func newPipedriveAdapter() *pipedriveAdapter {
+	token := os.Getenv("PIPEDRIVE_TOKEN")
+	if token == "" {
+		return nil
+	}
+	a := &pipedriveAdapter{
+		baseURL:       strings.TrimRight(os.Getenv("PIPEDRIVE_API_URL"), "/"),
+		token:         token,
+		revenueField:  os.Getenv("PIPEDRIVE_REVENUE_FIELD"),
+		servicesField: os.Getenv("PIPEDRIVE_SERVICES_FIELD"),
+		client:        &http.Client{Timeout: 15 * time.Second},
+	}
+	if a.baseURL == "" {
+		a.baseURL = defaultPipedriveURL
+	}
+	return a
+}
+
+// pipedriveResponse wraps every Pipedrive API response
+type pipedriveResponse[T any] struct {
+	Success bool `json:"success"`
+	Data    T    `json:"data"`
+}
+
+type pipedriveRecord struct {
+	ID int `json:"id"`
+}
+
+func (a *pipedriveAdapter) url(path string, query url.Values) string {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("api_token", a.token)
+	return a.baseURL + path + "?" + query.Encode()
+}
+
+func (a *pipedriveAdapter) Sync(ctx context.Context, lead *Lead, ref CRMRef) (CRMRef, int, error) {
+	person := map[string]any{
+		"name":  strings.TrimSpace(lead.FirstName + " " + lead.LastName),
+		"email": []map[string]any{{"value": lead.Email, "primary": true, "label": "work"}},
+	}
+	if lead.PhoneNumber != "" {
+		person["phone"] = []map[string]any{{"value": lead.PhoneNumber, "primary": true, "label": "work"}}
+	}
+
+	// Match an existing person by email if we haven't synced this lead yet
+	if ref.ContactID == "" {
+		id, status, err := a.findPerson(ctx, lead.Email)
+		if err != nil {
+			return ref, status, err
+		}
+		ref.ContactID = id
+	}
+	if status, err := a.upsert(ctx, "/persons", &ref.ContactID, person); err != nil {
+		return ref, status, err
+	}
+
+	personID, _ := strconv.Atoi(ref.ContactID)
+	deal := map[string]any{
+		"title":     dealTitle(lead),
+		"person_id": personID,
+	}
+	if a.revenueField != "" {
+		deal[a.revenueField] = formatRevenue(lead.AnnualRevenue)
+	}
+	if a.servicesField != "" {
+		deal[a.servicesField] = strings.Join(serviceLabels(lead), ", ")
+	}
+	created := ref.DealID == ""
+	status, err := a.upsert(ctx, "/deals", &ref.DealID, deal)
+	if err != nil {
+		return ref, status, err
+	}
+
+	// Keep the prospect's message with the deal the first time round
+	if created && lead.Message != "" {
+		dealID, _ := strconv.Atoi(ref.DealID)
+		note := map[string]any{"content": lead.Message, "deal_id": dealID, "person_id": personID}
+		if status, err := crmRequest(ctx, a.client, "POST", a.url("/notes", nil), nil, note, nil); err != nil {
+			return ref, status, err
+		}
+	}
+	return ref, status, nil
+}
+
+// upsert updates the record at path/*id, or creates it if *id is empty or
+// the record was deleted in Pipedrive, storing the new ID in *id
+func (a *pipedriveAdapter) upsert(ctx context.Context, path string, id *string, fields map[string]any) (int, error) {
+	if *id != "" {
+		status, err := crmRequest(ctx, a.client, "PUT", a.url(path+"/"+*id, nil), nil, fields, nil)
+		if !isCRMNotFound(err) {
+			return status, err
+		}
+	}
+	var created pipedriveResponse[pipedriveRecord]
+	status, err := crmRequest(ctx, a.client, "POST", a.url(path, nil), nil, fields, &created)
+	if err != nil {
+		return status, err
+	}
+	*id = strconv.Itoa(created.Data.ID)
+	return status, nil
+}
+
+// findPerson returns the ID of the person with the given email, or ""
+func (a *pipedriveAdapter) findPerson(ctx context.Context, email string) (string, int, error) {
+	query := url.Values{"term": {email}, "fields": {"email"}, "exact_match": {"true"}, "limit": {"1"}}
+	var result pipedriveResponse[struct {
+		Items []struct {
+			Item pipedriveRecord `json:"item"`
+		} `json:"items"`
+	}]
+	status, err := crmRequest(ctx, a.client, "GET", a.url("/persons/search", query), nil, nil, &result)
+	if err != nil || len(result.Data.Items) == 0 {
+		return "", status, err
+	}
+	return strconv.Itoa(result.Data.Items[0].Item.ID), status, nil
+}
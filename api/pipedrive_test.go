@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+// pipedriveAt returns an adapter for the Pipedrive API at baseURL
+func pipedriveAt(t *testing.T, baseURL string) *pipedriveAdapter {
+	t.Helper()
+	t.Setenv("PIPEDRIVE_TOKEN", "pd-test")
+	t.Setenv("PIPEDRIVE_API_URL", baseURL+"/v1")
+	t.Setenv("PIPEDRIVE_REVENUE_FIELD", "a1b2c3")
+	t.Setenv("PIPEDRIVE_SERVICES_FIELD", "d4e5f6")
+	return newPipedriveAdapter()
+}
+
+func TestPipedriveCreatesPersonDealAndNote(t *testing.T) {
+	server := newFakeCRM(t, map[string]crmResponse{
+		"GET /v1/persons/search": {body: `{"success":true,"data":{"items":[]}}`},
+		"POST /v1/persons":       {body: `{"success":true,"data":{"id":301}}`},
+		"POST /v1/deals":         {body: `{"success":true,"data":{"id":402}}`},
+		"POST /v1/notes":         {body: `{"success":true,"data":{"id":503}}`},
+	})
+	lead := testLead()
+
+	ref, _, err := pipedriveAt(t, server.URL).Sync(context.Background(), lead, CRMRef{})
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if ref.ContactID != "301" || ref.DealID != "402" {
+		t.Errorf("ref = %+v, want person 301 and deal 402", ref)
+	}
+
+	calls := server.Calls()
+	for _, c := range calls {
+		if got := c.query.Get("api_token"); got != "pd-test" {
+			t.Errorf("%s: api_token = %q", c.route, got)
+		}
+	}
+	want := []string{"GET /v1/persons/search", "POST /v1/persons", "POST /v1/deals", "POST /v1/notes"}
+	if routes := server.Routes(); !slices.Equal(routes, want) {
+		t.Fatalf("calls = %q, want %q", routes, want)
+	}
+
+	if search := calls[0].query; search.Get("term") != lead.Email || search.Get("fields") != "email" || search.Get("exact_match") != "true" {
+		t.Errorf("search query = %v", search)
+	}
+
+	var person map[string]any
+	calls[1].decode(t, &person)
+	if person["name"] != "Ana García" {
+		t.Errorf("person name = %v", person["name"])
+	}
+	email := person["email"].([]any)[0].(map[string]any)
+	if email["value"] != lead.Email || email["primary"] != true {
+		t.Errorf("person email = %v", email)
+	}
+	phone := person["phone"].([]any)[0].(map[string]any)
+	if phone["value"] != lead.PhoneNumber {
+		t.Errorf("person phone = %v", phone)
+	}
+
+	var deal map[string]any
+	calls[2].decode(t, &deal)
+	wantDeal := map[string]any{
+		"title":     "Ana García - Website Lead",
+		"person_id": float64(301),
+		"a1b2c3":    "$100,000 - $500,000",
+		"d4e5f6":    "Essentials Package, Financial Consulting",
+	}
+	for k, v := range wantDeal {
+		if deal[k] != v {
+			t.Errorf("deal %s = %v, want %v", k, deal[k], v)
+		}
+	}
+
+	var note map[string]any
+	calls[3].decode(t, &note)
+	if note["content"] != lead.Message || note["deal_id"] != float64(402) || note["person_id"] != float64(301) {
+		t.Errorf("note = %v", note)
+	}
+}
+
+func TestPipedriveMatchesExistingPerson(t *testing.T) {
+	server := newFakeCRM(t, map[string]crmResponse{
+		"GET /v1/persons/search": {body: `{"success":true,"data":{"items":[{"result_score":1,"item":{"id":77}}]}}`},
+		"PUT /v1/persons/77":     {body: `{"success":true,"data":{"id":77}}`},
+		"POST /v1/deals":         {body: `{"success":true,"data":{"id":402}}`},
+		"POST /v1/notes":         {body: `{"success":true,"data":{"id":503}}`},
+	})
+
+	ref, _, err := pipedriveAt(t, server.URL).Sync(context.Background(), testLead(), CRMRef{})
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if ref.ContactID != "77" {
+		t.Errorf("person = %q, want the existing 77", ref.ContactID)
+	}
+	want := []string{"GET /v1/persons/search", "PUT /v1/persons/77", "POST /v1/deals", "POST /v1/notes"}
+	if routes := server.Routes(); !slices.Equal(routes, want) {
+		t.Fatalf("calls = %q, want %q", routes, want)
+	}
+	var deal map[string]any
+	server.Calls()[2].decode(t, &deal)
+	if got := deal["person_id"]; got != float64(77) {
+		t.Errorf("deal person_id = %v, want 77", got)
+	}
+}
+
+func TestPipedriveUpdatesSyncedRecords(t *testing.T) {
+	server := newFakeCRM(t, map[string]crmResponse{
+		"PUT /v1/persons/301": {body: `{"success":true,"data":{"id":301}}`},
+		"PUT /v1/deals/402":   {body: `{"success":true,"data":{"id":402}}`},
+	})
+
+	ref, _, err := pipedriveAt(t, server.URL).Sync(context.Background(), testLead(), CRMRef{ContactID: "301", DealID: "402"})
+	if err != nil {
+		t.Fatalf("Sync: %v", err)
+	}
+	if ref.ContactID != "301" || ref.DealID != "402" {
+		t.Errorf("ref = %+v, want the existing IDs", ref)
+	}
+	// The note is only added when the deal is created
+	want := []string{"PUT /v1/persons/301", "PUT /v1/deals/402"}
+	if routes := server.Routes(); !slices.Equal(routes, want) {
+		t.Errorf("calls = %q, want %q", routes, want)
+	}
+}
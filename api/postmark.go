@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// PostmarkEvent is the subset of Postmark's delivery, bounce, spam
+// complaint, open and subscription change webhook payloads we act on
+type PostmarkEvent struct {
+	RecordType  string `json:"RecordType"`
+	Type        string `json:"Type"`
+	MessageID   string `json:"MessageID"`
+	Email       string `json:"Email"`
+	Recipient   string `json:"Recipient"`
+	Description string `json:"Description"`
+	Details     string `json:"Details"`
+	Inactive    bool   `json:"Inactive"`
+	FirstOpen   bool   `json:"FirstOpen"`
+
+	DeliveredAt string `json:"DeliveredAt"`
+	BouncedAt   string `json:"BouncedAt"`
+	ReceivedAt  string `json:"ReceivedAt"`
+	ChangedAt   string `json:"ChangedAt"`
+
+	// SubscriptionChange
+	SuppressSending   bool   `json:"SuppressSending"`
+	SuppressionReason string `json:"SuppressionReason"`
+}
+
+// at returns when the event happened, or now if Postmark didn't say
+func (ev PostmarkEvent) at() time.Time {
+	for _, v := range []string{ev.DeliveredAt, ev.BouncedAt, ev.ReceivedAt, ev.ChangedAt} {
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Now().UTC()
+}
+
+// detail summarizes the event for the lead timeline
+func (ev PostmarkEvent) detail() string {
+	switch ev.RecordType {
+	case "Bounce":
+		return strings.TrimSpace(ev.Type + ": " + ev.Description)
+	case "Delivery":
+		return ev.Details
+	}
+	return ""
+}
+
+// hardBounceTypes are Postmark bounce types meaning the address can't
+// receive mail; soft bounces (full mailbox, greylisting) are ignored
+var hardBounceTypes = map[string]bool{
+	"HardBounce":          true,
+	"BadEmailAddress":     true,
+	"ManuallyDeactivated": true,
+}
+
+// requirePostmarkAuth checks that a webhook comes from Postmark: the
+// basic-auth credentials in the webhook URL (POSTMARK_WEBHOOK_USER and
+// POSTMARK_WEBHOOK_PASSWORD), the sender's IP (POSTMARK_WEBHOOK_IPS, a
+// comma-separated list of addresses or CIDR ranges), or both. Each check
+// that's configured must pass; with neither the endpoint is disabled.
+func requirePostmarkAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		wantUser, wantPass := os.Getenv("POSTMARK_WEBHOOK_USER"), os.Getenv("POSTMARK_WEBHOOK_PASSWORD")
+		allowed := os.Getenv("POSTMARK_WEBHOOK_IPS")
+		checkAuth := wantUser != "" && wantPass != ""
+		if !checkAuth && allowed == "" {
+			http.NotFound(w, r)
+			return
+		}
+		if allowed != "" && !ipAllowed(clientIP(r), allowed) {
+			log.Printf("Postmark webhook from IP %s not in allowlist", clientIP(r))
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if checkAuth {
+			user, pass, ok := r.BasicAuth()
+			if !ok ||
+				subtle.ConstantTimeCompare([]byte(user), []byte(wantUser)) != 1 ||
+				subtle.ConstantTimeCompare([]byte(pass), []byte(wantPass)) != 1 {
+				log.Printf("Unauthorized Postmark webhook from IP: %s", clientIP(r))
+				w.Header().Set("WWW-Authenticate", `Basic realm="postmark"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		next(w, r)
+	}
+}
+
+// ipAllowed reports whether ip matches an entry of a comma-separated list
+// of addresses and CIDR ranges
+func ipAllowed(ip, list string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(addr) {
+				return true
+			}
+		} else if allowedIP := net.ParseIP(entry); allowedIP != nil && allowedIP.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// handlePostmarkWebhook records deliveries, bounces, spam complaints and
+// opens on the timeline of the lead the message went to, and feeds hard
+// bounces, complaints and Postmark suppression changes into the
+// suppression list. Other record types are acknowledged and ignored, so
+// one webhook URL can carry them all.
+func handlePostmarkWebhook(w http.ResponseWriter, r *http.Request) {
+	var ev PostmarkEvent
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes())).Decode(&ev); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	switch ev.RecordType {
+	case "Delivery":
+		recordDeliveryEvent(ev, LeadEventDelivered, false)
+	case "Open":
+		if ev.FirstOpen {
+			recordDeliveryEvent(ev, LeadEventOpened, false)
+		}
+	case "Bounce":
+		hard := hardBounceTypes[ev.Type] || ev.Inactive
+		if hard {
+			if _, err = suppressions.Add(ev.Email, SuppressHardBounce, "postmark", ev.detail()); err != nil {
+				break
+			}
+		}
+		recordDeliveryEvent(ev, LeadEventBounced, hard)
+	case "SpamComplaint":
+		if _, err = suppressions.Add(ev.Email, SuppressSpamComplaint, "postmark", ""); err == nil {
+			recordDeliveryEvent(ev, LeadEventSpamComplaint, false)
+		}
+	case "SubscriptionChange":
+		err = postmarkSubscriptionChange(ev)
+	}
+	if err != nil {
+		// A non-2xx answer makes Postmark retry
+		log.Printf("Failed to handle Postmark %s for message %s: %v", ev.RecordType, ev.MessageID, err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// postmarkSubscriptionChange mirrors a suppression added or lifted in
+// Postmark. Only entries Postmark created are lifted, never an unsubscribe
+// made through our own links.
+func postmarkSubscriptionChange(ev PostmarkEvent) error {
+	if !ev.SuppressSending {
+		if e := suppressions.Get(ev.Recipient); e != nil && e.Source == "postmark" {
+			log.Printf("Postmark reactivated %s", e.Email)
+			return suppressions.Remove(ev.Recipient)
+		}
+		return nil
+	}
+	switch ev.SuppressionReason {
+	case "HardBounce":
+		_, err := suppressions.Add(ev.Recipient, SuppressHardBounce, "postmark", "")
+		return err
+	case "SpamComplaint":
+		_, err := suppressions.Add(ev.Recipient, SuppressSpamComplaint, "postmark", "")
+		return err
+	default:
+		return unsubscribe(ev.Recipient, "postmark")
+	}
+}
@@ -0,0 +1,616 @@
+package main
+
+import (
+	"cmp"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultPrivacyPolicyVersion is the Last Updated date of content/privacy.md
+const defaultPrivacyPolicyVersion = "2025-08-12"
+
+// Privacy request actions, which are also the self-service link paths
+const (
+	PrivacyExport = "export"
+	PrivacyErase  = "erase"
+)
+
+// Erasure modes. Anonymizing keeps leads and bookings for reporting with
+// the person's details stripped; deleting removes them outright.
+const (
+	EraseAnonymize = "anonymize"
+	EraseDelete    = "delete"
+)
+
+// defaultPrivacyLinkTTL is how long an emailed export or erase link works
+const defaultPrivacyLinkTTL = 24 * time.Hour
+
+// Privacy link errors
+var (
+	errPrivacyLinkInvalid = errors.New("invalid privacy link")
+	errPrivacyLinkExpired = errors.New("privacy link expired")
+)
+
+// Consent records whether a submission agreed to the privacy policy, and
+// which version of it. The fields describe the lead's first submission;
+// later ones that grant or withdraw consent, or agree to a newer version,
+// are appended to History, so the original record is never lost.
+type Consent struct {
+	Given         bool            `json:"given"`
+	PolicyVersion string          `json:"policyVersion"`
+	At            time.Time       `json:"at"`
+	History       []ConsentChange `json:"history,omitempty"`
+}
+
+// ConsentChange is a later submission that changed the lead's consent
+type ConsentChange struct {
+	Given         bool      `json:"given"`
+	PolicyVersion string    `json:"policyVersion"`
+	At            time.Time `json:"at"`
+}
+
+// privacyPolicyVersion is the version of the privacy policy in force,
+// from PRIVACY_POLICY_VERSION
+func privacyPolicyVersion() string {
+	return cmp.Or(os.Getenv("PRIVACY_POLICY_VERSION"), defaultPrivacyPolicyVersion)
+}
+
+// consentRequired reports whether submissions must tick the consent box
+func consentRequired() bool {
+	return envBool("CONSENT_REQUIRED", false)
+}
+
+// newConsent records the consent given with a submission at
+func newConsent(form *ContactForm, at time.Time) *Consent {
+	return &Consent{Given: form.Consent, PolicyVersion: privacyPolicyVersion(), At: at.UTC()}
+}
+
+// Current returns whether consent is given now, and for which version
+func (c *Consent) Current() (bool, string) {
+	if n := len(c.History); n > 0 {
+		return c.History[n-1].Given, c.History[n-1].PolicyVersion
+	}
+	return c.Given, c.PolicyVersion
+}
+
+// record adds a repeat submission's consent to the history if it changes
+// what's currently given
+func (c *Consent) record(form *ContactForm, at time.Time) {
+	given, version := c.Current()
+	if form.Consent == given && privacyPolicyVersion() == version {
+		return
+	}
+	c.History = append(c.History, ConsentChange{Given: form.Consent, PolicyVersion: privacyPolicyVersion(), At: at.UTC()})
+}
+
+// SubjectData is everything stored about one email address, as returned by
+// an export
+type SubjectData struct {
+	Email             string              `json:"email"`
+	GeneratedAt       time.Time           `json:"generatedAt"`
+	Leads             []*Lead             `json:"leads"` // with emails sent, timeline, replies and consent
+	Bookings          []*Booking          `json:"bookings"`
+	ScheduledEmails   []*ScheduledMessage `json:"scheduledEmails"`
+	WebhookDeliveries []*Delivery         `json:"webhookDeliveries"`
+	Subscriber        *Subscriber         `json:"subscriber,omitempty"`
+	Suppression       *Suppression        `json:"suppression,omitempty"`
+}
+
+// empty reports whether nothing is stored about the address
+func (d *SubjectData) empty() bool {
+	return len(d.Leads) == 0 && len(d.Bookings) == 0 && d.Subscriber == nil && d.Suppression == nil
+}
+
+// leadIDs returns the IDs of the subject's leads
+func (d *SubjectData) leadIDs() []string {
+	ids := make([]string, len(d.Leads))
+	for i, l := range d.Leads {
+		ids[i] = l.ID
+	}
+	return ids
+}
+
+// belongs reports whether a webhook delivery carries the subject's data
+func (d *SubjectData) belongs(del *Delivery) bool {
+	if del.LeadID != "" && slices.Contains(d.leadIDs(), del.LeadID) {
+		return true
+	}
+	return d.Subscriber != nil && del.SubscriberID == d.Subscriber.ID
+}
+
+// collectSubjectData gathers what every store holds about an email address.
+// Bookings made from a lead's emailed link count even if the visitor typed
+// a different address.
+func collectSubjectData(email string) *SubjectData {
+	key := normalizeEmail(email)
+	d := &SubjectData{Email: key, GeneratedAt: time.Now().UTC()}
+	d.Leads = leads.ByEmail(key)
+	ids := d.leadIDs()
+	same := emailMatcher(key)
+	d.Bookings = bookings.List(func(b *Booking) bool {
+		return same(b.Email, b.EmailIndex) || (b.LeadID != "" && slices.Contains(ids, b.LeadID))
+	})
+	d.ScheduledEmails = scheduler.List(func(m *ScheduledMessage) bool {
+		if m.LeadID != "" && slices.Contains(ids, m.LeadID) {
+			return true
+		}
+		return slices.ContainsFunc(d.Bookings, func(b *Booking) bool { return b.ID == m.BookingID })
+	})
+	d.Subscriber = subscribers.ByEmail(key)
+	d.Suppression = suppressions.Get(key)
+	d.WebhookDeliveries = webhooks.Find(d.belongs)
+	if d.Leads == nil {
+		d.Leads = []*Lead{}
+	}
+	if d.Bookings == nil {
+		d.Bookings = []*Booking{}
+	}
+	return d
+}
+
+// ErasureReport counts what an erasure removed or anonymized. CRM lists
+// the records synced to external CRMs, which must be erased there.
+type ErasureReport struct {
+	Mode              string            `json:"mode"`
+	Leads             int               `json:"leads"`
+	Bookings          int               `json:"bookings"`
+	Attachments       int               `json:"attachments"`
+	WebhookDeliveries int               `json:"webhookDeliveries"`
+	Subscriber        bool              `json:"subscriber"`
+	Suppression       bool              `json:"suppression"`
+	CRM               map[string]string `json:"crm,omitempty"` // CRM name to contact ID
+}
+
+// eraseSubjectData erases or anonymizes everything stored about an email
+// address. A confirmed newsletter subscriber is unsubscribed from the
+// marketing provider first.
+func eraseSubjectData(email, mode string) (*ErasureReport, error) {
+	d := collectSubjectData(email)
+	report := &ErasureReport{Mode: mode}
+	now := time.Now().UTC()
+	var errs []error
+
+	for _, l := range d.Leads {
+		scheduler.StopNurture(l.ID, "data erased")
+		for name, ref := range l.CRM {
+			if report.CRM == nil {
+				report.CRM = make(map[string]string)
+			}
+			report.CRM[name] = ref.ContactID
+		}
+		for _, att := range l.allAttachments() {
+			if err := deleteAttachment(att.ID); err != nil {
+				errs = append(errs, fmt.Errorf("attachment %s: %w", att.ID, err))
+				continue
+			}
+			report.Attachments++
+		}
+		var err error
+		if mode == EraseDelete {
+			err = leads.Delete(l.ID)
+		} else {
+			_, err = leads.Update(l.ID, func(l *Lead) error {
+				l.anonymize(now)
+				return nil
+			})
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("lead %s: %w", l.ID, err))
+			continue
+		}
+		report.Leads++
+	}
+
+	for _, b := range d.Bookings {
+		scheduler.CancelBooking(b.ID, "data erased")
+		var err error
+		if mode == EraseDelete {
+			err = bookings.Delete(b.ID)
+		} else {
+			_, err = bookings.Anonymize(b.ID, now)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("booking %s: %w", b.ID, err))
+			continue
+		}
+		report.Bookings++
+	}
+
+	report.WebhookDeliveries = webhooks.Forget(d.belongs)
+	if sub := d.Subscriber; sub != nil {
+		if err := subscribers.Delete(sub.ID); err != nil {
+			errs = append(errs, fmt.Errorf("subscriber %s: %w", sub.ID, err))
+		} else {
+			report.Subscriber = true
+			if sub.Status == SubscriberConfirmed {
+				// Queued after Forget so the provider still hears about it
+				webhooks.EnqueueSubscriber(EventSubscriberUnsubscribed, sub)
+			}
+		}
+	}
+	if d.Suppression != nil {
+		if err := suppressions.Remove(d.Email); err != nil {
+			errs = append(errs, fmt.Errorf("suppression: %w", err))
+		} else {
+			report.Suppression = true
+		}
+	}
+	return report, errors.Join(errs...)
+}
+
+// allAttachments returns the files from every submission of the lead
+func (l *Lead) allAttachments() []Attachment {
+	atts := slices.Clone(l.Attachments)
+	for _, in := range l.Interactions {
+		for _, a := range in.Attachments {
+			if !slices.ContainsFunc(atts, func(b Attachment) bool { return b.ID == a.ID }) {
+				atts = append(atts, a)
+			}
+		}
+	}
+	return atts
+}
+
+// anonymize strips the prospect's details, keeping what reporting needs:
+// status, revenue band, services, scores, consent and timestamps
+func (l *Lead) anonymize(now time.Time) {
+	l.FirstName, l.LastName, l.Email, l.PhoneNumber = "", "", "", ""
+	l.Message, l.RemoteIP = "", ""
+	l.Attachments, l.Conversation = nil, nil
+	for i := range l.Interactions {
+		l.Interactions[i].Message, l.Interactions[i].RemoteIP = "", ""
+		l.Interactions[i].Attachments = nil
+	}
+	for i := range l.Emails {
+		l.Emails[i].Subject = ""
+	}
+	for i := range l.Timeline {
+		l.Timeline[i].Detail = ""
+	}
+	l.ErasedAt = &now
+}
+
+// privacyEraseMode is the mode used for self-service erasure requests
+func privacyEraseMode() string {
+	if os.Getenv("PRIVACY_ERASE_MODE") == EraseDelete {
+		return EraseDelete
+	}
+	return EraseAnonymize
+}
+
+// PrivacyLinkSigner signs the export and erase links emailed to people who
+// ask for their data. Proving they can read the address's mail is what
+// authorizes the request. Links are bound to the address and action.
+type PrivacyLinkSigner struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// privacySigner is the process-wide privacy link signer, built in main
+var privacySigner *PrivacyLinkSigner
+
+// newPrivacyLinkSigner builds the signer from PRIVACY_LINK_SECRET and
+// PRIVACY_LINK_TTL_HOURS. Without a secret a random key is used, so
+// emailed links stop working on restart.
+func newPrivacyLinkSigner() *PrivacyLinkSigner {
+	secret := []byte(os.Getenv("PRIVACY_LINK_SECRET"))
+	if len(secret) == 0 {
+		log.Println("PRIVACY_LINK_SECRET not set, using a random key (emailed privacy links break on restart)")
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	}
+	ttl := time.Duration(envInt("PRIVACY_LINK_TTL_HOURS", int(defaultPrivacyLinkTTL/time.Hour))) * time.Hour
+	return &PrivacyLinkSigner{secret: secret, ttl: ttl}
+}
+
+// Token returns a signed token for an action on an address, valid from now
+func (s *PrivacyLinkSigner) Token(email, action string, now time.Time) string {
+	exp := now.Add(s.ttl).Unix()
+	return strconv.FormatInt(exp, 10) + "." + hex.EncodeToString(s.sign(email, action, exp))
+}
+
+// URL returns the absolute link for an action on an address
+func (s *PrivacyLinkSigner) URL(email, action, locale string, now time.Time) string {
+	q := url.Values{"email": {normalizeEmail(email)}, "token": {s.Token(email, action, now)}, "locale": {locale}}
+	return publicBaseURL() + "/api/privacy/" + action + "?" + q.Encode()
+}
+
+// Verify checks a token for an action on an address at now
+func (s *PrivacyLinkSigner) Verify(email, action, token string, now time.Time) error {
+	encExp, encSig, ok := strings.Cut(token, ".")
+	if !ok || normalizeEmail(email) == "" {
+		return errPrivacyLinkInvalid
+	}
+	exp, err1 := strconv.ParseInt(encExp, 10, 64)
+	sig, err2 := hex.DecodeString(encSig)
+	if err1 != nil || err2 != nil || !hmac.Equal(sig, s.sign(email, action, exp)) {
+		return errPrivacyLinkInvalid
+	}
+	if !now.Before(time.Unix(exp, 0)) {
+		return errPrivacyLinkExpired
+	}
+	return nil
+}
+
+func (s *PrivacyLinkSigner) sign(email, action string, exp int64) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "privacy|%s|%s|%d", action, normalizeEmail(email), exp)
+	return mac.Sum(nil)
+}
+
+// PrivacyRequest is the body of POST /api/privacy/request
+type PrivacyRequest struct {
+	Email  string `json:"email"`
+	Action string `json:"action"` // export or erase
+	Locale string `json:"locale"`
+	FormGuard
+}
+
+func (req *PrivacyRequest) readValues(values url.Values) {
+	req.Email = values.Get("email")
+	req.Action = values.Get("action")
+	req.Locale = values.Get("locale")
+	req.FormGuard.readValues(values)
+}
+
+// handlePrivacyRequest takes a self-service export or erasure request
+// ({"email", "action": "export"|"erase"}) and emails a signed link to the
+// address if we hold anything about it. It runs the contact form's spam
+// pipeline and answers the same either way, so it can't be used to probe
+// who has contacted us.
+func handlePrivacyRequest(w http.ResponseWriter, r *http.Request) {
+	locale := negotiateLocale("", r.Header.Get("Accept-Language"))
+	resp := newContactResponder(w, r, locale)
+
+	var req PrivacyRequest
+	if err := decodeForm(w, r, &req, strictJSON()); err != nil {
+		status, code, detail := decodeErrorCode(err)
+		log.Printf("Failed to decode privacy request body (%s): %v", code, err)
+		resp.ErrorDetail(status, code, detail)
+		return
+	}
+	locale = negotiateLocale(req.Locale, r.Header.Get("Accept-Language"))
+	resp.locale = locale
+	w.Header().Set("Content-Language", locale)
+	sent := func() {
+		resp.Message("privacy_request_sent", url.Values{"privacy": {"sent"}})
+	}
+
+	remoteIP := clientIP(r)
+	verdict, err := spamPipeline.Evaluate(r.Context(), &Submission{
+		Form:     &ContactForm{Email: req.Email, Locale: locale, FormGuard: req.FormGuard},
+		Request:  r,
+		RemoteIP: remoteIP,
+		Now:      time.Now(),
+	})
+	if err != nil {
+		log.Printf("Spam check error: %v", err)
+		resp.Error(http.StatusInternalServerError, "captcha_error")
+		return
+	}
+	if verdict.Decision != SpamAccept {
+		log.Printf("Dropped suspicious privacy request from IP %s: %v", remoteIP, verdict.Reasons())
+		if code := verdict.RejectCode(); code != "" {
+			resp.Error(http.StatusBadRequest, code)
+			return
+		}
+		sent()
+		return
+	}
+
+	email := strings.TrimSpace(req.Email)
+	var errs []ValidationError
+	addError := func(field, code string) {
+		errs = append(errs, ValidationError{Field: field, Code: code, Message: translate(locale, code)})
+	}
+	switch {
+	case email == "":
+		addError("email", "email_required")
+	case len(email) > 254:
+		addError("email", "email_too_long")
+	case !emailPattern.MatchString(email):
+		addError("email", "email_invalid")
+	}
+	if req.Action != PrivacyExport && req.Action != PrivacyErase {
+		addError("action", "privacy_action_invalid")
+	}
+	if len(errs) > 0 {
+		resp.ValidationFailed(errs)
+		return
+	}
+
+	found := !collectSubjectData(email).empty()
+	detail := map[string]string{"request": req.Action, "found": strconv.FormatBool(found)}
+	if err := audit.Record(AuditPrivacyRequest, ActorSubject, remoteIP, email, detail); err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+		resp.Error(http.StatusInternalServerError, "send_failed")
+		return
+	}
+	if found {
+		if err := sendPrivacyLink(email, req.Action, locale); err != nil && !errors.Is(err, errSuppressed) {
+			log.Printf("Failed to send privacy %s link: %v", req.Action, err)
+			resp.Error(http.StatusInternalServerError, "send_failed")
+			return
+		}
+	}
+	log.Printf("Privacy %s request from IP %s (data found: %v)", req.Action, remoteIP, found)
+	sent()
+}
+
+// sendPrivacyLink emails the signed export or erase link to the address
+func sendPrivacyLink(email, action, locale string) error {
+	token, from := os.Getenv("POSTMARK_TOKEN"), os.Getenv("POSTMARK_FROM")
+	if token == "" || from == "" {
+		return fmt.Errorf("missing email configuration")
+	}
+	tr := func(key string, args ...any) string {
+		return translate(locale, key, args...)
+	}
+	subject := tr("privacy." + action + ".subject")
+	htmlBody, textBody := simpleEmail(locale, subject,
+		[]string{tr("privacy."+action+".body", int(privacySigner.ttl/time.Hour))},
+		[]emailLink{{Label: tr("privacy." + action + ".confirm"), URL: privacySigner.URL(email, action, locale, time.Now())}},
+		"", "")
+	_, err := sendEmail(token, PostmarkEmail{
+		From:          from,
+		To:            email,
+		Subject:       subject,
+		TextBody:      textBody,
+		HtmlBody:      htmlBody,
+		MessageStream: "outbound",
+	})
+	return err
+}
+
+// handlePrivacyLink serves the emailed export and erase links. GET shows a
+// confirmation so link scanners can't trigger anything; POST downloads the
+// data as JSON or erases it.
+func handlePrivacyLink(w http.ResponseWriter, r *http.Request) {
+	action := r.PathValue("action")
+	if action != PrivacyExport && action != PrivacyErase {
+		http.NotFound(w, r)
+		return
+	}
+	q := r.URL.Query()
+	email, token := q.Get("email"), q.Get("token")
+	locale := negotiateLocale(q.Get("locale"), r.Header.Get("Accept-Language"))
+	tr := func(key string, args ...any) string {
+		return translate(locale, key, args...)
+	}
+	page := func(status int, data linkPageData) {
+		data.Locale, data.Title, data.Token = locale, tr("privacy.page_title"), token
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		w.WriteHeader(status)
+		if err := linkPage.Execute(w, data); err != nil {
+			log.Printf("Failed to render privacy page: %v", err)
+		}
+	}
+
+	if err := privacySigner.Verify(email, action, token, time.Now()); err != nil {
+		code := "privacy_link_invalid"
+		if errors.Is(err, errPrivacyLinkExpired) {
+			code = "privacy_link_expired"
+		}
+		log.Printf("Rejected privacy %s link from IP %s: %v", action, clientIP(r), err)
+		page(http.StatusForbidden, linkPageData{Error: tr(code)})
+		return
+	}
+	if r.Method == http.MethodGet {
+		page(http.StatusOK, linkPageData{
+			Message: tr("privacy."+action+".prompt", email),
+			Confirm: tr("privacy." + action + ".confirm"),
+		})
+		return
+	}
+
+	if action == PrivacyExport {
+		if err := audit.Record(AuditPrivacyExport, ActorSubject, clientIP(r), email, nil); err != nil {
+			log.Printf("Failed to write audit log: %v", err)
+			page(http.StatusInternalServerError, linkPageData{Error: tr("send_failed")})
+			return
+		}
+		writeSubjectData(w, collectSubjectData(email))
+		return
+	}
+
+	report, err := eraseSubjectData(email, privacyEraseMode())
+	auditErasure(ActorSubject, clientIP(r), email, report, err)
+	if err != nil {
+		log.Printf("Privacy erasure incomplete: %v", err)
+		page(http.StatusInternalServerError, linkPageData{Error: tr("send_failed")})
+		return
+	}
+	page(http.StatusOK, linkPageData{Message: tr("privacy_erased", email)})
+}
+
+// writeSubjectData sends an export as a JSON download
+func writeSubjectData(w http.ResponseWriter, d *SubjectData) {
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q",
+		"momentum-data-"+d.GeneratedAt.Format("20060102")+".json"))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(d); err != nil {
+		log.Printf("Privacy export failed: %v", err)
+	}
+}
+
+// auditErasure records an erasure with its counts, logging loudly if the
+// audit log can't be written since the erasure has already happened
+func auditErasure(actor, ip, email string, report *ErasureReport, eraseErr error) {
+	detail := map[string]string{
+		"mode":              report.Mode,
+		"leads":             strconv.Itoa(report.Leads),
+		"bookings":          strconv.Itoa(report.Bookings),
+		"attachments":       strconv.Itoa(report.Attachments),
+		"webhookDeliveries": strconv.Itoa(report.WebhookDeliveries),
+		"subscriber":        strconv.FormatBool(report.Subscriber),
+		"suppression":       strconv.FormatBool(report.Suppression),
+	}
+	for name, id := range report.CRM {
+		detail["crm."+name] = id
+	}
+	if eraseErr != nil {
+		detail["error"] = eraseErr.Error()
+	}
+	if err := audit.Record(AuditPrivacyErase, actor, ip, email, detail); err != nil {
+		log.Printf("AUDIT LOG WRITE FAILED for privacy erasure (%v): %v", detail, err)
+	}
+}
+
+// handleAdminPrivacyExport returns everything stored about ?email=
+func handleAdminPrivacyExport(w http.ResponseWriter, r *http.Request) {
+	email := r.URL.Query().Get("email")
+	if !emailPattern.MatchString(email) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "a valid email is required"})
+		return
+	}
+	if err := audit.Record(AuditPrivacyExport, ActorAdmin, clientIP(r), email, nil); err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "failed to write audit log"})
+		return
+	}
+	writeSubjectData(w, collectSubjectData(email))
+}
+
+// handleAdminPrivacyErase erases or anonymizes everything stored about an
+// address ({"email": ..., "mode": "anonymize"|"delete"}; anonymize by
+// default) and reports what it touched
+func handleAdminPrivacyErase(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+		Mode  string `json:"mode"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes())).Decode(&req); err != nil || !emailPattern.MatchString(req.Email) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "a valid email is required"})
+		return
+	}
+	req.Mode = cmp.Or(req.Mode, EraseAnonymize)
+	if req.Mode != EraseAnonymize && req.Mode != EraseDelete {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "mode must be anonymize or delete"})
+		return
+	}
+
+	report, err := eraseSubjectData(req.Email, req.Mode)
+	auditErasure(ActorAdmin, clientIP(r), req.Email, report, err)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]any{"error": err.Error(), "report": report})
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Retention rules, used in reports and as metric labels
+const (
+	RetainLostLeads          = "lost_leads"
+	RetainSpamLeads          = "spam_leads"
+	RetainAttachments        = "attachments"
+	RetainWebhookDeliveries  = "webhook_deliveries"
+	RetainPendingSubscribers = "pending_subscribers"
+)
+
+// Retention defaults in days, overridable via environment
+const (
+	defaultRetainLostLeadDays          = 365
+	defaultRetainSpamDays              = 30
+	defaultRetainAttachmentDays        = 90
+	defaultRetainWebhookDeliveryDays   = 90
+	defaultRetainPendingSubscriberDays = 30
+	defaultRetentionIntervalHours      = 24
+)
+
+// RetentionPolicy says how many days each kind of record is kept. Zero
+// keeps it forever. Leads age from their last update, so a lost lead that
+// gets back in touch starts over.
+type RetentionPolicy struct {
+	LostLeadDays          int  `json:"lostLeadDays"`
+	SpamDays              int  `json:"spamDays"` // spam and quarantined leads
+	AttachmentDays        int  `json:"attachmentDays"`
+	WebhookDeliveryDays   int  `json:"webhookDeliveryDays"` // finished deliveries, whose payloads carry the lead
+	PendingSubscriberDays int  `json:"pendingSubscriberDays"`
+	IntervalHours         int  `json:"intervalHours"`
+	DryRun                bool `json:"dryRun"` // the janitor only reports
+}
+
+// loadRetentionPolicy reads the RETENTION_* variables
+func loadRetentionPolicy() RetentionPolicy {
+	return RetentionPolicy{
+		LostLeadDays:          envInt("RETENTION_LOST_LEAD_DAYS", defaultRetainLostLeadDays),
+		SpamDays:              envInt("RETENTION_SPAM_DAYS", defaultRetainSpamDays),
+		AttachmentDays:        envInt("RETENTION_ATTACHMENT_DAYS", defaultRetainAttachmentDays),
+		WebhookDeliveryDays:   envInt("RETENTION_WEBHOOK_DELIVERY_DAYS", defaultRetainWebhookDeliveryDays),
+		PendingSubscriberDays: envInt("RETENTION_PENDING_SUBSCRIBER_DAYS", defaultRetainPendingSubscriberDays),
+		IntervalHours:         max(1, envInt("RETENTION_INTERVAL_HOURS", defaultRetentionIntervalHours)),
+		DryRun:                envBool("RETENTION_DRY_RUN", false),
+	}
+}
+
+// retentionCutoff returns the time before which a record kept for days
+// expires, or false if the rule is off
+func retentionCutoff(now time.Time, days int) (time.Time, bool) {
+	if days <= 0 {
+		return time.Time{}, false
+	}
+	return now.AddDate(0, 0, -days), true
+}
+
+// RetentionReport is the outcome of one sweep. In a dry run the counts and
+// IDs are what would have been purged.
+type RetentionReport struct {
+	At       time.Time           `json:"at"`
+	DryRun   bool                `json:"dryRun"`
+	Counts   map[string]int      `json:"counts"`        // by rule
+	IDs      map[string][]string `json:"ids,omitempty"` // lead, attachment and subscriber IDs by rule
+	Errors   []string            `json:"errors,omitempty"`
+	Duration string              `json:"duration"`
+}
+
+func (r *RetentionReport) add(rule, id string) {
+	r.Counts[rule]++
+	if id != "" {
+		r.IDs[rule] = append(r.IDs[rule], id)
+	}
+}
+
+func (r *RetentionReport) fail(format string, args ...any) {
+	err := fmt.Sprintf(format, args...)
+	log.Printf("Retention: %s", err)
+	r.Errors = append(r.Errors, err)
+}
+
+// Janitor enforces the retention policy in the background
+type Janitor struct {
+	mu     sync.Mutex // serializes sweeps
+	policy RetentionPolicy
+	last   *RetentionReport
+}
+
+// janitor is the process-wide retention janitor, built in main
+var janitor *Janitor
+
+// newJanitor builds the janitor for a policy
+func newJanitor(policy RetentionPolicy) *Janitor {
+	metrics.Describe("retention_purged_total", "Records purged by the retention janitor, by rule")
+	metrics.Describe("retention_sweeps_total", "Retention sweeps, by mode")
+	return &Janitor{policy: policy}
+}
+
+// Run sweeps shortly after startup and then every interval until ctx is
+// cancelled
+func (j *Janitor) Run(ctx context.Context) {
+	timer := time.NewTimer(time.Minute)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		report := j.Sweep(time.Now(), j.policy.DryRun)
+		log.Printf("Retention sweep (dry run: %v): %v", report.DryRun, report.Counts)
+		timer.Reset(time.Duration(j.policy.IntervalHours) * time.Hour)
+	}
+}
+
+// Last returns the report of the most recent sweep, or nil
+func (j *Janitor) Last() *RetentionReport {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.last
+}
+
+// Sweep applies every rule once. A dry run changes nothing.
+func (j *Janitor) Sweep(now time.Time, dryRun bool) *RetentionReport {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	report := &RetentionReport{
+		At:     now.UTC(),
+		DryRun: dryRun,
+		Counts: make(map[string]int),
+		IDs:    make(map[string][]string),
+	}
+	j.sweepLeads(report, now, dryRun)
+	j.sweepAttachments(report, now, dryRun)
+	j.sweepDeliveries(report, now, dryRun)
+	j.sweepSubscribers(report, now, dryRun)
+	report.Duration = time.Since(now).Round(time.Millisecond).String()
+
+	mode := "purge"
+	if dryRun {
+		mode = "dry_run"
+	} else {
+		for rule, n := range report.Counts {
+			metrics.Add("retention_purged_total", float64(n), "rule", rule)
+		}
+	}
+	metrics.Inc("retention_sweeps_total", "mode", mode)
+	j.last = report
+	return report
+}
+
+// sweepLeads deletes lost leads and spam past their retention, with their
+// attachments, bookings, pending emails and webhook deliveries
+func (j *Janitor) sweepLeads(report *RetentionReport, now time.Time, dryRun bool) {
+	lostBefore, lostOn := retentionCutoff(now, j.policy.LostLeadDays)
+	spamBefore, spamOn := retentionCutoff(now, j.policy.SpamDays)
+	for _, l := range leads.List(nil) {
+		var rule string
+		switch {
+		case lostOn && l.Status == LeadLost && l.UpdatedAt.Before(lostBefore):
+			rule = RetainLostLeads
+		case spamOn && (l.Status == LeadSpam || l.Status == LeadQuarantined) && l.UpdatedAt.Before(spamBefore):
+			rule = RetainSpamLeads
+		default:
+			continue
+		}
+		if dryRun {
+			report.add(rule, l.ID)
+			continue
+		}
+		if err := purgeLead(l); err != nil {
+			report.fail("lead %s: %v", l.ID, err)
+			continue
+		}
+		report.add(rule, l.ID)
+	}
+}
+
+// purgeLead removes a lead and everything hanging off it: attachments,
+// every booking with its reminders, nurture emails and webhook deliveries,
+// whose payloads carry the lead. The audit log is kept; it only holds a
+// hash of the email and is the record that erasures and exports happened.
+func purgeLead(l *Lead) error {
+	scheduler.StopNurture(l.ID, "lead purged")
+	for _, att := range l.allAttachments() {
+		if err := deleteAttachment(att.ID); err != nil {
+			return fmt.Errorf("attachment %s: %w", att.ID, err)
+		}
+	}
+	for _, b := range bookings.List(func(b *Booking) bool { return b.LeadID == l.ID }) {
+		scheduler.CancelBooking(b.ID, "lead purged")
+		if err := bookings.Delete(b.ID); err != nil {
+			return fmt.Errorf("booking %s: %w", b.ID, err)
+		}
+	}
+	webhooks.Forget(func(d *Delivery) bool { return d.LeadID == l.ID })
+	return leads.Delete(l.ID)
+}
+
+// sweepAttachments deletes stored files past their retention, including
+// orphans no lead refers to, and drops them from their leads
+func (j *Janitor) sweepAttachments(report *RetentionReport, now time.Time, dryRun bool) {
+	before, on := retentionCutoff(now, j.policy.AttachmentDays)
+	if !on {
+		return
+	}
+	dir := attachmentDir()
+	metas, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		report.fail("attachments: %v", err)
+		return
+	}
+	var purged []string
+	for _, path := range metas {
+		id := strings.TrimSuffix(filepath.Base(path), ".json")
+		if !isAttachmentID(id) {
+			continue
+		}
+		created, err := attachmentCreatedAt(path)
+		if err != nil {
+			report.fail("attachment %s: %v", id, err)
+			continue
+		}
+		if !created.Before(before) {
+			continue
+		}
+		if !dryRun {
+			if err := deleteAttachment(id); err != nil {
+				report.fail("attachment %s: %v", id, err)
+				continue
+			}
+		}
+		purged = append(purged, id)
+		report.add(RetainAttachments, id)
+	}
+	if dryRun || len(purged) == 0 {
+		return
+	}
+
+	gone := func(a Attachment) bool { return slices.Contains(purged, a.ID) }
+	for _, l := range leads.List(func(l *Lead) bool { return slices.ContainsFunc(l.allAttachments(), gone) }) {
+		_, err := leads.Update(l.ID, func(l *Lead) error {
+			l.Attachments = slices.DeleteFunc(slices.Clone(l.Attachments), gone)
+			l.Interactions = slices.Clone(l.Interactions)
+			for i := range l.Interactions {
+				l.Interactions[i].Attachments = slices.DeleteFunc(slices.Clone(l.Interactions[i].Attachments), gone)
+			}
+			return nil
+		})
+		if err != nil {
+			report.fail("lead %s: %v", l.ID, err)
+		}
+	}
+}
+
+// attachmentCreatedAt reads a sidecar's creation time, falling back to the
+// file's modification time for sidecars without one
+func attachmentCreatedAt(path string) (time.Time, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var att Attachment
+	if err := json.Unmarshal(data, &att); err == nil && !att.CreatedAt.IsZero() {
+		return att.CreatedAt, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// sweepDeliveries drops finished webhook deliveries past their retention
+func (j *Janitor) sweepDeliveries(report *RetentionReport, now time.Time, dryRun bool) {
+	before, on := retentionCutoff(now, j.policy.WebhookDeliveryDays)
+	if !on {
+		return
+	}
+	expired := func(d *Delivery) bool { return d.Status != DeliveryPending && d.CreatedAt.Before(before) }
+	n := len(webhooks.Find(expired))
+	if !dryRun {
+		n = webhooks.Forget(expired)
+	}
+	if n > 0 {
+		report.Counts[RetainWebhookDeliveries] += n
+	}
+}
+
+// sweepSubscribers deletes newsletter signups never confirmed
+func (j *Janitor) sweepSubscribers(report *RetentionReport, now time.Time, dryRun bool) {
+	before, on := retentionCutoff(now, j.policy.PendingSubscriberDays)
+	if !on {
+		return
+	}
+	for _, sub := range subscribers.List(SubscriberPending) {
+		if !sub.RequestedAt.Before(before) {
+			continue
+		}
+		if !dryRun {
+			if err := subscribers.Delete(sub.ID); err != nil {
+				report.fail("subscriber %s: %v", sub.ID, err)
+				continue
+			}
+			webhooks.Forget(func(d *Delivery) bool { return d.SubscriberID == sub.ID })
+		}
+		report.add(RetainPendingSubscribers, sub.ID)
+	}
+}
+
+// handleAdminRetention shows the retention policy and the last sweep
+func handleAdminRetention(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"policy":    janitor.policy,
+		"lastSweep": janitor.Last(),
+	})
+}
+
+// handleAdminRunRetention sweeps now. It's a dry run unless ?dry_run=false,
+// so the report can be reviewed before anything is deleted.
+func handleAdminRunRetention(w http.ResponseWriter, r *http.Request) {
+	dryRun := true
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "dry_run must be true or false"})
+			return
+		}
+		dryRun = b
+	}
+	report := janitor.Sweep(time.Now(), dryRun)
+	log.Printf("Retention sweep requested by admin (dry run: %v): %v", dryRun, report.Counts)
+	writeJSON(w, http.StatusOK, report)
+}
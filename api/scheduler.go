@@ -0,0 +1,538 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Scheduled message kinds
+const (
+	MessageReminder = "reminder"
+	MessageNurture  = "nurture"
+)
+
+// Scheduled message statuses
+const (
+	MessagePending   = "pending"
+	MessageSent      = "sent"
+	MessageCancelled = "cancelled"
+	MessageFailed    = "failed"
+)
+
+// Scheduler defaults, overridable via environment
+const (
+	defaultMessageMaxAttempts = 5
+	defaultScheduleKeepDays   = 90
+)
+
+// messageBackoff is the wait after each failed send
+var messageBackoff = []time.Duration{5 * time.Minute, 15 * time.Minute, time.Hour, 4 * time.Hour}
+
+// errMessageNotFound is returned when a scheduled message ID doesn't exist
+var errMessageNotFound = errors.New("scheduled message not found")
+
+// ScheduledMessage is an email queued to go out at SendAt
+type ScheduledMessage struct {
+	ID        string     `json:"id"`
+	Kind      string     `json:"kind"`
+	Step      string     `json:"step"` // nurture step name, or reminder lead time such as "24h"
+	LeadID    string     `json:"leadId,omitempty"`
+	BookingID string     `json:"bookingId,omitempty"`
+	SendAt    time.Time  `json:"sendAt"`
+	Status    string     `json:"status"`
+	Attempts  int        `json:"attempts"`
+	Reason    string     `json:"reason,omitempty"` // last error, or why it was cancelled
+	SentAt    *time.Time `json:"sentAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+
+	inFlight bool
+}
+
+// NurtureStep is one email in the follow-up sequence for leads who haven't
+// booked a call. Subject and Body are keyed by locale and may use the
+// {firstName} and {siteUrl} placeholders; without them the step's
+// nurture.<name>.subject and nurture.<name>.body messages are used.
+type NurtureStep struct {
+	Name       string            `json:"name"`
+	AfterHours int               `json:"afterHours"`
+	Subject    map[string]string `json:"subject,omitempty"`
+	Body       map[string]string `json:"body,omitempty"`
+}
+
+// defaultNurtureSequence sends pricing on day 2 and checks in on day 7
+func defaultNurtureSequence() []NurtureStep {
+	return []NurtureStep{
+		{Name: "pricing", AfterHours: 48},
+		{Name: "checkin", AfterHours: 7 * 24},
+	}
+}
+
+// loadNurtureSequence reads NURTURE_SEQUENCE_FILE (a JSON array of steps)
+// if set, replacing the default sequence. NURTURE_ENABLED=false turns the
+// sequence off.
+func loadNurtureSequence() ([]NurtureStep, error) {
+	if !envBool("NURTURE_ENABLED", true) {
+		return nil, nil
+	}
+	steps := defaultNurtureSequence()
+	if path := os.Getenv("NURTURE_SEQUENCE_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		steps = nil
+		if err := json.Unmarshal(data, &steps); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	}
+	seen := make(map[string]bool)
+	for _, s := range steps {
+		if s.Name == "" || s.AfterHours <= 0 {
+			return nil, errors.New("nurture steps need a name and positive afterHours")
+		}
+		if seen[s.Name] {
+			return nil, fmt.Errorf("duplicate nurture step %q", s.Name)
+		}
+		seen[s.Name] = true
+	}
+	return steps, nil
+}
+
+// bookingReminderOffsets reads BOOKING_REMINDER_HOURS, the comma-separated
+// lead times of call reminders (default "24,1")
+func bookingReminderOffsets() []time.Duration {
+	var out []time.Duration
+	for _, v := range strings.Split(cmp.Or(os.Getenv("BOOKING_REMINDER_HOURS"), "24,1"), ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		hours, err := strconv.Atoi(v)
+		if err != nil || hours <= 0 {
+			log.Printf("Invalid BOOKING_REMINDER_HOURS entry %q, skipping", v)
+			continue
+		}
+		out = append(out, time.Duration(hours)*time.Hour)
+	}
+	return out
+}
+
+// Scheduler persists scheduled messages and sends them when due, so
+// reminders and follow-ups survive restarts
+type Scheduler struct {
+	mu          sync.Mutex
+	path        string
+	messages    []*ScheduledMessage
+	reminders   []time.Duration
+	nurture     []NurtureStep
+	maxAttempts int
+	keep        time.Duration
+	wake        chan struct{}
+}
+
+// scheduler is the process-wide scheduler, built in main
+var scheduler *Scheduler
+
+// newScheduler loads the schedule from dir
+func newScheduler(dir string, nurture []NurtureStep) (*Scheduler, error) {
+	s := &Scheduler{
+		path:        filepath.Join(dir, "schedules.json"),
+		reminders:   bookingReminderOffsets(),
+		nurture:     nurture,
+		maxAttempts: envInt("SCHEDULE_MAX_ATTEMPTS", defaultMessageMaxAttempts),
+		keep:        time.Duration(envInt("SCHEDULE_KEEP_DAYS", defaultScheduleKeepDays)) * 24 * time.Hour,
+		wake:        make(chan struct{}, 1),
+	}
+	if err := loadJSON(s.path, &s.messages); err != nil {
+		return nil, err
+	}
+	metrics.Describe("scheduled_messages_total", "Scheduled emails by kind and outcome")
+	return s, nil
+}
+
+// nurtureStep returns the configured step with the given name, or nil
+func (s *Scheduler) nurtureStep(name string) *NurtureStep {
+	for i := range s.nurture {
+		if s.nurture[i].Name == name {
+			return &s.nurture[i]
+		}
+	}
+	return nil
+}
+
+// ScheduleBooking queues the reminders for a booking, replacing any from
+// before a reschedule. A booked lead leaves the nurture sequence.
+func (s *Scheduler) ScheduleBooking(b *Booking) {
+	now := time.Now().UTC()
+	s.mu.Lock()
+	s.cancelLocked(func(m *ScheduledMessage) bool { return m.BookingID == b.ID }, "booking rescheduled")
+	if b.LeadID != "" {
+		s.cancelLocked(func(m *ScheduledMessage) bool {
+			return m.Kind == MessageNurture && m.LeadID == b.LeadID
+		}, "lead booked a call")
+	}
+	for _, offset := range s.reminders {
+		sendAt := b.Start.UTC().Add(-offset)
+		if !sendAt.After(now) {
+			continue
+		}
+		s.messages = append(s.messages, &ScheduledMessage{
+			ID:        newID(),
+			Kind:      MessageReminder,
+			Step:      strings.TrimSuffix(offset.String(), "0m0s"),
+			LeadID:    b.LeadID,
+			BookingID: b.ID,
+			SendAt:    sendAt,
+			Status:    MessagePending,
+			CreatedAt: now,
+		})
+	}
+	s.saveLocked()
+	s.mu.Unlock()
+	s.notify()
+}
+
+// CancelBooking drops the pending reminders for a booking
+func (s *Scheduler) CancelBooking(id, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancelLocked(func(m *ScheduledMessage) bool { return m.BookingID == id }, reason) > 0 {
+		s.saveLocked()
+	}
+}
+
+// StartNurture queues the follow-up sequence for a newly accepted lead
+func (s *Scheduler) StartNurture(lead *Lead) {
+	if len(s.nurture) == 0 || lead.Email == "" {
+		return
+	}
+	now := time.Now().UTC()
+	s.mu.Lock()
+	for _, m := range s.messages {
+		if m.Kind == MessageNurture && m.LeadID == lead.ID {
+			s.mu.Unlock()
+			return // already enrolled
+		}
+	}
+	for _, step := range s.nurture {
+		s.messages = append(s.messages, &ScheduledMessage{
+			ID:        newID(),
+			Kind:      MessageNurture,
+			Step:      step.Name,
+			LeadID:    lead.ID,
+			SendAt:    now.Add(time.Duration(step.AfterHours) * time.Hour),
+			Status:    MessagePending,
+			CreatedAt: now,
+		})
+	}
+	s.saveLocked()
+	s.mu.Unlock()
+	s.notify()
+}
+
+// StopNurture drops a lead's pending follow-ups
+func (s *Scheduler) StopNurture(leadID, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancelLocked(func(m *ScheduledMessage) bool {
+		return m.Kind == MessageNurture && m.LeadID == leadID
+	}, reason) > 0 {
+		s.saveLocked()
+	}
+}
+
+// Cancel drops one pending message
+func (s *Scheduler) Cancel(id string) (*ScheduledMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.findLocked(id)
+	if m == nil {
+		return nil, errMessageNotFound
+	}
+	if m.Status != MessagePending || m.inFlight {
+		return nil, errors.New("message is not pending")
+	}
+	m.Status, m.Reason = MessageCancelled, "cancelled by admin"
+	s.saveLocked()
+	cp := *m
+	return &cp, nil
+}
+
+// cancelLocked cancels the pending messages matching fn and returns how many
+// it cancelled. Callers must hold the lock.
+func (s *Scheduler) cancelLocked(fn func(*ScheduledMessage) bool, reason string) int {
+	n := 0
+	for _, m := range s.messages {
+		if m.Status == MessagePending && !m.inFlight && fn(m) {
+			m.Status, m.Reason = MessageCancelled, reason
+			n++
+		}
+	}
+	return n
+}
+
+func (s *Scheduler) findLocked(id string) *ScheduledMessage {
+	for _, m := range s.messages {
+		if m.ID == id {
+			return m
+		}
+	}
+	return nil
+}
+
+// Get returns a copy of the message with the given ID
+func (s *Scheduler) Get(id string) (*ScheduledMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.findLocked(id)
+	if m == nil {
+		return nil, errMessageNotFound
+	}
+	cp := *m
+	return &cp, nil
+}
+
+// List returns the messages matching filter, soonest first
+func (s *Scheduler) List(filter func(*ScheduledMessage) bool) []*ScheduledMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := []*ScheduledMessage{}
+	for _, m := range s.messages {
+		if filter == nil || filter(m) {
+			cp := *m
+			out = append(out, &cp)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].SendAt.Before(out[j].SendAt) })
+	return out
+}
+
+// Run sends due messages until ctx is cancelled
+func (s *Scheduler) Run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		case <-s.wake:
+		}
+
+		now := time.Now()
+		next := now.Add(time.Minute)
+		s.mu.Lock()
+		for _, m := range s.messages {
+			if m.Status != MessagePending || m.inFlight {
+				continue
+			}
+			if m.SendAt.After(now) {
+				if m.SendAt.Before(next) {
+					next = m.SendAt
+				}
+				continue
+			}
+			m.inFlight = true
+			go s.deliver(m.ID)
+		}
+		s.mu.Unlock()
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(time.Until(next))
+	}
+}
+
+// deliver renders and sends one message, or cancels it if it no longer
+// applies (the lead moved on, unsubscribed or the call was cancelled)
+func (s *Scheduler) deliver(id string) {
+	s.mu.Lock()
+	m := s.findLocked(id)
+	if m == nil {
+		s.mu.Unlock()
+		return
+	}
+	msg := *m
+	s.mu.Unlock()
+
+	email, skip, err := s.render(&msg)
+	if err == nil && skip == "" {
+		var id string
+		id, err = sendEmail(os.Getenv("POSTMARK_TOKEN"), email)
+		recordLeadEmail(msg.LeadID, msg.Kind, email.Subject, id)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m.inFlight = false
+	m.Attempts++
+	switch {
+	case skip != "":
+		m.Status, m.Reason = MessageCancelled, skip
+		metrics.Inc("scheduled_messages_total", "kind", m.Kind, "outcome", "skipped")
+	case errors.Is(err, errSuppressed):
+		m.Status, m.Reason = MessageCancelled, "recipient suppressed"
+		metrics.Inc("scheduled_messages_total", "kind", m.Kind, "outcome", "skipped")
+	case err == nil:
+		sent := time.Now().UTC()
+		m.Status, m.Reason, m.SentAt = MessageSent, "", &sent
+		metrics.Inc("scheduled_messages_total", "kind", m.Kind, "outcome", "sent")
+		log.Printf("Sent %s %s for lead %s", m.Kind, m.Step, orDash(m.LeadID))
+	case m.Attempts >= s.maxAttempts:
+		m.Status, m.Reason = MessageFailed, err.Error()
+		metrics.Inc("scheduled_messages_total", "kind", m.Kind, "outcome", "failed")
+		log.Printf("Scheduled %s %s failed after %d attempts: %v", m.Kind, m.ID, m.Attempts, err)
+	default:
+		wait := messageBackoff[min(m.Attempts, len(messageBackoff))-1]
+		m.Reason = err.Error()
+		m.SendAt = time.Now().Add(wait).UTC()
+		metrics.Inc("scheduled_messages_total", "kind", m.Kind, "outcome", "retry")
+		log.Printf("Scheduled %s %s failed, retrying in %s: %v", m.Kind, m.ID, wait, err)
+	}
+	s.pruneLocked()
+	s.saveLocked()
+}
+
+// render builds the email for a message. A non-empty skip reason means the
+// message no longer applies and should not be sent.
+func (s *Scheduler) render(m *ScheduledMessage) (PostmarkEmail, string, error) {
+	from := os.Getenv("POSTMARK_FROM")
+	if from == "" || os.Getenv("POSTMARK_TOKEN") == "" {
+		return PostmarkEmail{}, "", errors.New("missing email configuration")
+	}
+	switch m.Kind {
+	case MessageReminder:
+		b, err := bookings.Get(m.BookingID)
+		if err != nil {
+			return PostmarkEmail{}, "booking no longer exists", nil
+		}
+		if b.Status != BookingConfirmed {
+			return PostmarkEmail{}, "booking cancelled", nil
+		}
+		if !b.Start.After(time.Now()) {
+			return PostmarkEmail{}, "call already started", nil
+		}
+		return reminderEmail(b, m.Step, from), "", nil
+	case MessageNurture:
+		lead, err := leads.Get(m.LeadID)
+		if err != nil {
+			return PostmarkEmail{}, "lead no longer exists", nil
+		}
+		if skip := nurtureSkipReason(lead); skip != "" {
+			return PostmarkEmail{}, skip, nil
+		}
+		step := s.nurtureStep(m.Step)
+		if step == nil {
+			return PostmarkEmail{}, "step no longer configured", nil
+		}
+		return nurtureEmail(lead, step, from), "", nil
+	}
+	return PostmarkEmail{}, "", fmt.Errorf("unknown message kind %q", m.Kind)
+}
+
+// nurtureSkipReason says why a lead should no longer get follow-ups, if so
+func nurtureSkipReason(lead *Lead) string {
+	switch {
+	case lead.Status != LeadNew:
+		return "lead status is " + lead.Status
+	case lead.UnsubscribedAt != nil:
+		return "lead unsubscribed"
+	case len(bookings.List(func(b *Booking) bool { return b.LeadID == lead.ID && b.Status == BookingConfirmed })) > 0:
+		return "lead booked a call"
+	}
+	return ""
+}
+
+// pruneLocked drops finished messages older than the keep period. Callers
+// must hold the lock.
+func (s *Scheduler) pruneLocked() {
+	cutoff := time.Now().Add(-s.keep)
+	kept := s.messages[:0]
+	for _, m := range s.messages {
+		if m.Status == MessagePending || m.SendAt.After(cutoff) {
+			kept = append(kept, m)
+		}
+	}
+	s.messages = kept
+}
+
+// saveLocked persists the schedule. Callers must hold the lock.
+func (s *Scheduler) saveLocked() {
+	if err := saveJSON(s.path, s.messages); err != nil {
+		log.Printf("Failed to save schedule: %v", err)
+	}
+}
+
+// notify wakes Run to pick up new or changed messages
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// handleAdminListSchedules lists scheduled messages soonest first, filtered
+// by ?status=, ?kind=, ?leadId= and ?bookingId=
+func handleAdminListSchedules(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	match := func(want, got string) bool { return want == "" || want == got }
+	writeJSON(w, http.StatusOK, scheduler.List(func(m *ScheduledMessage) bool {
+		return match(q.Get("status"), m.Status) && match(q.Get("kind"), m.Kind) &&
+			match(q.Get("leadId"), m.LeadID) && match(q.Get("bookingId"), m.BookingID)
+	}))
+}
+
+// handleAdminPreviewSchedule renders a scheduled message as it would be
+// sent now, without sending it
+func handleAdminPreviewSchedule(w http.ResponseWriter, r *http.Request) {
+	m, err := scheduler.Get(r.PathValue("id"))
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		return
+	}
+	email, skip, err := scheduler.render(m)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	resp := map[string]any{"message": m}
+	if skip != "" {
+		resp["skip"] = skip
+	} else {
+		resp["email"] = map[string]string{
+			"to":       email.To,
+			"subject":  email.Subject,
+			"textBody": email.TextBody,
+			"htmlBody": email.HtmlBody,
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleAdminCancelSchedule cancels a pending message
+func handleAdminCancelSchedule(w http.ResponseWriter, r *http.Request) {
+	m, err := scheduler.Cancel(r.PathValue("id"))
+	switch {
+	case errors.Is(err, errMessageNotFound):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+	case err != nil:
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+	default:
+		writeJSON(w, http.StatusOK, m)
+	}
+}
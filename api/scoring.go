@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// Lead priority tiers, highest first
+const (
+	PriorityHigh   = "high"
+	PriorityMedium = "medium"
+	PriorityLow    = "low"
+)
+
+// priorityRank orders tiers for sorting; higher is more urgent
+var priorityRank = map[string]int{PriorityHigh: 3, PriorityMedium: 2, PriorityLow: 1}
+
+// ScoringModel assigns points for revenue, services and message keywords.
+// A lead's total decides its tier.
+type ScoringModel struct {
+	Revenue  map[string]int `json:"revenue"`
+	Services map[string]int `json:"services"`
+	Keywords map[string]int `json:"keywords"` // case-insensitive substrings of the message
+	// LongMessage points are added when the message is at least
+	// LongMessageChars long, a sign of a considered inquiry
+	LongMessage      int `json:"longMessage"`
+	LongMessageChars int `json:"longMessageChars"`
+	Tiers            struct {
+		High   int `json:"high"`
+		Medium int `json:"medium"`
+	} `json:"tiers"`
+}
+
+// defaultScoringModel favours larger businesses and the full-service
+// packages (Complete Business Support starts at $2,500/month)
+func defaultScoringModel() *ScoringModel {
+	m := &ScoringModel{
+		Revenue: map[string]int{
+			"under-100k": 0,
+			"100k-500k":  10,
+			"500k-1m":    20,
+			"1m-5m":      30,
+			"over-5m":    40,
+		},
+		Services: map[string]int{
+			"essentials":       5,
+			"growth-strategy":  10,
+			"complete-support": 25,
+			"consulting":       10,
+			"cleanup":          5,
+		},
+		Keywords: map[string]int{
+			"asap":        5,
+			"urgent":      5,
+			"switching":   5,
+			"payroll":     5,
+			"audit":       5,
+			"acquisition": 10,
+		},
+		LongMessage:      5,
+		LongMessageChars: 200,
+	}
+	m.Tiers.High = 40
+	m.Tiers.Medium = 20
+	return m
+}
+
+// scoring is the process-wide model, loaded in main
+var scoring = defaultScoringModel()
+
+// loadScoringModel reads LEAD_SCORING_FILE (JSON in the ScoringModel shape)
+// if set. Sections missing from the file keep their defaults.
+func loadScoringModel() (*ScoringModel, error) {
+	m := defaultScoringModel()
+	path := os.Getenv("LEAD_SCORING_FILE")
+	if path == "" {
+		return m, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if m.Tiers.Medium > m.Tiers.High {
+		log.Printf("Lead scoring: medium threshold %d is above high %d", m.Tiers.Medium, m.Tiers.High)
+	}
+	return m, nil
+}
+
+// Score rates a lead and returns its points, tier and the reasons behind them
+func (m *ScoringModel) Score(l *Lead) (int, string, []string) {
+	score := 0
+	var reasons []string
+	add := func(points int, reason string) {
+		if points != 0 {
+			score += points
+			reasons = append(reasons, fmt.Sprintf("%s (+%d)", reason, points))
+		}
+	}
+
+	add(m.Revenue[l.AnnualRevenue], "revenue "+formatRevenue(l.AnnualRevenue))
+	for _, s := range l.Services {
+		add(m.Services[s], formatService(s))
+	}
+	message := strings.ToLower(l.Message)
+	for keyword, points := range m.Keywords {
+		if keyword != "" && strings.Contains(message, strings.ToLower(keyword)) {
+			add(points, fmt.Sprintf("mentions %q", keyword))
+		}
+	}
+	if m.LongMessageChars > 0 && len(l.Message) >= m.LongMessageChars {
+		add(m.LongMessage, "detailed message")
+	}
+
+	tier := PriorityLow
+	switch {
+	case score >= m.Tiers.High:
+		tier = PriorityHigh
+	case score >= m.Tiers.Medium:
+		tier = PriorityMedium
+	}
+	return score, tier, reasons
+}
+
+// Prioritize scores the lead and records the result on it
+func (m *ScoringModel) Prioritize(l *Lead) {
+	l.Score, l.Priority, l.ScoreReasons = m.Score(l)
+}
+
+// priorityRecipients returns the extra notification addresses for a tier.
+// HIGH_PRIORITY_NOTIFY_TO takes comma-separated emails, which may include
+// an email-to-SMS gateway address.
+func priorityRecipients(priority string) []string {
+	if priority != PriorityHigh {
+		return nil
+	}
+	var out []string
+	for _, addr := range strings.Split(os.Getenv("HIGH_PRIORITY_NOTIFY_TO"), ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			out = append(out, addr)
+		}
+	}
+	return out
+}
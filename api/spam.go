@@ -0,0 +1,503 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Spam decisions
+const (
+	SpamAccept     = "accept"
+	SpamQuarantine = "quarantine"
+	SpamReject     = "reject"
+)
+
+// Default score thresholds, overridable via environment
+const (
+	defaultSpamQuarantineScore = 5
+	defaultSpamRejectScore     = 10
+)
+
+// Submission is what spam checks inspect. Other public forms are checked
+// as a contact form carrying just their email, name and FormGuard fields.
+type Submission struct {
+	Form     *ContactForm
+	Request  *http.Request
+	RemoteIP string
+	Now      time.Time
+}
+
+// SpamSignal is the score a single check assigned to a submission
+type SpamSignal struct {
+	Check  string `json:"check"`
+	Score  int    `json:"score"`
+	Reason string `json:"reason,omitempty"`
+
+	// Reject forces a rejection regardless of the total score
+	Reject bool `json:"reject,omitempty"`
+
+	// Code is a user-facing error code returned when the submission is
+	// rejected because of this signal (e.g. a failed CAPTCHA the visitor can
+	// retry). Signals without a code get a fake success so bots learn nothing.
+	Code string `json:"-"`
+}
+
+// SpamCheck scores one spam signal. A zero score means the check passed;
+// an error means the check couldn't run at all.
+type SpamCheck interface {
+	Name() string
+	Check(ctx context.Context, sub *Submission) (SpamSignal, error)
+}
+
+// SpamVerdict is the combined result of a spam pipeline run
+type SpamVerdict struct {
+	Decision string       `json:"decision"`
+	Score    int          `json:"score"`
+	Signals  []SpamSignal `json:"signals,omitempty"`
+}
+
+// Reasons returns a short description of each signal that scored
+func (v SpamVerdict) Reasons() []string {
+	var out []string
+	for _, s := range v.Signals {
+		out = append(out, fmt.Sprintf("%s (+%d): %s", s.Check, s.Score, s.Reason))
+	}
+	return out
+}
+
+// RejectCode returns the user-facing error code for a rejected submission,
+// or "" if the rejection should be disguised as a success
+func (v SpamVerdict) RejectCode() string {
+	for _, s := range v.Signals {
+		if s.Code != "" {
+			return s.Code
+		}
+	}
+	return ""
+}
+
+// SpamPipeline runs spam checks in order and sums their scores
+type SpamPipeline struct {
+	Checks          []SpamCheck
+	QuarantineScore int
+	RejectScore     int
+}
+
+// spamPipeline is the process-wide pipeline, built in main
+var spamPipeline *SpamPipeline
+
+// newSpamPipeline builds the default pipeline from environment config.
+// Cheap local checks run first so obvious bots never cost a siteverify call.
+func newSpamPipeline() *SpamPipeline {
+	return &SpamPipeline{
+		Checks: []SpamCheck{
+			honeypotCheck{},
+			formTokenCheck{issuer: formTokens, required: envBool("FORM_TOKEN_REQUIRED", true)},
+			newRepeatCheck(),
+			linkCheck{},
+			newBlocklistCheck(),
+			newCaptchaCheck(captchaVerifier, formTokens),
+		},
+		QuarantineScore: envInt("SPAM_QUARANTINE_SCORE", defaultSpamQuarantineScore),
+		RejectScore:     envInt("SPAM_REJECT_SCORE", defaultSpamRejectScore),
+	}
+}
+
+// Without returns a copy of the pipeline minus the named checks
+func (p *SpamPipeline) Without(names ...string) *SpamPipeline {
+	out := *p
+	out.Checks = nil
+	for _, check := range p.Checks {
+		if !slices.Contains(names, check.Name()) {
+			out.Checks = append(out.Checks, check)
+		}
+	}
+	return &out
+}
+
+// Evaluate runs the checks in order, stopping early once the reject
+// threshold is reached
+func (p *SpamPipeline) Evaluate(ctx context.Context, sub *Submission) (SpamVerdict, error) {
+	verdict := SpamVerdict{Decision: SpamAccept}
+	for _, check := range p.Checks {
+		signal, err := check.Check(ctx, sub)
+		if err != nil {
+			return verdict, fmt.Errorf("%s: %w", check.Name(), err)
+		}
+		if signal.Score == 0 {
+			continue
+		}
+		signal.Check = check.Name()
+		verdict.Signals = append(verdict.Signals, signal)
+		verdict.Score += signal.Score
+		if signal.Reject || verdict.Score >= p.RejectScore {
+			verdict.Decision = SpamReject
+			return verdict, nil
+		}
+	}
+
+	switch {
+	case verdict.Score >= p.RejectScore:
+		verdict.Decision = SpamReject
+	case verdict.Score >= p.QuarantineScore:
+		verdict.Decision = SpamQuarantine
+	}
+	return verdict, nil
+}
+
+// honeypotCheck flags submissions that filled in the hidden website field
+type honeypotCheck struct{}
+
+func (honeypotCheck) Name() string { return "honeypot" }
+
+func (honeypotCheck) Check(ctx context.Context, sub *Submission) (SpamSignal, error) {
+	if strings.TrimSpace(sub.Form.Website) != "" {
+		return SpamSignal{Score: defaultSpamRejectScore, Reason: "honeypot field filled in", Reject: true}, nil
+	}
+	return SpamSignal{}, nil
+}
+
+// CAPTCHA outage policies, applied when the provider can't be reached
+const (
+	CaptchaFailClosed   = "closed"   // reject the submission
+	CaptchaFailOpen     = "open"     // accept it with a spam score, usually into quarantine
+	CaptchaFailDegraded = "degraded" // accept it under a much stricter rate limit
+)
+
+// Degraded mode defaults: one submission per IP or email per hour
+const (
+	defaultDegradedAllowed = 1
+	defaultDegradedWindow  = time.Hour
+)
+
+// captchaCheck verifies the CAPTCHA token with the configured provider and
+// applies the hostname, freshness and action policy to the result. It is
+// skipped when verification is disabled. If the provider is down, the
+// outage policy decides what happens to the submission.
+type captchaCheck struct {
+	verifier     CaptchaVerifier
+	tokens       *FormTokenIssuer
+	policy       CaptchaPolicy
+	outage       string
+	outageScore  int
+	degradedRate *repeatCheck
+}
+
+// newCaptchaCheck builds the check from environment config
+// (CAPTCHA_FAILURE_POLICY, CAPTCHA_OUTAGE_SCORE, CAPTCHA_DEGRADED_*). The
+// cdata binding only applies to Turnstile, the one provider reporting it,
+// and is derived from form tokens issued by tokens.
+func newCaptchaCheck(verifier CaptchaVerifier, tokens *FormTokenIssuer) *captchaCheck {
+	outage := strings.ToLower(os.Getenv("CAPTCHA_FAILURE_POLICY"))
+	switch outage {
+	case CaptchaFailClosed, CaptchaFailOpen, CaptchaFailDegraded:
+	case "":
+		outage = CaptchaFailClosed
+	default:
+		log.Printf("Unknown CAPTCHA_FAILURE_POLICY %q, using %s", outage, CaptchaFailClosed)
+		outage = CaptchaFailClosed
+	}
+	if verifier != nil {
+		log.Printf("CAPTCHA provider %s, failure policy %s", verifier.Name(), outage)
+	}
+
+	policy := newCaptchaPolicy()
+	if _, ok := verifier.(*turnstileVerifier); !ok {
+		policy.CData = false
+	}
+
+	metrics.Describe("captcha_checks_total", "CAPTCHA checks by failure policy and outcome")
+	return &captchaCheck{
+		verifier:    verifier,
+		tokens:      tokens,
+		policy:      policy,
+		outage:      outage,
+		outageScore: envInt("CAPTCHA_OUTAGE_SCORE", envInt("SPAM_QUARANTINE_SCORE", defaultSpamQuarantineScore)),
+		degradedRate: &repeatCheck{
+			seen:    make(map[string][]time.Time),
+			window:  time.Duration(envInt("CAPTCHA_DEGRADED_WINDOW_MINUTES", int(defaultDegradedWindow/time.Minute))) * time.Minute,
+			allowed: envInt("CAPTCHA_DEGRADED_ALLOWED", defaultDegradedAllowed),
+		},
+	}
+}
+
+func (*captchaCheck) Name() string { return "captcha" }
+
+func (c *captchaCheck) Check(ctx context.Context, sub *Submission) (SpamSignal, error) {
+	if c.verifier == nil {
+		c.count("disabled")
+		return SpamSignal{}, nil
+	}
+	token := sub.Form.CaptchaToken(c.verifier.FormField())
+	if token == "" {
+		c.count("missing")
+		return SpamSignal{Score: defaultSpamRejectScore, Reason: "missing token", Reject: true, Code: "captcha_required"}, nil
+	}
+	result, err := c.verifier.Verify(ctx, CaptchaRequest{
+		Token:          token,
+		RemoteIP:       sub.RemoteIP,
+		IdempotencyKey: sub.Request.Header.Get("Idempotency-Key"),
+	})
+	if err == nil && slices.Contains(result.ErrorCodes, "internal-error") {
+		err = fmt.Errorf("provider internal error: %v", result.ErrorCodes)
+	}
+	if err != nil {
+		return c.unavailable(ctx, sub, err)
+	}
+	if result.Success {
+		if problems := c.policy.Check(result, c.tokens.CData(sub.Form.FormToken), sub.Now); len(problems) > 0 {
+			result.Success = false
+			result.ErrorCodes = append(result.ErrorCodes, problems...)
+		}
+	}
+	if !result.Success {
+		c.count("failed")
+		log.Printf("%s verification failed: %v", c.verifier.Name(), result.ErrorCodes)
+		return SpamSignal{
+			Score:  defaultSpamRejectScore,
+			Reason: fmt.Sprintf("%s verification failed: %v", c.verifier.Name(), result.ErrorCodes),
+			Reject: true,
+			Code:   "captcha_failed",
+		}, nil
+	}
+	c.count("verified")
+	return SpamSignal{}, nil
+}
+
+// unavailable applies the outage policy when the provider couldn't verify
+// the token at all
+func (c *captchaCheck) unavailable(ctx context.Context, sub *Submission, err error) (SpamSignal, error) {
+	log.Printf("%s unavailable (policy %s): %v", c.verifier.Name(), c.outage, err)
+	reason := fmt.Sprintf("%s unavailable, accepted under %s policy", c.verifier.Name(), c.outage)
+
+	switch c.outage {
+	case CaptchaFailOpen:
+		c.count("outage_accepted")
+		return SpamSignal{Score: c.outageScore, Reason: reason}, nil
+	case CaptchaFailDegraded:
+		if limited, _ := c.degradedRate.Check(ctx, sub); limited.Score > 0 {
+			c.count("outage_rate_limited")
+			return SpamSignal{
+				Score:  defaultSpamRejectScore,
+				Reason: fmt.Sprintf("%s unavailable, %s", c.verifier.Name(), limited.Reason),
+				Reject: true,
+				Code:   "captcha_error",
+			}, nil
+		}
+		c.count("outage_accepted")
+		return SpamSignal{Score: c.outageScore, Reason: reason}, nil
+	default:
+		c.count("outage_rejected")
+		return SpamSignal{}, err
+	}
+}
+
+// count records the outcome of a check under the current policy
+func (c *captchaCheck) count(outcome string) {
+	metrics.Inc("captcha_checks_total", "policy", c.outage, "outcome", outcome)
+}
+
+// urlPattern finds links in free text, with or without a scheme
+var urlPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"']+`)
+
+// urlShorteners are domains commonly used to hide spam destinations
+var urlShorteners = map[string]bool{
+	"bit.ly":      true,
+	"tinyurl.com": true,
+	"t.co":        true,
+	"goo.gl":      true,
+	"ow.ly":       true,
+	"is.gd":       true,
+	"buff.ly":     true,
+	"rebrand.ly":  true,
+	"cutt.ly":     true,
+	"shorturl.at": true,
+	"rb.gy":       true,
+}
+
+// linkCheck scores links in the message. One link is normal (e.g. the
+// prospect's own website); each additional link or any shortener is not.
+type linkCheck struct{}
+
+func (linkCheck) Name() string { return "links" }
+
+func (linkCheck) Check(ctx context.Context, sub *Submission) (SpamSignal, error) {
+	links := urlPattern.FindAllString(sub.Form.Message, -1)
+	score := 0
+	if len(links) > 1 {
+		score += 2 * (len(links) - 1)
+	}
+	shorteners := 0
+	for _, link := range links {
+		if !strings.Contains(link, "://") {
+			link = "http://" + link
+		}
+		u, err := url.Parse(link)
+		if err != nil {
+			continue
+		}
+		if urlShorteners[strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")] {
+			shorteners++
+		}
+	}
+	score += 4 * shorteners
+	if score == 0 {
+		return SpamSignal{}, nil
+	}
+	return SpamSignal{
+		Score:  score,
+		Reason: fmt.Sprintf("%d links, %d shortened", len(links), shorteners),
+	}, nil
+}
+
+// blocklistCheck scores keyword and regex matches in the submission text
+type blocklistCheck struct {
+	patterns []*regexp.Regexp
+}
+
+// newBlocklistCheck loads patterns from SPAM_BLOCKLIST (comma-separated) and
+// SPAM_BLOCKLIST_FILE (one per line, # for comments). Entries wrapped in
+// slashes are regular expressions; anything else is a case-insensitive word.
+func newBlocklistCheck() blocklistCheck {
+	entries := strings.Split(os.Getenv("SPAM_BLOCKLIST"), ",")
+	if path := os.Getenv("SPAM_BLOCKLIST_FILE"); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Printf("Failed to open spam blocklist: %v", err)
+		} else {
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				entries = append(entries, scanner.Text())
+			}
+			f.Close()
+		}
+	}
+
+	var c blocklistCheck
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		expr := `(?i)\b` + regexp.QuoteMeta(entry) + `\b`
+		if len(entry) > 2 && strings.HasPrefix(entry, "/") && strings.HasSuffix(entry, "/") {
+			expr = "(?i)" + entry[1:len(entry)-1]
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			log.Printf("Invalid spam blocklist entry %q: %v", entry, err)
+			continue
+		}
+		c.patterns = append(c.patterns, re)
+	}
+	return c
+}
+
+func (blocklistCheck) Name() string { return "blocklist" }
+
+func (c blocklistCheck) Check(ctx context.Context, sub *Submission) (SpamSignal, error) {
+	text := strings.Join([]string{
+		sub.Form.FirstName, sub.Form.LastName, sub.Form.Email, sub.Form.Message,
+	}, "\n")
+	var matched []string
+	for _, re := range c.patterns {
+		if m := re.FindString(text); m != "" {
+			matched = append(matched, m)
+		}
+	}
+	if len(matched) == 0 {
+		return SpamSignal{}, nil
+	}
+	return SpamSignal{
+		Score:  5 * len(matched),
+		Reason: "matched " + strings.Join(matched, ", "),
+	}, nil
+}
+
+// Repeat submission defaults
+const (
+	defaultRepeatWindow  = time.Hour
+	defaultRepeatAllowed = 2
+	maxRepeatKeys        = 10000
+)
+
+// repeatCheck scores repeated submissions from the same email or IP within
+// a window. It keeps a bounded in-memory history, so it resets on restart.
+type repeatCheck struct {
+	mu      sync.Mutex
+	seen    map[string][]time.Time
+	window  time.Duration
+	allowed int
+}
+
+func newRepeatCheck() *repeatCheck {
+	return &repeatCheck{
+		seen:    make(map[string][]time.Time),
+		window:  time.Duration(envInt("SPAM_REPEAT_WINDOW_MINUTES", int(defaultRepeatWindow/time.Minute))) * time.Minute,
+		allowed: envInt("SPAM_REPEAT_ALLOWED", defaultRepeatAllowed),
+	}
+}
+
+func (*repeatCheck) Name() string { return "repeat" }
+
+func (c *repeatCheck) Check(ctx context.Context, sub *Submission) (SpamSignal, error) {
+	keys := []string{"ip:" + sub.RemoteIP}
+	if email := strings.ToLower(strings.TrimSpace(sub.Form.Email)); email != "" {
+		keys = append(keys, "email:"+email)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cutoff := sub.Now.Add(-c.window)
+	prior := 0
+	for _, key := range keys {
+		var recent []time.Time
+		for _, t := range c.seen[key] {
+			if t.After(cutoff) {
+				recent = append(recent, t)
+			}
+		}
+		prior = max(prior, len(recent))
+		c.seen[key] = append(recent, sub.Now)
+	}
+	c.prune(cutoff)
+
+	if prior < c.allowed {
+		return SpamSignal{}, nil
+	}
+	return SpamSignal{
+		Score:  3 * (prior - c.allowed + 1),
+		Reason: fmt.Sprintf("%d prior submissions in %s", prior, c.window),
+	}, nil
+}
+
+// prune drops expired entries once the history grows past its bound.
+// Callers must hold the lock.
+func (c *repeatCheck) prune(cutoff time.Time) {
+	if len(c.seen) <= maxRepeatKeys {
+		return
+	}
+	for key, times := range c.seen {
+		if len(times) == 0 || !times[len(times)-1].After(cutoff) {
+			delete(c.seen, key)
+		}
+	}
+	// Still too big: drop arbitrary entries rather than grow without bound
+	for key := range c.seen {
+		if len(c.seen) <= maxRepeatKeys {
+			break
+		}
+		delete(c.seen, key)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+// countingCheck records how often it ran and scores nothing
+type countingCheck struct{ runs *int }
+
+func (countingCheck) Name() string { return "counting" }
+func (c countingCheck) Check(context.Context, *Submission) (SpamSignal, error) {
+	*c.runs++
+	return SpamSignal{}, nil
+}
+
+func TestSpamPipeline(t *testing.T) {
+	t.Setenv("SPAM_BLOCKLIST", "casino,/crypto\\s+invest/")
+	issuer := testFormTokenIssuer(100)
+	now := time.Now()
+
+	tests := []struct {
+		name         string
+		form         ContactForm
+		wantDecision string
+		wantScore    int
+		wantChecks   []string
+		wantCode     string
+	}{
+		{"clean", ContactForm{Message: "We need a bookkeeper, see www.example.com"}, SpamAccept, 0, nil, ""},
+		{"honeypot", ContactForm{FormGuard: FormGuard{Website: "http://spam.example"}}, SpamReject, defaultSpamRejectScore, []string{"honeypot"}, ""},
+		{"two links", ContactForm{Message: "https://a.example and https://b.example"}, SpamAccept, 2, []string{"links"}, ""},
+		{"shortened links", ContactForm{Message: "https://bit.ly/x https://a.example https://b.example"}, SpamQuarantine, 8, []string{"links"}, ""},
+		{"one blocklisted word", ContactForm{Message: "Best CASINO offers"}, SpamQuarantine, 5, []string{"blocklist"}, ""},
+		{"blocklisted word and pattern", ContactForm{Message: "casino and crypto   investment"}, SpamReject, 10, []string{"blocklist"}, ""},
+		{"links and blocklist add up", ContactForm{Message: "casino https://bit.ly/x"}, SpamQuarantine, 9, []string{"links", "blocklist"}, ""},
+		{"expired form token", ContactForm{FormGuard: FormGuard{FormToken: issuer.Issue(now.Add(-2 * time.Hour))}}, SpamReject, defaultSpamRejectScore, []string{"form-token"}, "form_token_invalid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runs := 0
+			pipeline := &SpamPipeline{
+				Checks: []SpamCheck{
+					honeypotCheck{},
+					formTokenCheck{issuer: issuer, required: false},
+					linkCheck{},
+					newBlocklistCheck(),
+					countingCheck{&runs},
+				},
+				QuarantineScore: defaultSpamQuarantineScore,
+				RejectScore:     defaultSpamRejectScore,
+			}
+			form := tt.form
+			verdict, err := pipeline.Evaluate(context.Background(), &Submission{
+				Form:     &form,
+				Request:  httptest.NewRequest("POST", "/api/contact", nil),
+				RemoteIP: "203.0.113.7",
+				Now:      now,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var checks []string
+			for _, s := range verdict.Signals {
+				checks = append(checks, s.Check)
+			}
+			if verdict.Decision != tt.wantDecision || verdict.Score != tt.wantScore || !slices.Equal(checks, tt.wantChecks) {
+				t.Errorf("got %s, score %d from %q; want %s, score %d from %q (%q)",
+					verdict.Decision, verdict.Score, checks, tt.wantDecision, tt.wantScore, tt.wantChecks, verdict.Reasons())
+			}
+			if got := verdict.RejectCode(); got != tt.wantCode {
+				t.Errorf("reject code = %q, want %q", got, tt.wantCode)
+			}
+			// A rejection stops the pipeline before the remaining checks
+			wantRuns := 1
+			if verdict.Decision == SpamReject {
+				wantRuns = 0
+			}
+			if runs != wantRuns {
+				t.Errorf("last check ran %d times, want %d", runs, wantRuns)
+			}
+		})
+	}
+}
+
+func TestRepeatCheck(t *testing.T) {
+	start := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		ip, email string
+		after     time.Duration
+		wantScore int
+	}{
+		{"first", "203.0.113.7", "ana@example.com", 0, 0},
+		{"second", "203.0.113.7", "ana@example.com", time.Minute, 0},
+		{"third from the same IP", "203.0.113.7", "other@example.com", 2 * time.Minute, 3},
+		{"third from the same email", "198.51.100.1", "ANA@example.com", 3 * time.Minute, 3},
+		{"fourth from the same IP", "203.0.113.7", "cy@example.com", 4 * time.Minute, 6},
+		{"other visitor", "198.51.100.2", "bo@example.com", 5 * time.Minute, 0},
+		{"after the window", "203.0.113.7", "ana@example.com", 2 * time.Hour, 0},
+	}
+	check := &repeatCheck{seen: make(map[string][]time.Time), window: time.Hour, allowed: 2}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signal, _ := check.Check(context.Background(), &Submission{
+				Form:     &ContactForm{Email: tt.email},
+				RemoteIP: tt.ip,
+				Now:      start.Add(tt.after),
+			})
+			if signal.Score != tt.wantScore {
+				t.Errorf("score = %d, want %d (%s)", signal.Score, tt.wantScore, signal.Reason)
+			}
+		})
+	}
+}
+
+func TestSpamPipelineWithout(t *testing.T) {
+	pipeline := &SpamPipeline{Checks: []SpamCheck{honeypotCheck{}, linkCheck{}, newBlocklistCheck()}}
+	var names []string
+	for _, c := range pipeline.Without("links", "captcha").Checks {
+		names = append(names, c.Name())
+	}
+	if !slices.Equal(names, []string{"honeypot", "blocklist"}) {
+		t.Errorf("checks = %q", names)
+	}
+	if len(pipeline.Checks) != 3 {
+		t.Error("Without changed the original pipeline")
+	}
+}
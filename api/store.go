@@ -0,0 +1,448 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultDataDir is where the API keeps its persistent state
+const defaultDataDir = "data"
+
+// Lead statuses
+const (
+	LeadNew         = "new"
+	LeadQuarantined = "quarantined"
+	LeadSpam        = "spam"
+	LeadContacted   = "contacted"
+	LeadWon         = "won"
+	LeadLost        = "lost"
+)
+
+// leadPipelineStatuses are the statuses an admin can move an accepted lead to
+var leadPipelineStatuses = []string{LeadNew, LeadContacted, LeadWon, LeadLost}
+
+// errLeadNotFound is returned when a lead ID doesn't exist
+var errLeadNotFound = errors.New("lead not found")
+
+// Lead is a stored contact submission
+type Lead struct {
+	ID            string                `json:"id"`
+	Status        string                `json:"status"`
+	FirstName     string                `json:"firstName"`
+	LastName      string                `json:"lastName"`
+	Email         string                `json:"email"`
+	PhoneNumber   string                `json:"phoneNumber"`
+	AnnualRevenue string                `json:"annualRevenue"`
+	Services      []string              `json:"services"`
+	Message       string                `json:"message,omitempty"`
+	Locale        string                `json:"locale"`
+	Attachments   []Attachment          `json:"attachments,omitempty"`
+	Score         int                   `json:"score"`
+	Priority      string                `json:"priority,omitempty"`
+	ScoreReasons  []string              `json:"scoreReasons,omitempty"`
+	SpamScore     int                   `json:"spamScore"`
+	SpamReasons   []string              `json:"spamReasons,omitempty"`
+	RemoteIP      string                `json:"remoteIp,omitempty"`
+	CRM           map[string]CRMRef     `json:"crm,omitempty"` // by CRM name
+	Interactions  []Interaction         `json:"interactions,omitempty"`
+	Emails        []SentEmail           `json:"emails,omitempty"`
+	Timeline      []LeadEvent           `json:"timeline,omitempty"`
+	Conversation  []ConversationMessage `json:"conversation,omitempty"` // replies from the prospect
+	Consent       *Consent              `json:"consent,omitempty"`
+	// UnsubscribedAt is set once the prospect asks for no more follow-ups
+	UnsubscribedAt *time.Time `json:"unsubscribedAt,omitempty"`
+	// HardBouncedAt is set once email to the lead hard-bounces; call instead
+	HardBouncedAt *time.Time `json:"hardBouncedAt,omitempty"`
+	// ErasedAt is set once the prospect's details were erased on request
+	ErasedAt *time.Time `json:"erasedAt,omitempty"`
+	// Blind indexes of the email and phone number, for matching leads
+	// without decrypting them; empty when encryption is off
+	EmailIndex string `json:"emailIndex,omitempty"`
+	PhoneIndex string `json:"phoneIndex,omitempty"`
+	// Envelope holds the data key the PII fields are encrypted with on disk;
+	// it's nil in memory
+	Envelope  *Envelope `json:"envelope,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Interaction is a repeat submission merged into an existing lead
+type Interaction struct {
+	At            time.Time    `json:"at"`
+	AnnualRevenue string       `json:"annualRevenue,omitempty"`
+	Services      []string     `json:"services,omitempty"`
+	Message       string       `json:"message,omitempty"`
+	Attachments   []Attachment `json:"attachments,omitempty"`
+	RemoteIP      string       `json:"remoteIp,omitempty"`
+}
+
+// clone returns a deep copy of the lead, so callers can change the copy
+// without racing the store's readers
+func (l *Lead) clone() *Lead {
+	cp := *l
+	cp.Services = slices.Clone(l.Services)
+	cp.Attachments = slices.Clone(l.Attachments)
+	cp.ScoreReasons = slices.Clone(l.ScoreReasons)
+	cp.SpamReasons = slices.Clone(l.SpamReasons)
+	cp.CRM = maps.Clone(l.CRM)
+	cp.Interactions = slices.Clone(l.Interactions)
+	for i, in := range cp.Interactions {
+		cp.Interactions[i].Services = slices.Clone(in.Services)
+		cp.Interactions[i].Attachments = slices.Clone(in.Attachments)
+	}
+	cp.Emails = slices.Clone(l.Emails)
+	cp.Timeline = slices.Clone(l.Timeline)
+	cp.Conversation = slices.Clone(l.Conversation)
+	for i, msg := range cp.Conversation {
+		cp.Conversation[i].Attachments = slices.Clone(msg.Attachments)
+	}
+	if l.Consent != nil {
+		consent := *l.Consent
+		consent.History = slices.Clone(l.Consent.History)
+		cp.Consent = &consent
+	}
+	return &cp
+}
+
+// LastSubmittedAt returns when the prospect last submitted the form
+func (l *Lead) LastSubmittedAt() time.Time {
+	if n := len(l.Interactions); n > 0 {
+		return l.Interactions[n-1].At
+	}
+	return l.CreatedAt
+}
+
+// Merge records a repeat submission: services are unioned, the message is
+// appended, newer contact details fill in or replace older ones and a
+// change of consent is added to its history
+func (l *Lead) Merge(form *ContactForm, remoteIP string, at time.Time) {
+	l.Interactions = append(l.Interactions, Interaction{
+		At:            at,
+		AnnualRevenue: form.AnnualRevenue,
+		Services:      form.Services,
+		Message:       form.Message,
+		Attachments:   form.Attachments,
+		RemoteIP:      remoteIP,
+	})
+	for _, s := range form.Services {
+		if !slices.Contains(l.Services, s) {
+			l.Services = append(l.Services, s)
+		}
+	}
+	if form.Message != "" && !strings.Contains(l.Message, form.Message) {
+		if l.Message != "" {
+			l.Message += "\n\n--- " + at.Format(time.DateOnly) + " ---\n"
+		}
+		l.Message += form.Message
+	}
+	if form.AnnualRevenue != "" {
+		l.AnnualRevenue = form.AnnualRevenue
+	}
+	if form.PhoneNumber != "" {
+		l.PhoneNumber = form.PhoneNumber
+	}
+	if form.Email != "" {
+		l.Email = form.Email
+	}
+	l.Attachments = append(l.Attachments, form.Attachments...)
+	if l.Consent == nil {
+		l.Consent = newConsent(form, at)
+	} else {
+		l.Consent.record(form, at)
+	}
+}
+
+// normalizeEmail lowercases and trims an email address for matching
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// normalizePhone reduces a phone number to its digits, dropping a leading
+// US country code, for matching. Numbers too short to be real return "".
+func normalizePhone(phone string) string {
+	var digits strings.Builder
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+	d := digits.String()
+	if len(d) == 11 && d[0] == '1' {
+		d = d[1:]
+	}
+	if len(d) < 7 {
+		return ""
+	}
+	return d
+}
+
+// newLead creates a lead from a validated contact form
+func newLead(form *ContactForm, status string) *Lead {
+	now := time.Now().UTC()
+	return &Lead{
+		ID:            newID(),
+		Status:        status,
+		FirstName:     form.FirstName,
+		LastName:      form.LastName,
+		Email:         form.Email,
+		PhoneNumber:   form.PhoneNumber,
+		AnnualRevenue: form.AnnualRevenue,
+		Services:      form.Services,
+		Message:       form.Message,
+		Locale:        form.Locale,
+		Attachments:   form.Attachments,
+		Consent:       newConsent(form, now),
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+}
+
+// ContactForm rebuilds the submitted form, e.g. to send its emails later
+func (l *Lead) ContactForm() *ContactForm {
+	return &ContactForm{
+		FirstName:     l.FirstName,
+		LastName:      l.LastName,
+		Email:         l.Email,
+		PhoneNumber:   l.PhoneNumber,
+		AnnualRevenue: l.AnnualRevenue,
+		Services:      l.Services,
+		Message:       l.Message,
+		Locale:        l.Locale,
+		Attachments:   l.Attachments,
+	}
+}
+
+// LeadStore keeps leads in memory and persists them to a JSON file
+type LeadStore struct {
+	mu     sync.RWMutex
+	path   string
+	leads  map[string]*Lead
+	sealed sealedCache[Lead] // stored form of unchanged leads
+}
+
+// leads is the process-wide lead store, opened in main
+var leads *LeadStore
+
+// dataDir returns the directory persistent state is stored under
+func dataDir() string {
+	if dir := os.Getenv("DATA_DIR"); dir != "" {
+		return dir
+	}
+	return defaultDataDir
+}
+
+// openLeadStore loads the lead store from dir, creating it if needed
+func openLeadStore(dir string) (*LeadStore, error) {
+	s := &LeadStore{
+		path:   filepath.Join(dir, "leads.json"),
+		leads:  make(map[string]*Lead),
+		sealed: make(sealedCache[Lead]),
+	}
+	var list []*Lead
+	if err := loadJSON(s.path, &list); err != nil {
+		return nil, err
+	}
+	for _, l := range list {
+		if err := openLead(l); err != nil {
+			return nil, err
+		}
+		s.leads[l.ID] = l
+	}
+	return s, nil
+}
+
+// Create adds a new lead and persists the store
+func (s *LeadStore) Create(l *Lead) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.leads[l.ID] = l
+	s.sealed.forget(l.ID)
+	return s.save()
+}
+
+// Get returns a copy of the lead with the given ID
+func (s *LeadStore) Get(id string) (*Lead, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	l, ok := s.leads[id]
+	if !ok {
+		return nil, errLeadNotFound
+	}
+	return l.clone(), nil
+}
+
+// Update applies fn to the lead with the given ID and persists the store
+func (s *LeadStore) Update(id string, fn func(*Lead) error) (*Lead, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.leads[id]
+	if !ok {
+		return nil, errLeadNotFound
+	}
+	cp := l.clone()
+	if err := fn(cp); err != nil {
+		return nil, err
+	}
+	cp.UpdatedAt = time.Now().UTC()
+	s.leads[id] = cp
+	s.sealed.forget(id)
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+	return cp.clone(), nil
+}
+
+// Delete removes the lead with the given ID and persists the store
+func (s *LeadStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.leads[id]; !ok {
+		return errLeadNotFound
+	}
+	delete(s.leads, id)
+	s.sealed.forget(id)
+	return s.save()
+}
+
+// FindDuplicate returns the most recent accepted lead with the same email
+// or phone number that last submitted after since, or nil
+func (s *LeadStore) FindDuplicate(email, phone string, since time.Time) *Lead {
+	sameEmail, samePhone := emailMatcher(email), phoneMatcher(phone)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var match *Lead
+	for _, l := range s.leads {
+		if !slices.Contains(leadPipelineStatuses, l.Status) || !l.LastSubmittedAt().After(since) {
+			continue
+		}
+		if sameEmail(l.Email, l.EmailIndex) || samePhone(l.PhoneNumber, l.PhoneIndex) {
+			if match == nil || l.LastSubmittedAt().After(match.LastSubmittedAt()) {
+				match = l
+			}
+		}
+	}
+	if match == nil {
+		return nil
+	}
+	return match.clone()
+}
+
+// List returns the leads matching filter, newest first. A nil filter
+// matches every lead.
+func (s *LeadStore) List(filter func(*Lead) bool) []*Lead {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []*Lead
+	for _, l := range s.leads {
+		if filter == nil || filter(l) {
+			out = append(out, l.clone())
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].CreatedAt.After(out[j].CreatedAt)
+	})
+	return out
+}
+
+// ByEmail returns the leads with the given email address, newest first
+func (s *LeadStore) ByEmail(email string) []*Lead {
+	same := emailMatcher(email)
+	return s.List(func(l *Lead) bool { return same(l.Email, l.EmailIndex) })
+}
+
+// Reseal rewrites the store, encrypting every lead under the current key,
+// and returns how many were written
+func (s *LeadStore) Reseal() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.sealed)
+	return len(s.leads), s.save()
+}
+
+// save writes the store to disk, with each lead's PII encrypted when keys
+// are configured. Only leads changed since the last write are sealed again.
+// Callers must hold the write lock.
+func (s *LeadStore) save() error {
+	list := make([]*Lead, 0, len(s.leads))
+	for _, l := range s.leads {
+		sealed, err := s.sealed.get(l.ID, l, func(l *Lead) (*Lead, error) {
+			l.indexPII()
+			return sealLead(l)
+		})
+		if err != nil {
+			return err
+		}
+		list = append(list, sealed)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return saveJSON(s.path, list)
+}
+
+// loadJSON reads a JSON file into v. A missing file leaves v untouched.
+func loadJSON(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// saveJSON atomically replaces the file at path with v encoded as JSON
+func saveJSON(path string, v any) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic replaces the file at path with data through a temporary
+// file, so readers never see it half-written
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// newID returns a random 128-bit hex identifier
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// testLead returns an accepted lead with every contact field set
+func testLead() *Lead {
+	now := time.Now().UTC()
+	return &Lead{
+		ID:            newID(),
+		Status:        LeadNew,
+		FirstName:     "Ana",
+		LastName:      "García",
+		Email:         "ana@example.com",
+		PhoneNumber:   "+1 555 010 0199",
+		AnnualRevenue: "100k-500k",
+		Services:      []string{"essentials", "consulting"},
+		Message:       "We need help with our books.",
+		Locale:        "es",
+		Priority:      "high",
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+}
+
+func TestLeadMerge(t *testing.T) {
+	lead := testLead()
+	lead.Message = "We need help with our books."
+	at := lead.CreatedAt.Add(48 * time.Hour)
+
+	lead.Merge(&ContactForm{
+		Email:         "ana.garcia@example.com",
+		PhoneNumber:   "",
+		AnnualRevenue: "500k-1m",
+		Services:      []string{"consulting", "cleanup"},
+		Message:       "Also a cleanup of last year.",
+		Attachments:   []Attachment{{ID: "att2", Filename: "2024.pdf"}},
+	}, "203.0.113.9", at)
+	// Resubmitting the same text doesn't repeat it
+	lead.Merge(&ContactForm{Message: "Also a cleanup of last year."}, "203.0.113.9", at.Add(time.Hour))
+
+	if !slices.Equal(lead.Services, []string{"essentials", "consulting", "cleanup"}) {
+		t.Errorf("services = %q", lead.Services)
+	}
+	wantMessage := "We need help with our books.\n\n--- " + at.Format(time.DateOnly) + " ---\nAlso a cleanup of last year."
+	if lead.Message != wantMessage {
+		t.Errorf("message = %q, want %q", lead.Message, wantMessage)
+	}
+	if lead.Email != "ana.garcia@example.com" || lead.PhoneNumber != "+1 555 010 0199" || lead.AnnualRevenue != "500k-1m" {
+		t.Errorf("details = %s %s %s, want the new email and revenue and the old phone", lead.Email, lead.PhoneNumber, lead.AnnualRevenue)
+	}
+	if len(lead.Attachments) != 1 || len(lead.Interactions) != 2 || !lead.LastSubmittedAt().Equal(at.Add(time.Hour)) {
+		t.Errorf("attachments %d, interactions %d, last submitted %s", len(lead.Attachments), len(lead.Interactions), lead.LastSubmittedAt())
+	}
+}
+
+func TestLeadMergeConsent(t *testing.T) {
+	type submission struct {
+		consent bool
+		policy  string
+	}
+	tests := []struct {
+		name        string
+		first       submission
+		repeats     []submission
+		wantHistory []submission
+	}{
+		{"unchanged", submission{true, "v1"}, []submission{{true, "v1"}, {true, "v1"}}, nil},
+		{"withdrawn", submission{true, "v1"}, []submission{{false, "v1"}}, []submission{{false, "v1"}}},
+		{"granted later", submission{false, "v1"}, []submission{{false, "v1"}, {true, "v1"}}, []submission{{true, "v1"}}},
+		{"newer policy", submission{true, "v1"}, []submission{{true, "v2"}, {true, "v2"}}, []submission{{true, "v2"}}},
+		{"withdrawn and granted again", submission{true, "v1"}, []submission{{false, "v1"}, {true, "v1"}}, []submission{{false, "v1"}, {true, "v1"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+			t.Setenv("PRIVACY_POLICY_VERSION", tt.first.policy)
+			lead := newLead(&ContactForm{Consent: tt.first.consent}, LeadNew)
+			for i, s := range tt.repeats {
+				t.Setenv("PRIVACY_POLICY_VERSION", s.policy)
+				lead.Merge(&ContactForm{Consent: s.consent}, "", start.Add(time.Duration(i+1)*time.Hour))
+			}
+
+			// The first submission's consent is kept as it was
+			if lead.Consent.Given != tt.first.consent || lead.Consent.PolicyVersion != tt.first.policy {
+				t.Errorf("original consent = %v %s, want %v %s", lead.Consent.Given, lead.Consent.PolicyVersion, tt.first.consent, tt.first.policy)
+			}
+			var history []submission
+			for _, c := range lead.Consent.History {
+				history = append(history, submission{c.Given, c.PolicyVersion})
+			}
+			if !slices.Equal(history, tt.wantHistory) {
+				t.Errorf("history = %v, want %v", history, tt.wantHistory)
+			}
+
+			want := tt.first
+			if n := len(tt.wantHistory); n > 0 {
+				want = tt.wantHistory[n-1]
+			}
+			if given, version := lead.Consent.Current(); given != want.consent || version != want.policy {
+				t.Errorf("current = %v %s, want %v %s", given, version, want.consent, want.policy)
+			}
+			if clone := lead.clone(); len(clone.Consent.History) > 0 && &clone.Consent.History[0] == &lead.Consent.History[0] {
+				t.Error("clone shares the consent history")
+			}
+		})
+	}
+}
+
+func TestFindDuplicate(t *testing.T) {
+	now := time.Now().UTC()
+	lead := testLead()
+	lead.PhoneNumber = "(555) 010-0199"
+	quarantined := testLead()
+	quarantined.Email, quarantined.PhoneNumber, quarantined.Status = "held@example.com", "", LeadQuarantined
+	stale := testLead()
+	stale.Email, stale.PhoneNumber = "old@example.com", ""
+	stale.CreatedAt = now.Add(-60 * 24 * time.Hour)
+
+	tests := []struct {
+		name         string
+		email, phone string
+		want         string // lead ID, "" for none
+	}{
+		{"same email", "ana@example.com", "", lead.ID},
+		{"email in other case and spacing", "  Ana@Example.COM ", "", lead.ID},
+		{"phone formatted differently", "other@example.com", "+1 555-010-0199", lead.ID},
+		{"different person", "other@example.com", "555 010 0100", ""},
+		{"quarantined lead", "held@example.com", "", ""},
+		{"outside the window", "old@example.com", "", ""},
+		{"nothing to match on", "", "", ""},
+	}
+	for _, encrypted := range []bool{false, true} {
+		useTestLeadStore(t)
+		if encrypted {
+			useTestKeyring(t)
+		}
+		for _, l := range []*Lead{lead, quarantined, stale} {
+			if err := leads.Create(l.clone()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, tt := range tests {
+			name := tt.name
+			if encrypted {
+				name += " (encrypted)"
+			}
+			t.Run(name, func(t *testing.T) {
+				got := leads.FindDuplicate(tt.email, tt.phone, now.Add(-30*24*time.Hour))
+				switch {
+				case tt.want == "" && got != nil:
+					t.Errorf("matched lead %s", got.ID)
+				case tt.want != "" && (got == nil || got.ID != tt.want):
+					t.Errorf("got %v, want lead %s", got, tt.want)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,552 @@
+package main
+
+import (
+	"cmp"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Subscriber statuses
+const (
+	SubscriberPending      = "pending"
+	SubscriberConfirmed    = "confirmed"
+	SubscriberUnsubscribed = "unsubscribed"
+)
+
+// subscribeLinkTTL is how long a confirmation link works
+const subscribeLinkTTL = 7 * 24 * time.Hour
+
+// Subscribe link errors
+var (
+	errSubscribeLinkInvalid = errors.New("invalid confirmation link")
+	errSubscribeLinkExpired = errors.New("confirmation link expired")
+	errSubscriberNotFound   = errors.New("subscriber not found")
+)
+
+// Subscriber is a newsletter signup. The request and confirmation
+// timestamps and IPs are the record of consent.
+type Subscriber struct {
+	ID             string     `json:"id"`
+	Email          string     `json:"email"`
+	Status         string     `json:"status"`
+	Locale         string     `json:"locale"`
+	Source         string     `json:"source,omitempty"` // page the form was posted from
+	SignupIP       string     `json:"signupIp,omitempty"`
+	RequestedAt    time.Time  `json:"requestedAt"`
+	ConfirmedAt    *time.Time `json:"confirmedAt,omitempty"`
+	ConfirmIP      string     `json:"confirmIp,omitempty"`
+	UnsubscribedAt *time.Time `json:"unsubscribedAt,omitempty"`
+	// Envelope holds the data key the PII fields are encrypted with on
+	// disk; it's nil in memory
+	Envelope  *Envelope `json:"envelope,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// SubscriberStore is the persistent newsletter list, one entry per
+// normalized email
+type SubscriberStore struct {
+	mu     sync.RWMutex
+	path   string
+	subs   map[string]*Subscriber
+	sealed sealedCache[Subscriber] // stored form of unchanged subscribers
+}
+
+// subscribers is the process-wide newsletter list, opened in main
+var subscribers *SubscriberStore
+
+// openSubscriberStore loads the list from dir, creating it if needed
+func openSubscriberStore(dir string) (*SubscriberStore, error) {
+	s := &SubscriberStore{
+		path:   filepath.Join(dir, "subscribers.json"),
+		subs:   make(map[string]*Subscriber),
+		sealed: make(sealedCache[Subscriber]),
+	}
+	var list []*Subscriber
+	if err := loadJSON(s.path, &list); err != nil {
+		return nil, err
+	}
+	for _, sub := range list {
+		if err := openSubscriber(sub); err != nil {
+			return nil, err
+		}
+		s.subs[sub.ID] = sub
+	}
+	metrics.Describe("newsletter_signups_total", "Newsletter signups, by outcome")
+	return s, nil
+}
+
+// byEmail returns the subscriber for an address. Callers must hold the lock.
+func (s *SubscriberStore) byEmail(email string) *Subscriber {
+	key := normalizeEmail(email)
+	for _, sub := range s.subs {
+		if sub.Email == key {
+			return sub
+		}
+	}
+	return nil
+}
+
+// Request records a signup awaiting confirmation and reports whether a
+// confirmation email should go out; an address that's already confirmed
+// needs none
+func (s *SubscriberStore) Request(email, locale, source, ip string) (*Subscriber, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	sub := s.byEmail(email)
+	if sub != nil && sub.Status == SubscriberConfirmed {
+		cp := *sub
+		return &cp, false, nil
+	}
+	if sub == nil {
+		sub = &Subscriber{ID: newID(), Email: normalizeEmail(email), CreatedAt: now}
+		s.subs[sub.ID] = sub
+	}
+	sub.Status, sub.Locale, sub.Source, sub.SignupIP = SubscriberPending, locale, source, ip
+	sub.RequestedAt, sub.UpdatedAt = now, now
+	s.sealed.forget(sub.ID)
+	if err := s.save(); err != nil {
+		return nil, false, err
+	}
+	cp := *sub
+	return &cp, true, nil
+}
+
+// Confirm records the subscriber's opt-in and reports whether it changed
+// anything, so a link clicked twice confirms once
+func (s *SubscriberStore) Confirm(id, ip string) (*Subscriber, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.subs[id]
+	if !ok {
+		return nil, false, errSubscriberNotFound
+	}
+	if sub.Status == SubscriberConfirmed {
+		cp := *sub
+		return &cp, false, nil
+	}
+	now := time.Now().UTC()
+	sub.Status, sub.ConfirmedAt, sub.ConfirmIP = SubscriberConfirmed, &now, ip
+	sub.UnsubscribedAt, sub.UpdatedAt = nil, now
+	s.sealed.forget(sub.ID)
+	if err := s.save(); err != nil {
+		return nil, false, err
+	}
+	cp := *sub
+	return &cp, true, nil
+}
+
+// Unsubscribe takes an address off the list. It returns nil if there was
+// nothing to do, or the subscriber and whether they had been confirmed.
+func (s *SubscriberStore) Unsubscribe(email string) (*Subscriber, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub := s.byEmail(email)
+	if sub == nil || sub.Status == SubscriberUnsubscribed {
+		return nil, false, nil
+	}
+	wasConfirmed := sub.Status == SubscriberConfirmed
+	now := time.Now().UTC()
+	sub.Status, sub.UnsubscribedAt, sub.UpdatedAt = SubscriberUnsubscribed, &now, now
+	s.sealed.forget(sub.ID)
+	if err := s.save(); err != nil {
+		return nil, false, err
+	}
+	cp := *sub
+	return &cp, wasConfirmed, nil
+}
+
+// Delete removes the subscriber with the given ID
+func (s *SubscriberStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.subs[id]; !ok {
+		return errSubscriberNotFound
+	}
+	delete(s.subs, id)
+	s.sealed.forget(id)
+	return s.save()
+}
+
+// ByEmail returns a copy of the subscriber for an address, or nil
+func (s *SubscriberStore) ByEmail(email string) *Subscriber {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sub := s.byEmail(email)
+	if sub == nil {
+		return nil
+	}
+	cp := *sub
+	return &cp
+}
+
+// Get returns a copy of the subscriber with the given ID
+func (s *SubscriberStore) Get(id string) (*Subscriber, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sub, ok := s.subs[id]
+	if !ok {
+		return nil, errSubscriberNotFound
+	}
+	cp := *sub
+	return &cp, nil
+}
+
+// List returns copies of the subscribers with the given status (all if
+// empty), newest first
+func (s *SubscriberStore) List(status string) []*Subscriber {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]*Subscriber, 0, len(s.subs))
+	for _, sub := range s.subs {
+		if status == "" || sub.Status == status {
+			cp := *sub
+			out = append(out, &cp)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].CreatedAt.After(out[j].CreatedAt)
+	})
+	return out
+}
+
+// Reseal rewrites the list, encrypting every subscriber under the current
+// key, and returns how many were written
+func (s *SubscriberStore) Reseal() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.sealed)
+	return len(s.subs), s.save()
+}
+
+// save writes the list to disk, with each subscriber's PII encrypted when
+// keys are configured. Callers must hold the write lock.
+func (s *SubscriberStore) save() error {
+	out := make([]*Subscriber, 0, len(s.subs))
+	for _, sub := range s.subs {
+		sealed, err := s.sealed.get(sub.ID, sub, sealSubscriber)
+		if err != nil {
+			return err
+		}
+		out = append(out, sealed)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].CreatedAt.Before(out[j].CreatedAt)
+	})
+	return saveJSON(s.path, out)
+}
+
+// SubscribeSigner signs the confirmation links in signup emails. A link is
+// bound to the subscriber and expires subscribeLinkTTL after the request.
+type SubscribeSigner struct {
+	secret []byte
+}
+
+// subscribeSigner is the process-wide confirmation link signer, built in main
+var subscribeSigner *SubscribeSigner
+
+// newSubscribeSigner builds the signer from SUBSCRIBE_SECRET. Without it a
+// random key is used, so emailed links stop working on restart.
+func newSubscribeSigner() *SubscribeSigner {
+	secret := []byte(os.Getenv("SUBSCRIBE_SECRET"))
+	if len(secret) == 0 {
+		log.Println("SUBSCRIBE_SECRET not set, using a random key (emailed confirmation links break on restart)")
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	}
+	return &SubscribeSigner{secret: secret}
+}
+
+// Token returns the signed confirmation token for the subscriber
+func (s *SubscribeSigner) Token(sub *Subscriber) string {
+	exp := sub.RequestedAt.Add(subscribeLinkTTL).Unix()
+	return strconv.FormatInt(exp, 10) + "." + hex.EncodeToString(s.sign(sub.ID, exp))
+}
+
+// URL returns the absolute confirmation link for the subscriber
+func (s *SubscribeSigner) URL(sub *Subscriber) string {
+	q := url.Values{"id": {sub.ID}, "token": {s.Token(sub)}, "locale": {sub.Locale}}
+	return publicBaseURL() + "/api/subscribe/confirm?" + q.Encode()
+}
+
+// Verify checks a confirmation token for a subscriber ID at now
+func (s *SubscribeSigner) Verify(id, token string, now time.Time) error {
+	encExp, encSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return errSubscribeLinkInvalid
+	}
+	exp, err1 := strconv.ParseInt(encExp, 10, 64)
+	sig, err2 := hex.DecodeString(encSig)
+	if err1 != nil || err2 != nil || !hmac.Equal(sig, s.sign(id, exp)) {
+		return errSubscribeLinkInvalid
+	}
+	if !now.Before(time.Unix(exp, 0)) {
+		return errSubscribeLinkExpired
+	}
+	return nil
+}
+
+func (s *SubscribeSigner) sign(id string, exp int64) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "confirm|%s|%d", id, exp)
+	return mac.Sum(nil)
+}
+
+// SubscribeRequest is the body of POST /api/subscribe
+type SubscribeRequest struct {
+	Email  string `json:"email"`
+	Locale string `json:"locale"`
+	Source string `json:"source"` // page the form was posted from
+	FormGuard
+}
+
+func (req *SubscribeRequest) readValues(values url.Values) {
+	req.Email = values.Get("email")
+	req.Locale = values.Get("locale")
+	req.Source = values.Get("source")
+	req.FormGuard.readValues(values)
+}
+
+// handleSubscribe takes a newsletter signup. It runs the contact form's
+// spam pipeline, checks only the email, and sends a confirmation link.
+// Every accepted request gets the same answer, so the endpoint doesn't
+// reveal who is already on the list.
+func handleSubscribe(w http.ResponseWriter, r *http.Request) {
+	locale := negotiateLocale("", r.Header.Get("Accept-Language"))
+	resp := newContactResponder(w, r, locale)
+
+	var req SubscribeRequest
+	if err := decodeForm(w, r, &req, strictJSON()); err != nil {
+		status, code, detail := decodeErrorCode(err)
+		log.Printf("Failed to decode subscribe body (%s): %v", code, err)
+		resp.ErrorDetail(status, code, detail)
+		return
+	}
+	locale = negotiateLocale(req.Locale, r.Header.Get("Accept-Language"))
+	resp.locale = locale
+	w.Header().Set("Content-Language", locale)
+	pending := func() {
+		resp.Message("subscribe_pending", url.Values{"subscribe": {"pending"}})
+	}
+
+	remoteIP := clientIP(r)
+	verdict, err := spamPipeline.Evaluate(r.Context(), &Submission{
+		Form:     &ContactForm{Email: req.Email, Locale: locale, FormGuard: req.FormGuard},
+		Request:  r,
+		RemoteIP: remoteIP,
+		Now:      time.Now(),
+	})
+	if err != nil {
+		log.Printf("Spam check error: %v", err)
+		resp.Error(http.StatusInternalServerError, "captcha_error")
+		return
+	}
+	switch verdict.Decision {
+	case SpamReject:
+		log.Printf("Rejected likely spam signup from IP %s: %v", remoteIP, verdict.Reasons())
+		metrics.Inc("newsletter_signups_total", "outcome", "rejected")
+		if code := verdict.RejectCode(); code != "" {
+			resp.Error(http.StatusBadRequest, code)
+			return
+		}
+		pending()
+		return
+	case SpamQuarantine:
+		// Nothing to review for a bare email address, so drop it quietly
+		log.Printf("Dropped suspicious signup from IP %s: %v", remoteIP, verdict.Reasons())
+		metrics.Inc("newsletter_signups_total", "outcome", "dropped")
+		pending()
+		return
+	}
+
+	email := strings.TrimSpace(req.Email)
+	var code string
+	switch {
+	case email == "":
+		code = "email_required"
+	case len(email) > 254:
+		code = "email_too_long"
+	case !emailPattern.MatchString(email):
+		code = "email_invalid"
+	}
+	if code != "" {
+		resp.ValidationFailed([]ValidationError{{Field: "email", Code: code, Message: translate(locale, code)}})
+		return
+	}
+
+	source := cmp.Or(strings.TrimSpace(req.Source), refererPath(r))
+	if len(source) > 500 {
+		source = source[:500]
+	}
+	sub, send, err := subscribers.Request(email, locale, source, remoteIP)
+	if err != nil {
+		log.Printf("Failed to store signup: %v", err)
+		resp.Error(http.StatusInternalServerError, "send_failed")
+		return
+	}
+	if send {
+		if err := sendSubscribeConfirmation(sub); err != nil && !errors.Is(err, errSuppressed) {
+			log.Printf("Failed to send confirmation to subscriber %s: %v", sub.ID, err)
+			resp.Error(http.StatusInternalServerError, "send_failed")
+			return
+		}
+	}
+	log.Printf("Newsletter signup %s from %s", sub.ID, cmp.Or(source, "unknown page"))
+	metrics.Inc("newsletter_signups_total", "outcome", "requested")
+	pending()
+}
+
+// sendSubscribeConfirmation emails the double opt-in link. It goes out as
+// transactional mail, so an address that once unsubscribed can opt back in.
+func sendSubscribeConfirmation(sub *Subscriber) error {
+	token, from := os.Getenv("POSTMARK_TOKEN"), os.Getenv("POSTMARK_FROM")
+	if token == "" || from == "" {
+		return fmt.Errorf("missing email configuration")
+	}
+	tr := func(key string, args ...any) string {
+		return translate(sub.Locale, key, args...)
+	}
+	subject := tr("subscribe.subject")
+	htmlBody, textBody := simpleEmail(sub.Locale, subject,
+		[]string{tr("subscribe.body")},
+		[]emailLink{{Label: tr("subscribe.confirm"), URL: subscribeSigner.URL(sub)}},
+		"", "")
+	_, err := sendEmail(token, PostmarkEmail{
+		From:          from,
+		To:            sub.Email,
+		Subject:       subject,
+		TextBody:      textBody,
+		HtmlBody:      htmlBody,
+		MessageStream: "outbound",
+	})
+	return err
+}
+
+// handleSubscribeConfirm serves the link in the confirmation email. GET
+// shows a button so link scanners can't opt anyone in; POST confirms.
+func handleSubscribeConfirm(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	id, token := q.Get("id"), q.Get("token")
+	locale := negotiateLocale(q.Get("locale"), r.Header.Get("Accept-Language"))
+	tr := func(key string, args ...any) string {
+		return translate(locale, key, args...)
+	}
+	page := func(status int, data linkPageData) {
+		data.Locale, data.Title, data.Token = locale, tr("subscribe.page_title"), token
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		w.WriteHeader(status)
+		if err := linkPage.Execute(w, data); err != nil {
+			log.Printf("Failed to render confirmation page: %v", err)
+		}
+	}
+
+	if err := subscribeSigner.Verify(id, token, time.Now()); err != nil {
+		code := "subscribe_link_invalid"
+		if errors.Is(err, errSubscribeLinkExpired) {
+			code = "subscribe_link_expired"
+		}
+		page(http.StatusForbidden, linkPageData{Error: tr(code)})
+		return
+	}
+	sub, err := subscribers.Get(id)
+	if err != nil {
+		page(http.StatusNotFound, linkPageData{Error: tr("subscribe_link_invalid")})
+		return
+	}
+	if r.Method == http.MethodGet {
+		page(http.StatusOK, linkPageData{Message: tr("subscribe.prompt", sub.Email), Confirm: tr("subscribe.confirm")})
+		return
+	}
+
+	sub, changed, err := subscribers.Confirm(id, clientIP(r))
+	if err != nil {
+		log.Printf("Failed to confirm subscriber %s: %v", id, err)
+		page(http.StatusInternalServerError, linkPageData{Error: tr("send_failed")})
+		return
+	}
+	if changed {
+		// Opting back in lifts an earlier unsubscribe, but never a bounce
+		// or complaint
+		if e := suppressions.Get(sub.Email); e != nil && e.Reason == SuppressUnsubscribed {
+			if err := suppressions.Remove(sub.Email); err != nil {
+				log.Printf("Failed to lift unsubscribe for %s: %v", sub.Email, err)
+			}
+		}
+		log.Printf("Subscriber %s confirmed", sub.ID)
+		metrics.Inc("newsletter_signups_total", "outcome", "confirmed")
+		webhooks.EnqueueSubscriber(EventSubscriberConfirmed, sub)
+	}
+	page(http.StatusOK, linkPageData{Message: tr("subscribe_confirmed", sub.Email)})
+}
+
+// handleAdminListSubscribers lists subscribers, optionally filtered by
+// ?status=
+func handleAdminListSubscribers(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, subscribers.List(r.URL.Query().Get("status")))
+}
+
+// handleAdminExportSubscribers downloads subscribers with their consent
+// record as CSV, confirmed only unless ?status= says otherwise
+func handleAdminExportSubscribers(w http.ResponseWriter, r *http.Request) {
+	status := cmp.Or(r.URL.Query().Get("status"), SubscriberConfirmed)
+	if status == "all" {
+		status = ""
+	}
+	w.Header().Set("Content-Type", exportContentTypes[ExportCSV][0])
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q",
+		"subscribers-"+time.Now().UTC().Format("20060102")+".csv"))
+	w.Header().Set("Cache-Control", "no-store")
+	if err := exportSubscribersCSV(w, subscribers.List(status)); err != nil {
+		log.Printf("Subscriber export failed: %v", err)
+	}
+}
+
+// exportSubscribersCSV writes subscribers oldest first
+func exportSubscribersCSV(w io.Writer, list []*Subscriber) error {
+	// A BOM makes Excel read the file as UTF-8
+	if _, err := io.WriteString(w, "\ufeff"); err != nil {
+		return err
+	}
+	stamp := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	}
+	cw := csv.NewWriter(w)
+	cw.Write([]string{
+		"ID", "Email", "Status", "Language", "Source", "Requested", "Signup IP", "Confirmed", "Confirm IP", "Unsubscribed",
+	})
+	for i := len(list) - 1; i >= 0; i-- {
+		s := list[i]
+		row := []string{
+			s.ID, s.Email, s.Status, s.Locale, s.Source, s.RequestedAt.Format(time.RFC3339), s.SignupIP,
+			stamp(s.ConfirmedAt), s.ConfirmIP, stamp(s.UnsubscribedAt),
+		}
+		for j, cell := range row {
+			row[j] = csvSafe(cell)
+		}
+		cw.Write(row)
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Suppression reasons. An unsubscribe only stops follow-up (bulk) mail;
+// the others stop all mail to the address, since it doesn't exist or the
+// recipient reported us.
+const (
+	SuppressUnsubscribed  = "unsubscribed"
+	SuppressHardBounce    = "hard_bounce"
+	SuppressSpamComplaint = "spam_complaint"
+	SuppressManual        = "manual"
+)
+
+// errSuppressed is returned by sendEmail when every recipient is suppressed
+var errSuppressed = errors.New("all recipients are suppressed")
+
+// Suppression is an address we must not send to
+type Suppression struct {
+	ID        string    `json:"id"`
+	Email     string    `json:"email"`
+	Reason    string    `json:"reason"`
+	Source    string    `json:"source"` // e.g. link, one-click, postmark, admin
+	Detail    string    `json:"detail,omitempty"`
+	Envelope  *Envelope `json:"envelope,omitempty"` // see Lead
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Blocks reports whether the suppression stops a message; bulk is set for
+// follow-up mail as opposed to replies, confirmations and reminders
+func (s *Suppression) Blocks(bulk bool) bool {
+	return bulk || s.Reason != SuppressUnsubscribed
+}
+
+// SuppressionList is the persistent list of suppressed addresses, keyed by
+// normalized email
+type SuppressionList struct {
+	mu      sync.RWMutex
+	path    string
+	entries map[string]*Suppression
+	sealed  sealedCache[Suppression] // by normalized email, like entries
+}
+
+// suppressions is the process-wide suppression list, opened in main
+var suppressions *SuppressionList
+
+// openSuppressionList loads the list from dir, creating it if needed
+func openSuppressionList(dir string) (*SuppressionList, error) {
+	s := &SuppressionList{
+		path:    filepath.Join(dir, "suppressions.json"),
+		entries: make(map[string]*Suppression),
+		sealed:  make(sealedCache[Suppression]),
+	}
+	var list []*Suppression
+	if err := loadJSON(s.path, &list); err != nil {
+		return nil, err
+	}
+	for _, e := range list {
+		if err := openSuppression(e); err != nil {
+			return nil, err
+		}
+		if e.ID == "" {
+			e.ID = newID() // written before entries had IDs
+		}
+		s.entries[normalizeEmail(e.Email)] = e
+	}
+	metrics.Describe("emails_suppressed_total", "Email recipients dropped by the suppression list, by reason")
+	return s, nil
+}
+
+// Add suppresses an address. An existing entry is only replaced by a
+// stronger reason, so a later unsubscribe doesn't hide a hard bounce.
+func (s *SuppressionList) Add(email, reason, source, detail string) (*Suppression, error) {
+	key := normalizeEmail(email)
+	if key == "" {
+		return nil, errors.New("missing email")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok && (e.Reason != SuppressUnsubscribed || reason == SuppressUnsubscribed) {
+		cp := *e
+		return &cp, nil
+	}
+	e := &Suppression{ID: newID(), Email: key, Reason: reason, Source: source, Detail: detail, CreatedAt: time.Now().UTC()}
+	s.entries[key] = e
+	s.sealed.forget(key)
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+	log.Printf("Suppressed %s (%s via %s)", key, reason, source)
+	cp := *e
+	return &cp, nil
+}
+
+// Remove lifts the suppression for an address
+func (s *SuppressionList) Remove(email string) error {
+	key := normalizeEmail(email)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.entries[key]; !ok {
+		return errSuppressionNotFound
+	}
+	delete(s.entries, key)
+	s.sealed.forget(key)
+	return s.save()
+}
+
+// errSuppressionNotFound is returned for an address that isn't suppressed
+var errSuppressionNotFound = errors.New("address is not suppressed")
+
+// Get returns the suppression for an address, or nil
+func (s *SuppressionList) Get(email string) *Suppression {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, ok := s.entries[normalizeEmail(email)]
+	if !ok {
+		return nil
+	}
+	cp := *e
+	return &cp
+}
+
+// List returns every suppression, newest first
+func (s *SuppressionList) List() []*Suppression {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]*Suppression, 0, len(s.entries))
+	for _, e := range s.entries {
+		cp := *e
+		out = append(out, &cp)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].CreatedAt.After(out[j].CreatedAt)
+	})
+	return out
+}
+
+// Reseal rewrites the list, encrypting every entry under the current key,
+// and returns how many were written
+func (s *SuppressionList) Reseal() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	clear(s.sealed)
+	return len(s.entries), s.save()
+}
+
+// save writes the list to disk, with addresses encrypted when keys are
+// configured. Callers must hold the write lock.
+func (s *SuppressionList) save() error {
+	out := make([]*Suppression, 0, len(s.entries))
+	for key, e := range s.entries {
+		sealed, err := s.sealed.get(key, e, sealSuppression)
+		if err != nil {
+			return err
+		}
+		out = append(out, sealed)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].CreatedAt.Before(out[j].CreatedAt)
+	})
+	return saveJSON(s.path, out)
+}
+
+// filterRecipients drops suppressed addresses from a comma-separated
+// recipient list, returning what's left
+func (s *SuppressionList) filterRecipients(to string, bulk bool) string {
+	if s == nil {
+		return to
+	}
+	var kept []string
+	for _, rcpt := range strings.Split(to, ",") {
+		rcpt = strings.TrimSpace(rcpt)
+		if rcpt == "" {
+			continue
+		}
+		addr := rcpt
+		if a, err := mail.ParseAddress(rcpt); err == nil {
+			addr = a.Address
+		}
+		if e := s.Get(addr); e != nil && e.Blocks(bulk) {
+			log.Printf("Not sending to suppressed address %s (%s)", e.Email, e.Reason)
+			metrics.Inc("emails_suppressed_total", "reason", e.Reason)
+			continue
+		}
+		kept = append(kept, rcpt)
+	}
+	return strings.Join(kept, ", ")
+}
+
+// UnsubscribeSigner signs unsubscribe links. Links don't expire: an
+// opt-out must keep working for as long as the email sits in an inbox.
+type UnsubscribeSigner struct {
+	secret []byte
+}
+
+// unsubscribeSigner is the process-wide unsubscribe link signer, built in main
+var unsubscribeSigner *UnsubscribeSigner
+
+// newUnsubscribeSigner builds the signer from UNSUBSCRIBE_SECRET. Without
+// it a random key is used, so emailed links stop working on restart.
+func newUnsubscribeSigner() *UnsubscribeSigner {
+	secret := []byte(os.Getenv("UNSUBSCRIBE_SECRET"))
+	if len(secret) == 0 {
+		log.Println("UNSUBSCRIBE_SECRET not set, using a random key (emailed unsubscribe links break on restart)")
+		secret = make([]byte, 32)
+		rand.Read(secret)
+	}
+	return &UnsubscribeSigner{secret: secret}
+}
+
+// Token returns the signed token for an address
+func (s *UnsubscribeSigner) Token(email string) string {
+	return hex.EncodeToString(s.sign(email))
+}
+
+// URL returns the absolute unsubscribe link for an address
+func (s *UnsubscribeSigner) URL(email, locale string) string {
+	q := url.Values{"email": {normalizeEmail(email)}, "token": {s.Token(email)}, "locale": {locale}}
+	return publicBaseURL() + "/api/unsubscribe?" + q.Encode()
+}
+
+// Verify checks a token for an address
+func (s *UnsubscribeSigner) Verify(email, token string) bool {
+	sig, err := hex.DecodeString(token)
+	return err == nil && normalizeEmail(email) != "" && hmac.Equal(sig, s.sign(email))
+}
+
+func (s *UnsubscribeSigner) sign(email string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte("unsubscribe|" + normalizeEmail(email)))
+	return mac.Sum(nil)
+}
+
+// withUnsubscribe marks an email as bulk follow-up mail, sends it on the
+// broadcast stream and adds one-click List-Unsubscribe headers (RFC 8058)
+func withUnsubscribe(email PostmarkEmail, locale string) PostmarkEmail {
+	link := unsubscribeSigner.URL(email.To, locale)
+	email.bulk = true
+	email.MessageStream = broadcastStream()
+	email.Headers = append(email.Headers,
+		PostmarkHeader{Name: "List-Unsubscribe", Value: "<" + link + ">"},
+		PostmarkHeader{Name: "List-Unsubscribe-Post", Value: "List-Unsubscribe=One-Click"},
+	)
+	return email
+}
+
+// broadcastStream is the Postmark message stream for bulk follow-up mail
+func broadcastStream() string {
+	if v := os.Getenv("POSTMARK_BROADCAST_STREAM"); v != "" {
+		return v
+	}
+	return "outbound"
+}
+
+// unsubscribe suppresses an address for follow-up mail and stops the
+// follow-up sequence of every lead using it
+func unsubscribe(email, source string) error {
+	if _, err := suppressions.Add(email, SuppressUnsubscribed, source, ""); err != nil {
+		return err
+	}
+	for _, l := range leads.ByEmail(email) {
+		_, err := leads.Update(l.ID, func(l *Lead) error {
+			if l.UnsubscribedAt == nil {
+				now := time.Now().UTC()
+				l.UnsubscribedAt = &now
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("Failed to mark lead %s unsubscribed: %v", l.ID, err)
+		}
+		scheduler.StopNurture(l.ID, "lead unsubscribed")
+	}
+	sub, wasConfirmed, err := subscribers.Unsubscribe(email)
+	if err != nil {
+		log.Printf("Failed to unsubscribe newsletter subscriber %s: %v", normalizeEmail(email), err)
+	} else if wasConfirmed {
+		webhooks.EnqueueSubscriber(EventSubscriberUnsubscribed, sub)
+	}
+	return nil
+}
+
+// handleUnsubscribe serves the link in follow-up emails. GET shows a
+// confirmation so link scanners can't unsubscribe anyone; POST, from the
+// page or a mail client's one-click List-Unsubscribe-Post, unsubscribes.
+func handleUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	email, token := q.Get("email"), q.Get("token")
+	locale := negotiateLocale(q.Get("locale"), r.Header.Get("Accept-Language"))
+	tr := func(key string, args ...any) string {
+		return translate(locale, key, args...)
+	}
+	page := func(status int, data linkPageData) {
+		data.Locale, data.Title, data.Token = locale, tr("unsubscribe.page_title"), token
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		w.WriteHeader(status)
+		if err := linkPage.Execute(w, data); err != nil {
+			log.Printf("Failed to render unsubscribe page: %v", err)
+		}
+	}
+
+	if !unsubscribeSigner.Verify(email, token) {
+		log.Printf("Invalid unsubscribe link from IP %s", clientIP(r))
+		page(http.StatusForbidden, linkPageData{Error: tr("unsubscribe_invalid")})
+		return
+	}
+	if r.Method == http.MethodGet {
+		page(http.StatusOK, linkPageData{Message: tr("unsubscribe.prompt", email), Confirm: tr("unsubscribe.confirm")})
+		return
+	}
+
+	source := "link"
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes())
+	if r.PostFormValue("List-Unsubscribe") == "One-Click" {
+		source = "one-click"
+	}
+	if err := unsubscribe(email, source); err != nil {
+		log.Printf("Failed to unsubscribe %s: %v", email, err)
+		page(http.StatusInternalServerError, linkPageData{Error: tr("send_failed")})
+		return
+	}
+	page(http.StatusOK, linkPageData{Message: tr("unsubscribe_done", email)})
+}
+
+// handleAdminListSuppressions lists suppressed addresses, optionally
+// filtered by ?reason=
+func handleAdminListSuppressions(w http.ResponseWriter, r *http.Request) {
+	reason := r.URL.Query().Get("reason")
+	list := suppressions.List()
+	if reason != "" {
+		kept := list[:0]
+		for _, e := range list {
+			if e.Reason == reason {
+				kept = append(kept, e)
+			}
+		}
+		list = kept
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// handleAdminAddSuppression suppresses an address by hand
+// ({"email": ..., "reason": ..., "detail": ...}; reason defaults to manual)
+func handleAdminAddSuppression(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email  string `json:"email"`
+		Reason string `json:"reason"`
+		Detail string `json:"detail"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes())).Decode(&req); err != nil || !emailPattern.MatchString(req.Email) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "a valid email is required"})
+		return
+	}
+	var (
+		e   *Suppression
+		err error
+	)
+	switch req.Reason {
+	case "", SuppressManual:
+		e, err = suppressions.Add(req.Email, SuppressManual, "admin", req.Detail)
+	case SuppressUnsubscribed:
+		err = unsubscribe(req.Email, "admin")
+		e = suppressions.Get(req.Email)
+	case SuppressHardBounce, SuppressSpamComplaint:
+		e, err = suppressions.Add(req.Email, req.Reason, "admin", req.Detail)
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unknown reason"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to add suppression: %v", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, e)
+}
+
+// handleAdminRemoveSuppression lets mail reach an address again, e.g. after
+// a prospect fixes a full mailbox. It doesn't restart follow-ups.
+func handleAdminRemoveSuppression(w http.ResponseWriter, r *http.Request) {
+	email := r.PathValue("email")
+	switch err := suppressions.Remove(email); {
+	case errors.Is(err, errSuppressionNotFound):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+	case err != nil:
+		log.Printf("Failed to remove suppression for %s: %v", email, err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "internal error"})
+	default:
+		log.Printf("Removed suppression for %s", normalizeEmail(email))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
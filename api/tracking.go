@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"time"
+)
+
+// Kinds of email sent to a lead
+const (
+	EmailThankYou = "thank_you"
+	EmailBooking  = "booking"
+	EmailReminder = "reminder"
+	EmailNurture  = "nurture"
+)
+
+// Lead timeline event types, from Postmark's delivery webhooks
+const (
+	LeadEventDelivered     = "email_delivered"
+	LeadEventBounced       = "email_bounced"
+	LeadEventSpamComplaint = "email_spam_complaint"
+	LeadEventOpened        = "email_opened"
+)
+
+// SentEmail is an email sent to a lead, kept so Postmark's webhooks can be
+// matched back to it by MessageID
+type SentEmail struct {
+	MessageID string    `json:"messageId"`
+	Kind      string    `json:"kind"`
+	Subject   string    `json:"subject"`
+	SentAt    time.Time `json:"sentAt"`
+}
+
+// LeadEvent is an entry on a lead's timeline
+type LeadEvent struct {
+	At        time.Time `json:"at"`
+	Type      string    `json:"type"`
+	MessageID string    `json:"messageId,omitempty"`
+	Detail    string    `json:"detail,omitempty"`
+}
+
+// trackEmail records a sent email on the lead. Emails suppressed or not
+// sent (empty id) aren't recorded.
+func (l *Lead) trackEmail(kind, subject, id string) {
+	if id == "" {
+		return
+	}
+	l.Emails = append(l.Emails, SentEmail{MessageID: id, Kind: kind, Subject: subject, SentAt: time.Now().UTC()})
+}
+
+// recordLeadEmail records a sent email on a stored lead, if there is one
+func recordLeadEmail(leadID, kind, subject, id string) {
+	if leadID == "" || id == "" {
+		return
+	}
+	_, err := leads.Update(leadID, func(l *Lead) error {
+		l.trackEmail(kind, subject, id)
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to record %s email on lead %s: %v", kind, leadID, err)
+	}
+}
+
+// FindByMessageID returns the lead an email was sent to, or nil
+func (s *LeadStore) FindByMessageID(id string) *Lead {
+	if id == "" {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, l := range s.leads {
+		for _, e := range l.Emails {
+			if e.MessageID == id {
+				return l.clone()
+			}
+		}
+	}
+	return nil
+}
+
+// errDuplicateEvent skips an event Postmark delivered twice
+var errDuplicateEvent = errors.New("event already recorded")
+
+// recordDeliveryEvent adds a Postmark event to the timeline of the lead the
+// message went to. A hard bounce also flags the lead, and the first one
+// tells the business to call instead.
+func recordDeliveryEvent(ev PostmarkEvent, eventType string, hardBounce bool) {
+	lead := leads.FindByMessageID(ev.MessageID)
+	if lead == nil {
+		return
+	}
+	firstBounce := false
+	updated, err := leads.Update(lead.ID, func(l *Lead) error {
+		for _, e := range l.Timeline {
+			if e.Type == eventType && e.MessageID == ev.MessageID {
+				return errDuplicateEvent
+			}
+		}
+		l.Timeline = append(l.Timeline, LeadEvent{At: ev.at(), Type: eventType, MessageID: ev.MessageID, Detail: ev.detail()})
+		if hardBounce && l.HardBouncedAt == nil {
+			at := ev.at()
+			l.HardBouncedAt, firstBounce = &at, true
+		}
+		return nil
+	})
+	if errors.Is(err, errDuplicateEvent) {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to record %s on lead %s: %v", eventType, lead.ID, err)
+		return
+	}
+	log.Printf("Lead %s: %s (message %s)", updated.ID, eventType, ev.MessageID)
+	if firstBounce {
+		if err := sendBounceNotice(updated, ev.detail()); err != nil {
+			log.Printf("Failed to send bounce notice for lead %s: %v", updated.ID, err)
+		}
+	}
+}
+
+// sendBounceNotice asks the business to phone a lead whose email address
+// doesn't work
+func sendBounceNotice(lead *Lead, detail string) error {
+	token, to, from := os.Getenv("POSTMARK_TOKEN"), os.Getenv("POSTMARK_TO"), os.Getenv("POSTMARK_FROM")
+	if token == "" || to == "" || from == "" {
+		return nil
+	}
+	locale := businessLocale()
+	tr := func(key string, args ...any) string {
+		return translate(locale, key, args...)
+	}
+	name := lead.FirstName + " " + lead.LastName
+	subject := tr("bounce.subject", name)
+	htmlBody, textBody := simpleEmail(locale, subject,
+		[]string{
+			tr("bounce.body", name, lead.Email),
+			tr("notify.phone") + ": " + orDash(lead.PhoneNumber) + "\n" + tr("bounce.reason") + ": " + orDash(detail),
+		},
+		[]emailLink{{Label: tr("notify.view_lead"), URL: adminLeadURL(lead.ID)}},
+		"", "")
+	_, err := sendEmail(token, PostmarkEmail{
+		From:          from,
+		To:            to,
+		Subject:       subject,
+		TextBody:      textBody,
+		HtmlBody:      htmlBody,
+		MessageStream: "outbound",
+	})
+	return err
+}
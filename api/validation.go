@@ -3,24 +3,55 @@ package main
 import (
 	"regexp"
 	"strings"
+	"unicode/utf8"
 )
 
+// FormGuard holds the anti-spam fields every public form posts alongside
+// its own, for the spam pipeline
+type FormGuard struct {
+	Website           string `json:"website"`               // Honeypot field
+	TurnstileResponse string `json:"cf-turnstile-response"` // Cloudflare Turnstile token
+	HCaptchaResponse  string `json:"h-captcha-response"`    // hCaptcha token
+	RecaptchaResponse string `json:"g-recaptcha-response"`  // reCAPTCHA v3 token
+	CaptchaResponse   string `json:"captcha-response"`      // Proof-of-work solution
+	FormToken         string `json:"form-token"`            // Signed form-render token
+}
+
+// CaptchaToken returns the token submitted in the given CAPTCHA form field
+func (g *FormGuard) CaptchaToken(field string) string {
+	switch field {
+	case "cf-turnstile-response":
+		return g.TurnstileResponse
+	case "h-captcha-response":
+		return g.HCaptchaResponse
+	case "g-recaptcha-response":
+		return g.RecaptchaResponse
+	case "captcha-response":
+		return g.CaptchaResponse
+	}
+	return ""
+}
+
 // ContactForm represents the contact form submission
 type ContactForm struct {
-	FirstName         string   `json:"first-name"`
-	LastName          string   `json:"last-name"`
-	Email             string   `json:"email"`
-	PhoneNumber       string   `json:"phone-number"`
-	AnnualRevenue     string   `json:"annual-revenue"`
-	Services          []string `json:"services"`
-	Message           string   `json:"message"`
-	Website           string   `json:"website"`              // Honeypot field
-	TurnstileResponse string   `json:"cf-turnstile-response"` // Cloudflare Turnstile token
+	FirstName     string   `json:"first-name"`
+	LastName      string   `json:"last-name"`
+	Email         string   `json:"email"`
+	PhoneNumber   string   `json:"phone-number"`
+	AnnualRevenue string   `json:"annual-revenue"`
+	Services      []string `json:"services"`
+	Message       string   `json:"message"`
+	Consent       bool     `json:"consent"` // Agreed to the privacy policy
+	Locale        string   `json:"locale"`  // Optional explicit locale (e.g. "es")
+	FormGuard
+
+	Attachments []Attachment `json:"-"` // Files stored from a multipart submission
 }
 
 // ValidationError represents a validation error
 type ValidationError struct {
 	Field   string `json:"field"`
+	Code    string `json:"code"`
 	Message string `json:"message"`
 }
 
@@ -50,134 +81,93 @@ var validServices = map[string]bool{
 
 // Regex patterns
 var (
-	namePattern  = regexp.MustCompile(`^[a-zA-Z\s'\-]+$`)
+	namePattern  = regexp.MustCompile(`^[\p{L}\s'\-]+$`)
 	emailPattern = regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}$`)
 	phonePattern = regexp.MustCompile(`^[\+]?[1-9]?[\d\s\-\(\)\.]{10,15}$`)
 )
 
-// Validate validates the contact form
-func (f *ContactForm) Validate() ValidationResult {
+// Validate validates the contact form, rendering messages in the given locale
+func (f *ContactForm) Validate(locale string) ValidationResult {
 	result := ValidationResult{Valid: true, Errors: []ValidationError{}}
 
+	addError := func(field, code string, args ...any) {
+		result.Errors = append(result.Errors, ValidationError{
+			Field:   field,
+			Code:    code,
+			Message: translate(locale, code, args...),
+		})
+	}
+
 	// Validate first name
 	firstName := strings.TrimSpace(f.FirstName)
 	if firstName == "" {
-		result.Errors = append(result.Errors, ValidationError{
-			Field:   "first-name",
-			Message: "First name is required",
-		})
-	} else if len(firstName) < 2 {
-		result.Errors = append(result.Errors, ValidationError{
-			Field:   "first-name",
-			Message: "First name must be at least 2 characters",
-		})
-	} else if len(firstName) > 50 {
-		result.Errors = append(result.Errors, ValidationError{
-			Field:   "first-name",
-			Message: "First name must be less than 50 characters",
-		})
+		addError("first-name", "first_name_required")
+	} else if utf8.RuneCountInString(firstName) < 2 {
+		addError("first-name", "first_name_too_short")
+	} else if utf8.RuneCountInString(firstName) > 50 {
+		addError("first-name", "first_name_too_long")
 	} else if !namePattern.MatchString(firstName) {
-		result.Errors = append(result.Errors, ValidationError{
-			Field:   "first-name",
-			Message: "First name can only contain letters, spaces, hyphens, and apostrophes",
-		})
+		addError("first-name", "first_name_invalid")
 	}
 
 	// Validate last name
 	lastName := strings.TrimSpace(f.LastName)
 	if lastName == "" {
-		result.Errors = append(result.Errors, ValidationError{
-			Field:   "last-name",
-			Message: "Last name is required",
-		})
-	} else if len(lastName) < 2 {
-		result.Errors = append(result.Errors, ValidationError{
-			Field:   "last-name",
-			Message: "Last name must be at least 2 characters",
-		})
-	} else if len(lastName) > 50 {
-		result.Errors = append(result.Errors, ValidationError{
-			Field:   "last-name",
-			Message: "Last name must be less than 50 characters",
-		})
+		addError("last-name", "last_name_required")
+	} else if utf8.RuneCountInString(lastName) < 2 {
+		addError("last-name", "last_name_too_short")
+	} else if utf8.RuneCountInString(lastName) > 50 {
+		addError("last-name", "last_name_too_long")
 	} else if !namePattern.MatchString(lastName) {
-		result.Errors = append(result.Errors, ValidationError{
-			Field:   "last-name",
-			Message: "Last name can only contain letters, spaces, hyphens, and apostrophes",
-		})
+		addError("last-name", "last_name_invalid")
 	}
 
 	// Validate email
 	email := strings.TrimSpace(f.Email)
 	if email == "" {
-		result.Errors = append(result.Errors, ValidationError{
-			Field:   "email",
-			Message: "Email is required",
-		})
+		addError("email", "email_required")
 	} else if len(email) > 254 {
-		result.Errors = append(result.Errors, ValidationError{
-			Field:   "email",
-			Message: "Email must be less than 254 characters",
-		})
+		addError("email", "email_too_long")
 	} else if !emailPattern.MatchString(email) {
-		result.Errors = append(result.Errors, ValidationError{
-			Field:   "email",
-			Message: "Please enter a valid email address",
-		})
+		addError("email", "email_invalid")
 	}
 
 	// Validate phone number
 	phone := strings.TrimSpace(f.PhoneNumber)
 	if phone == "" {
-		result.Errors = append(result.Errors, ValidationError{
-			Field:   "phone-number",
-			Message: "Phone number is required",
-		})
+		addError("phone-number", "phone_required")
 	} else if !phonePattern.MatchString(phone) {
-		result.Errors = append(result.Errors, ValidationError{
-			Field:   "phone-number",
-			Message: "Please enter a valid phone number",
-		})
+		addError("phone-number", "phone_invalid")
 	}
 
 	// Validate annual revenue
 	revenue := strings.TrimSpace(f.AnnualRevenue)
 	if revenue == "" {
-		result.Errors = append(result.Errors, ValidationError{
-			Field:   "annual-revenue",
-			Message: "Please select your annual revenue range",
-		})
+		addError("annual-revenue", "revenue_required")
 	} else if !validRevenueRanges[revenue] {
-		result.Errors = append(result.Errors, ValidationError{
-			Field:   "annual-revenue",
-			Message: "Please select a valid revenue range",
-		})
+		addError("annual-revenue", "revenue_invalid")
 	}
 
 	// Validate services
 	if len(f.Services) == 0 {
-		result.Errors = append(result.Errors, ValidationError{
-			Field:   "services",
-			Message: "Please select at least one service you're interested in",
-		})
+		addError("services", "services_required")
 	} else {
 		for _, service := range f.Services {
 			if !validServices[service] {
-				result.Errors = append(result.Errors, ValidationError{
-					Field:   "services",
-					Message: "Invalid service selected: " + service,
-				})
+				addError("services", "service_invalid", service)
 				break
 			}
 		}
 	}
 
 	// Validate message (optional but has max length)
-	if len(f.Message) > 2000 {
-		result.Errors = append(result.Errors, ValidationError{
-			Field:   "message",
-			Message: "Message must be less than 2000 characters",
-		})
+	if utf8.RuneCountInString(f.Message) > 2000 {
+		addError("message", "message_too_long")
+	}
+
+	// Validate consent (only when CONSENT_REQUIRED is set)
+	if consentRequired() && !f.Consent {
+		addError("consent", "consent_required")
 	}
 
 	result.Valid = len(result.Errors) == 0
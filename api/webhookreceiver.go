@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// runWebhookReceiver starts a local endpoint that verifies and prints
+// webhook deliveries, for testing integrations without a third party:
+//
+//	go run . webhook-receiver -addr :9090 -secret test
+//
+// then point WEBHOOK_URL at http://localhost:9090/ with WEBHOOK_SECRET=test.
+// It also stands in for Slack, Discord and Teams: run it without -secret and
+// point SLACK_WEBHOOK_URL (etc.) at it to see the rendered cards.
+// -fail makes it answer 500 to exercise retries.
+func runWebhookReceiver(args []string) error {
+	fs := flag.NewFlagSet("webhook-receiver", flag.ExitOnError)
+	addr := fs.String("addr", ":9090", "listen address")
+	secret := fs.String("secret", "", "shared secret for signature checks (empty skips them)")
+	tolerance := fs.Duration("tolerance", 5*time.Minute, "maximum timestamp skew")
+	fail := fs.Bool("fail", false, "answer every request with 500")
+	fs.Parse(args)
+
+	var mu sync.Mutex
+	seen := make(map[string]bool)
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, "read failed", http.StatusBadRequest)
+			return
+		}
+		delivery := r.Header.Get(webhookDeliveryHeader)
+		log.Printf("%s %s event=%s delivery=%s", r.Method, r.URL.Path, r.Header.Get(webhookEventHeader), delivery)
+
+		if *secret != "" {
+			if err := verifyWebhook(*secret, r.Header, body, *tolerance, time.Now()); err != nil {
+				log.Printf("  rejected: %v", err)
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			log.Printf("  signature ok")
+		}
+		mu.Lock()
+		if seen[delivery] {
+			log.Printf("  duplicate delivery (a retry after a lost response)")
+		}
+		seen[delivery] = true
+		mu.Unlock()
+
+		var pretty bytes.Buffer
+		if json.Indent(&pretty, body, "  ", "  ") == nil {
+			log.Printf("  %s", pretty.String())
+		} else {
+			log.Printf("  %s", body)
+		}
+
+		if *fail {
+			http.Error(w, "failing on purpose", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+
+	log.Printf("Webhook receiver listening on %s", *addr)
+	return http.ListenAndServe(*addr, http.HandlerFunc(handler))
+}
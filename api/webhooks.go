@@ -0,0 +1,741 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Webhook events. Endpoints without an events list get the lead events;
+// subscriber events must be listed explicitly.
+const (
+	EventLeadCreated            = "lead.created"
+	EventLeadUpdated            = "lead.updated" // a repeat submission was merged in
+	EventSubscriberConfirmed    = "subscriber.confirmed"
+	EventSubscriberUnsubscribed = "subscriber.unsubscribed"
+)
+
+// Delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook signing headers. The signature is an HMAC-SHA256 of
+// "<timestamp>.<body>" so a captured request can't be replayed later with a
+// new timestamp.
+const (
+	webhookEventHeader     = "X-Momentum-Event"
+	webhookDeliveryHeader  = "X-Momentum-Delivery"
+	webhookTimestampHeader = "X-Momentum-Timestamp"
+	webhookSignatureHeader = "X-Momentum-Signature"
+)
+
+// Dispatcher defaults, overridable via environment
+const (
+	defaultWebhookMaxAttempts = 6
+	defaultWebhookLogSize     = 100
+	webhookTimeout            = 10 * time.Second
+)
+
+// webhookBackoff is the wait before each retry; the last entry repeats
+var webhookBackoff = []time.Duration{
+	30 * time.Second,
+	2 * time.Minute,
+	10 * time.Minute,
+	time.Hour,
+	6 * time.Hour,
+}
+
+// WebhookEndpoint is an outbound destination for lead events
+type WebhookEndpoint struct {
+	Name   string   `json:"name"`
+	Kind   string   `json:"kind,omitempty"` // webhook (default), slack, discord or teams
+	URL    string   `json:"url"`
+	Secret string   `json:"secret,omitempty"`
+	Events []string `json:"events,omitempty"` // empty means every lead event
+}
+
+// render builds the request body for an event. Chat endpoints get a card
+// for the lead in their own format; everything else gets the shared payload.
+func (e *WebhookEndpoint) render(lead *Lead, payload []byte) ([]byte, error) {
+	switch e.Kind {
+	case KindSlack, KindDiscord, KindTeams:
+		if lead == nil {
+			return nil, errors.New("chat endpoints only take lead events")
+		}
+		return renderChat(e.Kind, lead)
+	}
+	return payload, nil
+}
+
+// wants reports whether the endpoint subscribes to event
+func (e *WebhookEndpoint) wants(event string) bool {
+	if len(e.Events) == 0 {
+		return strings.HasPrefix(event, "lead.")
+	}
+	return slices.Contains(e.Events, event)
+}
+
+// WebhookLead is the lead as sent to webhook endpoints: the normalized
+// contact form fields plus the lead's ID and timestamps
+type WebhookLead struct {
+	ID            string    `json:"id"`
+	FirstName     string    `json:"firstName"`
+	LastName      string    `json:"lastName"`
+	Email         string    `json:"email"`
+	PhoneNumber   string    `json:"phoneNumber"`
+	AnnualRevenue string    `json:"annualRevenue"`
+	Services      []string  `json:"services"`
+	Message       string    `json:"message,omitempty"`
+	Locale        string    `json:"locale"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+// WebhookSubscriber is the newsletter subscriber as sent to webhook
+// endpoints, with the consent record
+type WebhookSubscriber struct {
+	ID             string     `json:"id"`
+	Email          string     `json:"email"`
+	Status         string     `json:"status"`
+	Locale         string     `json:"locale"`
+	Source         string     `json:"source,omitempty"`
+	SignupIP       string     `json:"signupIp,omitempty"`
+	RequestedAt    time.Time  `json:"requestedAt"`
+	ConfirmedAt    *time.Time `json:"confirmedAt,omitempty"`
+	ConfirmIP      string     `json:"confirmIp,omitempty"`
+	UnsubscribedAt *time.Time `json:"unsubscribedAt,omitempty"`
+}
+
+// WebhookPayload is the JSON body of every webhook request. Lead events
+// carry the lead, subscriber events the subscriber.
+type WebhookPayload struct {
+	ID         string             `json:"id"`
+	Event      string             `json:"event"`
+	CreatedAt  time.Time          `json:"createdAt"`
+	Lead       *WebhookLead       `json:"lead,omitempty"`
+	Subscriber *WebhookSubscriber `json:"subscriber,omitempty"`
+}
+
+// Delivery is one event queued for one endpoint, with its attempt history
+type Delivery struct {
+	ID           string          `json:"id"`
+	Endpoint     string          `json:"endpoint"`
+	Event        string          `json:"event"`
+	LeadID       string          `json:"leadId,omitempty"`
+	SubscriberID string          `json:"subscriberId,omitempty"`
+	Status       string          `json:"status"`
+	Payload      json.RawMessage `json:"payload,omitempty"`
+	Attempts     []Attempt       `json:"attempts,omitempty"`
+	NextAttempt  time.Time       `json:"nextAttempt,omitempty"`
+	CreatedAt    time.Time       `json:"createdAt"`
+
+	inFlight bool
+	// The payload as stored, encrypted once when queued; unset when
+	// encryption is off
+	sealedPayload string
+	envelope      *Envelope
+}
+
+// storedDelivery is a delivery as written to the log. With encryption on,
+// the payload, which carries the lead or subscriber, is only stored sealed.
+type storedDelivery struct {
+	Delivery
+	SealedPayload string    `json:"sealedPayload,omitempty"`
+	Envelope      *Envelope `json:"envelope,omitempty"`
+}
+
+// stored returns the delivery as written to the log
+func (del *Delivery) stored() storedDelivery {
+	sd := storedDelivery{Delivery: *del, SealedPayload: del.sealedPayload, Envelope: del.envelope}
+	if del.envelope != nil {
+		sd.Payload = nil
+	}
+	return sd
+}
+
+// Attempt records a single delivery attempt
+type Attempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"durationMs"`
+}
+
+// Dispatcher queues lead events for the configured endpoints and delivers
+// them in the background, retrying failures with backoff. The queue and
+// a bounded per-endpoint log are persisted so retries survive restarts.
+type Dispatcher struct {
+	mu          sync.Mutex
+	path        string
+	endpoints   []*WebhookEndpoint
+	deliveries  []*Delivery
+	maxAttempts int
+	logSize     int
+	client      *http.Client
+	wake        chan struct{}
+}
+
+// webhooks is the process-wide dispatcher, built in main
+var webhooks *Dispatcher
+
+// loadWebhookEndpoints reads endpoints from WEBHOOKS_FILE (a JSON array of
+// endpoints), the single WEBHOOK_URL and WEBHOOK_SECRET pair, and the chat
+// notifier URLs
+func loadWebhookEndpoints() ([]*WebhookEndpoint, error) {
+	var endpoints []*WebhookEndpoint
+	if path := os.Getenv("WEBHOOKS_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &endpoints); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	}
+	if url := os.Getenv("WEBHOOK_URL"); url != "" {
+		endpoints = append(endpoints, &WebhookEndpoint{
+			Name:   "default",
+			URL:    url,
+			Secret: os.Getenv("WEBHOOK_SECRET"),
+		})
+	}
+	endpoints = append(endpoints, loadChatNotifiers()...)
+	endpoints = append(endpoints, loadCRMEndpoints()...)
+	endpoints = append(endpoints, loadMarketingEndpoints()...)
+
+	seen := make(map[string]bool)
+	for _, e := range endpoints {
+		if e.Name == "" || e.URL == "" {
+			return nil, errors.New("webhook endpoints need a name and url")
+		}
+		switch e.Kind {
+		case "", KindWebhook, KindSlack, KindDiscord, KindTeams, KindHubSpot, KindPipedrive, KindMailchimp:
+		default:
+			return nil, fmt.Errorf("webhook endpoint %q has unknown kind %q", e.Name, e.Kind)
+		}
+		if (e.Kind == KindHubSpot || e.Kind == KindPipedrive) && crmAdapters[e.Name] == nil {
+			return nil, fmt.Errorf("CRM endpoint %q must be configured through its token variable", e.Name)
+		}
+		if e.Kind == KindMailchimp && marketingAdapters[e.Name] == nil {
+			return nil, fmt.Errorf("marketing endpoint %q must be configured through its API key variables", e.Name)
+		}
+		if seen[e.Name] {
+			return nil, fmt.Errorf("duplicate webhook endpoint %q", e.Name)
+		}
+		seen[e.Name] = true
+		if e.Secret == "" && (e.Kind == "" || e.Kind == KindWebhook) {
+			log.Printf("Webhook endpoint %s has no secret, requests will be unsigned", e.Name)
+		}
+	}
+	return endpoints, nil
+}
+
+// newDispatcher loads the delivery log from dir
+func newDispatcher(dir string, endpoints []*WebhookEndpoint) (*Dispatcher, error) {
+	d := &Dispatcher{
+		path:        filepath.Join(dir, "webhook_deliveries.json"),
+		endpoints:   endpoints,
+		maxAttempts: envInt("WEBHOOK_MAX_ATTEMPTS", defaultWebhookMaxAttempts),
+		logSize:     envInt("WEBHOOK_LOG_SIZE", defaultWebhookLogSize),
+		client:      &http.Client{Timeout: webhookTimeout},
+		wake:        make(chan struct{}, 1),
+	}
+	var stored []storedDelivery
+	if err := loadJSON(d.path, &stored); err != nil {
+		return nil, err
+	}
+	for _, sd := range stored {
+		del, err := openDelivery(sd)
+		if err != nil {
+			return nil, err
+		}
+		d.deliveries = append(d.deliveries, del)
+	}
+	metrics.Describe("webhook_attempts_total", "Outbound webhook delivery attempts by endpoint and result")
+	return d, nil
+}
+
+// Endpoint returns the endpoint with the given name, or nil
+func (d *Dispatcher) Endpoint(name string) *WebhookEndpoint {
+	for _, e := range d.endpoints {
+		if e.Name == name {
+			return e
+		}
+	}
+	return nil
+}
+
+// Enqueue queues a lead event for every endpoint subscribed to it
+func (d *Dispatcher) Enqueue(event string, lead *Lead) {
+	d.enqueue(event, WebhookPayload{
+		Lead: &WebhookLead{
+			ID:            lead.ID,
+			FirstName:     lead.FirstName,
+			LastName:      lead.LastName,
+			Email:         lead.Email,
+			PhoneNumber:   lead.PhoneNumber,
+			AnnualRevenue: lead.AnnualRevenue,
+			Services:      lead.Services,
+			Message:       lead.Message,
+			Locale:        lead.Locale,
+			CreatedAt:     lead.CreatedAt,
+			UpdatedAt:     lead.UpdatedAt,
+		},
+	}, lead, nil)
+}
+
+// EnqueueSubscriber queues a subscriber event for every endpoint
+// subscribed to it
+func (d *Dispatcher) EnqueueSubscriber(event string, sub *Subscriber) {
+	d.enqueue(event, WebhookPayload{
+		Subscriber: &WebhookSubscriber{
+			ID:             sub.ID,
+			Email:          sub.Email,
+			Status:         sub.Status,
+			Locale:         sub.Locale,
+			Source:         sub.Source,
+			SignupIP:       sub.SignupIP,
+			RequestedAt:    sub.RequestedAt,
+			ConfirmedAt:    sub.ConfirmedAt,
+			ConfirmIP:      sub.ConfirmIP,
+			UnsubscribedAt: sub.UnsubscribedAt,
+		},
+	}, nil, sub)
+}
+
+// enqueue stamps and encodes the payload and queues a delivery per
+// endpoint. One of lead and sub is set.
+func (d *Dispatcher) enqueue(event string, p WebhookPayload, lead *Lead, sub *Subscriber) {
+	now := time.Now().UTC()
+	p.ID, p.Event, p.CreatedAt = newID(), event, now
+	payload, err := json.Marshal(p)
+	if err != nil {
+		log.Printf("Failed to encode webhook payload: %v", err)
+		return
+	}
+
+	d.mu.Lock()
+	queued := 0
+	for _, e := range d.endpoints {
+		if !e.wants(event) {
+			continue
+		}
+		body, err := e.render(lead, payload)
+		if err != nil {
+			log.Printf("Failed to render %s notification: %v", e.Name, err)
+			continue
+		}
+		del := &Delivery{
+			ID:          newID(),
+			Endpoint:    e.Name,
+			Event:       event,
+			Status:      DeliveryPending,
+			Payload:     body,
+			NextAttempt: now,
+			CreatedAt:   now,
+		}
+		if lead != nil {
+			del.LeadID = lead.ID
+		} else {
+			del.SubscriberID = sub.ID
+		}
+		if err := sealDelivery(del); err != nil {
+			log.Printf("Failed to encrypt %s delivery: %v", e.Name, err)
+			continue
+		}
+		d.deliveries = append(d.deliveries, del)
+		queued++
+	}
+	if queued > 0 {
+		d.saveLocked()
+	}
+	d.mu.Unlock()
+
+	if queued > 0 {
+		d.notify()
+	}
+}
+
+// Retry requeues a delivery for an immediate attempt
+func (d *Dispatcher) Retry(id string) (*Delivery, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, del := range d.deliveries {
+		if del.ID != id {
+			continue
+		}
+		if del.inFlight {
+			return nil, errors.New("delivery is in progress")
+		}
+		del.Status = DeliveryPending
+		del.NextAttempt = time.Now().UTC()
+		d.saveLocked()
+		d.notify()
+		cp := *del
+		return &cp, nil
+	}
+	return nil, errDeliveryNotFound
+}
+
+// errDeliveryNotFound is returned when a delivery ID doesn't exist
+var errDeliveryNotFound = errors.New("delivery not found")
+
+// Deliveries returns the log for an endpoint, newest first
+func (d *Dispatcher) Deliveries(endpoint string) []*Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var out []*Delivery
+	for i := len(d.deliveries) - 1; i >= 0; i-- {
+		if del := d.deliveries[i]; del.Endpoint == endpoint {
+			cp := *del
+			out = append(out, &cp)
+		}
+	}
+	return out
+}
+
+// Find returns copies of the deliveries matching fn, oldest first
+func (d *Dispatcher) Find(fn func(*Delivery) bool) []*Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := []*Delivery{}
+	for _, del := range d.deliveries {
+		if fn(del) {
+			cp := *del
+			out = append(out, &cp)
+		}
+	}
+	return out
+}
+
+// Forget drops the deliveries matching fn, pending or not, and returns how
+// many it dropped. Their payloads go with them.
+func (d *Dispatcher) Forget(fn func(*Delivery) bool) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := len(d.deliveries)
+	d.deliveries = slices.DeleteFunc(d.deliveries, fn)
+	if n -= len(d.deliveries); n > 0 {
+		d.saveLocked()
+	}
+	return n
+}
+
+// Run delivers due events until ctx is cancelled
+func (d *Dispatcher) Run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		case <-d.wake:
+		}
+
+		now := time.Now()
+		next := now.Add(time.Minute)
+		d.mu.Lock()
+		for _, del := range d.deliveries {
+			if del.Status != DeliveryPending || del.inFlight {
+				continue
+			}
+			if del.NextAttempt.After(now) {
+				if del.NextAttempt.Before(next) {
+					next = del.NextAttempt
+				}
+				continue
+			}
+			if endpoint := d.Endpoint(del.Endpoint); endpoint != nil {
+				del.inFlight = true
+				go d.attempt(endpoint, del.ID)
+			} else {
+				del.Status = DeliveryFailed
+				del.Attempts = append(del.Attempts, Attempt{At: now.UTC(), Error: "endpoint no longer configured"})
+			}
+		}
+		d.mu.Unlock()
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(time.Until(next))
+	}
+}
+
+// attempt sends one delivery and records the outcome
+func (d *Dispatcher) attempt(endpoint *WebhookEndpoint, id string) {
+	d.mu.Lock()
+	var del *Delivery
+	for _, candidate := range d.deliveries {
+		if candidate.ID == id {
+			del = candidate
+			break
+		}
+	}
+	if del == nil {
+		d.mu.Unlock()
+		return
+	}
+	event, payload := del.Event, del.Payload
+	d.mu.Unlock()
+
+	start := time.Now()
+	var status int
+	var err error
+	if adapter, ok := crmAdapters[endpoint.Name]; ok {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		status, err = syncCRM(ctx, endpoint.Name, adapter, payload)
+		cancel()
+	} else if adapter, ok := marketingAdapters[endpoint.Name]; ok {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		status, err = syncMarketing(ctx, adapter, payload)
+		cancel()
+	} else {
+		status, err = d.send(endpoint, id, event, payload, start)
+	}
+	attempt := Attempt{
+		At:         start.UTC(),
+		StatusCode: status,
+		DurationMS: time.Since(start).Milliseconds(),
+	}
+	result := "success"
+	if err != nil {
+		attempt.Error = err.Error()
+		result = "error"
+	}
+	metrics.Inc("webhook_attempts_total", "endpoint", endpoint.Name, "result", result)
+
+	d.mu.Lock()
+	del.inFlight = false
+	del.Attempts = append(del.Attempts, attempt)
+	switch {
+	case err == nil:
+		del.Status = DeliveryDelivered
+		del.NextAttempt = time.Time{}
+	case len(del.Attempts) >= d.maxAttempts:
+		del.Status = DeliveryFailed
+		del.NextAttempt = time.Time{}
+		log.Printf("Webhook %s to %s failed after %d attempts: %v", id, endpoint.Name, len(del.Attempts), err)
+	default:
+		wait := webhookBackoff[min(len(del.Attempts), len(webhookBackoff))-1]
+		del.NextAttempt = time.Now().Add(wait).UTC()
+		log.Printf("Webhook %s to %s failed, retrying in %s: %v", id, endpoint.Name, wait, err)
+	}
+	d.pruneLocked()
+	d.saveLocked()
+	d.mu.Unlock()
+	d.notify()
+}
+
+// send posts a signed payload, treating any non-2xx response as a failure
+func (d *Dispatcher) send(endpoint *WebhookEndpoint, id, event string, payload []byte, now time.Time) (int, error) {
+	req, err := http.NewRequest("POST", endpoint.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "momentum-business-webhooks/1")
+	req.Header.Set(webhookEventHeader, event)
+	req.Header.Set(webhookDeliveryHeader, id)
+	req.Header.Set(webhookTimestampHeader, timestamp)
+	if endpoint.Secret != "" {
+		req.Header.Set(webhookSignatureHeader, "sha256="+signWebhook(endpoint.Secret, timestamp, payload))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint returned %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// signWebhook returns the hex HMAC-SHA256 of "<timestamp>.<body>"
+func signWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyWebhook checks a request's signature and that its timestamp is
+// within tolerance of now. Receivers should also dedupe on the delivery ID.
+func verifyWebhook(secret string, header http.Header, body []byte, tolerance time.Duration, now time.Time) error {
+	timestamp := header.Get(webhookTimestampHeader)
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("missing or invalid timestamp")
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > tolerance || age < -tolerance {
+		return fmt.Errorf("timestamp outside tolerance (%s)", age.Round(time.Second))
+	}
+	sig, ok := strings.CutPrefix(header.Get(webhookSignatureHeader), "sha256=")
+	if !ok {
+		return errors.New("missing signature")
+	}
+	if !hmac.Equal([]byte(sig), []byte(signWebhook(secret, timestamp, body))) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+// notify wakes the delivery loop without blocking
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// pruneLocked keeps every pending delivery plus the newest logSize finished
+// deliveries per endpoint. Callers must hold the lock.
+func (d *Dispatcher) pruneLocked() {
+	finished := make(map[string]int)
+	keep := make([]*Delivery, 0, len(d.deliveries))
+	for i := len(d.deliveries) - 1; i >= 0; i-- {
+		del := d.deliveries[i]
+		if del.Status != DeliveryPending {
+			finished[del.Endpoint]++
+			if finished[del.Endpoint] > d.logSize {
+				continue
+			}
+		}
+		keep = append(keep, del)
+	}
+	slices.Reverse(keep)
+	d.deliveries = keep
+}
+
+// Reseal rewraps every sealed payload's data key under the current key,
+// sealing any stored in plaintext, rewrites the log and returns how many
+// deliveries it holds
+func (d *Dispatcher) Reseal() (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, del := range d.deliveries {
+		var err error
+		switch {
+		case del.envelope == nil:
+			err = sealDelivery(del)
+		case del.envelope.KeyVersion != keyring.Current():
+			del.envelope, err = keyring.Rewrap(del.envelope, del.ID)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("delivery %s: %w", del.ID, err)
+		}
+	}
+	return len(d.deliveries), saveJSON(d.path, d.storedLocked())
+}
+
+// storedLocked returns the deliveries as written to the log. Callers must
+// hold the lock.
+func (d *Dispatcher) storedLocked() []storedDelivery {
+	list := make([]storedDelivery, 0, len(d.deliveries))
+	for _, del := range d.deliveries {
+		list = append(list, del.stored())
+	}
+	return list
+}
+
+// saveLocked persists the deliveries, with payloads sealed when encryption
+// is on. Callers must hold the lock.
+func (d *Dispatcher) saveLocked() {
+	if err := saveJSON(d.path, d.storedLocked()); err != nil {
+		log.Printf("Failed to save webhook deliveries: %v", err)
+	}
+}
+
+// webhookSummary describes an endpoint in the admin API, without its secret
+type webhookSummary struct {
+	Name      string         `json:"name"`
+	Kind      string         `json:"kind,omitempty"`
+	URL       string         `json:"url"`
+	Events    []string       `json:"events,omitempty"`
+	Signed    bool           `json:"signed"`
+	Counts    map[string]int `json:"counts"`
+	LastError string         `json:"lastError,omitempty"`
+}
+
+// handleAdminListWebhooks lists the configured endpoints with delivery counts
+func handleAdminListWebhooks(w http.ResponseWriter, r *http.Request) {
+	out := []webhookSummary{}
+	for _, e := range webhooks.endpoints {
+		summary := webhookSummary{
+			Name:   e.Name,
+			Kind:   e.Kind,
+			URL:    e.URL,
+			Events: e.Events,
+			Signed: e.Secret != "",
+			Counts: map[string]int{},
+		}
+		for _, del := range webhooks.Deliveries(e.Name) {
+			summary.Counts[del.Status]++
+			if summary.LastError == "" && len(del.Attempts) > 0 {
+				summary.LastError = del.Attempts[len(del.Attempts)-1].Error
+			}
+		}
+		out = append(out, summary)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleAdminWebhookDeliveries returns an endpoint's delivery log, optionally
+// filtered by ?status=
+func handleAdminWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if webhooks.Endpoint(name) == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "endpoint not found"})
+		return
+	}
+	status := r.URL.Query().Get("status")
+	out := []*Delivery{}
+	for _, del := range webhooks.Deliveries(name) {
+		if status == "" || del.Status == status {
+			out = append(out, del)
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// handleAdminRetryDelivery requeues a delivery for an immediate attempt
+func handleAdminRetryDelivery(w http.ResponseWriter, r *http.Request) {
+	del, err := webhooks.Retry(r.PathValue("id"))
+	switch {
+	case errors.Is(err, errDeliveryNotFound):
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+	case err != nil:
+		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+	default:
+		writeJSON(w, http.StatusAccepted, del)
+	}
+}
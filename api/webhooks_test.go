@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestDispatcher builds a dispatcher keeping its log in a temporary
+// directory. Deliveries are attempted by calling attempt directly rather
+// than through Run.
+func newTestDispatcher(t *testing.T, dir string, endpoints ...*WebhookEndpoint) *Dispatcher {
+	t.Helper()
+	d, err := newDispatcher(dir, endpoints)
+	if err != nil {
+		t.Fatalf("newDispatcher: %v", err)
+	}
+	return d
+}
+
+// onlyDelivery returns the single delivery queued for endpoint
+func onlyDelivery(t *testing.T, d *Dispatcher, endpoint string) *Delivery {
+	t.Helper()
+	list := d.Deliveries(endpoint)
+	if len(list) != 1 {
+		t.Fatalf("got %d deliveries for %s, want 1", len(list), endpoint)
+	}
+	return list[0]
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	const secret = "s3cret"
+	body := []byte(`{"event":"lead.created"}`)
+	now := time.Unix(1_700_000_000, 0)
+	signed := func(ts time.Time, secret string, body []byte) http.Header {
+		timestamp := strconv.FormatInt(ts.Unix(), 10)
+		return http.Header{
+			webhookTimestampHeader: {timestamp},
+			webhookSignatureHeader: {"sha256=" + signWebhook(secret, timestamp, body)},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		header  http.Header
+		body    []byte
+		wantErr bool
+	}{
+		{"valid", signed(now, secret, body), body, false},
+		{"within tolerance", signed(now.Add(-4*time.Minute), secret, body), body, false},
+		{"tampered body", signed(now, secret, body), []byte(`{"event":"lead.updated"}`), true},
+		{"wrong secret", signed(now, "other", body), body, true},
+		{"stale timestamp", signed(now.Add(-10*time.Minute), secret, body), body, true},
+		{"future timestamp", signed(now.Add(10*time.Minute), secret, body), body, true},
+		{"missing signature", http.Header{webhookTimestampHeader: {strconv.FormatInt(now.Unix(), 10)}}, body, true},
+		{"missing timestamp", http.Header{webhookSignatureHeader: {"sha256=" + signWebhook(secret, "", body)}}, body, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyWebhook(secret, tt.header, tt.body, 5*time.Minute, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifyWebhook() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDispatcherSignsRequests(t *testing.T) {
+	const secret = "s3cret"
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	requests := make(chan received, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- received{r.Header.Clone(), body}
+	}))
+	defer server.Close()
+	endpoint := &WebhookEndpoint{Name: "zapier", URL: server.URL, Secret: secret}
+	d := newTestDispatcher(t, t.TempDir(), endpoint)
+
+	lead := testLead()
+	d.Enqueue(EventLeadCreated, lead)
+	del := onlyDelivery(t, d, "zapier")
+	d.attempt(endpoint, del.ID)
+
+	req := <-requests
+	if err := verifyWebhook(secret, req.header, req.body, time.Minute, time.Now()); err != nil {
+		t.Fatalf("signature did not verify: %v", err)
+	}
+	if got := req.header.Get(webhookEventHeader); got != EventLeadCreated {
+		t.Errorf("%s = %q, want %q", webhookEventHeader, got, EventLeadCreated)
+	}
+	if got := req.header.Get(webhookDeliveryHeader); got != del.ID {
+		t.Errorf("%s = %q, want %q", webhookDeliveryHeader, got, del.ID)
+	}
+	if got := req.header.Get("Content-Type"); got != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", got)
+	}
+
+	var payload WebhookPayload
+	if err := json.Unmarshal(req.body, &payload); err != nil {
+		t.Fatalf("payload is not JSON: %v", err)
+	}
+	if payload.Event != EventLeadCreated || payload.Lead == nil || payload.Lead.ID != lead.ID || payload.Lead.Email != lead.Email {
+		t.Errorf("unexpected payload %+v", payload)
+	}
+	if got := onlyDelivery(t, d, "zapier"); got.Status != DeliveryDelivered {
+		t.Errorf("status = %q, want %q", got.Status, DeliveryDelivered)
+	}
+}
+
+func TestDispatcherUnsignedWithoutSecret(t *testing.T) {
+	signatures := make(chan []string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signatures <- r.Header.Values(webhookSignatureHeader)
+	}))
+	defer server.Close()
+	endpoint := &WebhookEndpoint{Name: "make", URL: server.URL}
+	d := newTestDispatcher(t, t.TempDir(), endpoint)
+
+	d.Enqueue(EventLeadCreated, testLead())
+	d.attempt(endpoint, onlyDelivery(t, d, "make").ID)
+
+	if got := <-signatures; len(got) != 0 {
+		t.Errorf("unsigned endpoint got %s %q", webhookSignatureHeader, got)
+	}
+}
+
+func TestDispatcherBackoff(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+	endpoint := &WebhookEndpoint{Name: "flaky", URL: server.URL}
+	d := newTestDispatcher(t, t.TempDir(), endpoint)
+	d.maxAttempts = len(webhookBackoff) + 2
+
+	d.Enqueue(EventLeadCreated, testLead())
+	id := onlyDelivery(t, d, "flaky").ID
+
+	// The last backoff step repeats until the attempts run out
+	for i := range d.maxAttempts - 1 {
+		before := time.Now()
+		d.attempt(endpoint, id)
+		after := time.Now()
+
+		del := onlyDelivery(t, d, "flaky")
+		if del.Status != DeliveryPending {
+			t.Fatalf("attempt %d: status = %q, want %q", i+1, del.Status, DeliveryPending)
+		}
+		wait := webhookBackoff[min(i, len(webhookBackoff)-1)]
+		if del.NextAttempt.Before(before.Add(wait)) || del.NextAttempt.After(after.Add(wait)) {
+			t.Errorf("attempt %d: next attempt in %s, want %s", i+1, del.NextAttempt.Sub(before).Round(time.Second), wait)
+		}
+		last := del.Attempts[len(del.Attempts)-1]
+		if last.StatusCode != http.StatusBadGateway || last.Error == "" {
+			t.Errorf("attempt %d: recorded %+v", i+1, last)
+		}
+	}
+
+	d.attempt(endpoint, id)
+	del := onlyDelivery(t, d, "flaky")
+	if del.Status != DeliveryFailed {
+		t.Fatalf("status = %q after %d attempts, want %q", del.Status, len(del.Attempts), DeliveryFailed)
+	}
+	if !del.NextAttempt.IsZero() {
+		t.Errorf("failed delivery still scheduled for %s", del.NextAttempt)
+	}
+	if got := int(requests.Load()); got != d.maxAttempts {
+		t.Errorf("server saw %d requests, want %d", got, d.maxAttempts)
+	}
+}
+
+func TestDispatcherRetryRequeuesFailedDelivery(t *testing.T) {
+	var fail atomic.Bool
+	fail.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	endpoint := &WebhookEndpoint{Name: "crm", URL: server.URL}
+	d := newTestDispatcher(t, t.TempDir(), endpoint)
+	d.maxAttempts = 1
+
+	d.Enqueue(EventLeadCreated, testLead())
+	id := onlyDelivery(t, d, "crm").ID
+	d.attempt(endpoint, id)
+	if got := onlyDelivery(t, d, "crm").Status; got != DeliveryFailed {
+		t.Fatalf("status = %q, want %q", got, DeliveryFailed)
+	}
+
+	fail.Store(false)
+	del, err := d.Retry(id)
+	if err != nil {
+		t.Fatalf("Retry: %v", err)
+	}
+	if del.Status != DeliveryPending {
+		t.Fatalf("retried status = %q, want %q", del.Status, DeliveryPending)
+	}
+	d.attempt(endpoint, id)
+	if got := onlyDelivery(t, d, "crm").Status; got != DeliveryDelivered {
+		t.Errorf("status = %q, want %q", got, DeliveryDelivered)
+	}
+}
+
+func TestDispatcherPersistsLog(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer server.Close()
+	endpoint := &WebhookEndpoint{Name: "zapier", URL: server.URL}
+	dir := t.TempDir()
+	d := newTestDispatcher(t, dir, endpoint)
+
+	lead := testLead()
+	d.Enqueue(EventLeadCreated, lead)
+	d.Enqueue(EventLeadUpdated, lead)
+	delivered := d.Deliveries("zapier")[1] // newest first, so lead.created
+	d.attempt(endpoint, delivered.ID)
+
+	reloaded := newTestDispatcher(t, dir, endpoint)
+	got := reloaded.Deliveries("zapier")
+	if len(got) != 2 {
+		t.Fatalf("reloaded %d deliveries, want 2", len(got))
+	}
+	byID := map[string]*Delivery{}
+	for _, del := range got {
+		byID[del.ID] = del
+	}
+	for _, want := range d.Deliveries("zapier") {
+		del := byID[want.ID]
+		if del == nil {
+			t.Fatalf("delivery %s not reloaded", want.ID)
+		}
+		if del.Status != want.Status || del.Event != want.Event || del.LeadID != lead.ID {
+			t.Errorf("reloaded %+v, want %+v", del, want)
+		}
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, del.Payload); err != nil || !bytes.Equal(compact.Bytes(), want.Payload) {
+			t.Errorf("payload changed on reload:\n got %s\nwant %s", del.Payload, want.Payload)
+		}
+		if len(del.Attempts) != len(want.Attempts) {
+			t.Errorf("reloaded %d attempts, want %d", len(del.Attempts), len(want.Attempts))
+		}
+	}
+	if byID[delivered.ID].Status != DeliveryDelivered {
+		t.Errorf("delivered status not persisted: %q", byID[delivered.ID].Status)
+	}
+}
+
+func TestDispatcherPrunesFinishedDeliveries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer server.Close()
+	endpoint := &WebhookEndpoint{Name: "zapier", URL: server.URL}
+	dir := t.TempDir()
+	d := newTestDispatcher(t, dir, endpoint)
+	d.logSize = 2
+
+	for range 4 {
+		d.Enqueue(EventLeadCreated, testLead())
+	}
+	for _, del := range d.Deliveries("zapier")[1:] {
+		d.attempt(endpoint, del.ID)
+	}
+
+	// Two finished deliveries are kept, plus the one still pending
+	got := newTestDispatcher(t, dir, endpoint).Deliveries("zapier")
+	if len(got) != 3 {
+		t.Fatalf("kept %d deliveries, want 3", len(got))
+	}
+	if got[0].Status != DeliveryPending {
+		t.Errorf("pending delivery was pruned")
+	}
+}
+
+func TestDispatcherSealsPayloadsOnDisk(t *testing.T) {
+	useTestKeyring(t)
+	// Nothing is sent, the test only reads the log back
+	endpoint := &WebhookEndpoint{Name: "zapier", URL: "https://hooks.example.com/zapier"}
+	dir := t.TempDir()
+	d := newTestDispatcher(t, dir, endpoint)
+
+	lead := testLead()
+	d.Enqueue(EventLeadCreated, lead)
+
+	data, err := os.ReadFile(filepath.Join(dir, "webhook_deliveries.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte(lead.Email)) {
+		t.Fatalf("delivery log holds the plaintext email: %s", data)
+	}
+
+	del := onlyDelivery(t, newTestDispatcher(t, dir, endpoint), "zapier")
+	var payload WebhookPayload
+	if err := json.Unmarshal(del.Payload, &payload); err != nil {
+		t.Fatalf("reloaded payload is not JSON: %v", err)
+	}
+	if payload.Lead == nil || payload.Lead.Email != lead.Email {
+		t.Errorf("reloaded payload lead = %+v", payload.Lead)
+	}
+}